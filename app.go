@@ -2,25 +2,35 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"html"
 	"os/exec"
-	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/sahil485/memex/pkg/client"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/engine"
 	"github.com/sahil485/memex/pkg/indexer"
+	"github.com/sahil485/memex/pkg/roots"
 	"github.com/sahil485/memex/pkg/search"
-	"github.com/sahil485/memex/pkg/types"
+	"github.com/sahil485/memex/pkg/status"
 )
 
 // App struct
 type App struct {
-	ctx              context.Context
-	meilisearchCmd   *exec.Cmd
-	meilisearchReady bool
+	ctx         context.Context
+	meilisearch *engine.Supervisor
+	watcher     *indexer.Watcher
+
+	// cancelIndex stops the running IndexDirectory call, if any
+	indexMu     sync.Mutex
+	cancelIndex context.CancelFunc
 }
 
 // NewApp creates a new App application struct
@@ -33,86 +43,185 @@ func NewApp() *App {
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
-	// Start MeiliSearch if not already running
-	if !a.GetMeilisearchHealth() {
-		go a.startMeilisearch()
+	// Fall back to the built-in defaults if the config file is invalid
+	if err := config.Init(); err != nil {
+		fmt.Printf("Invalid configuration, using defaults: %v\n", err)
 	}
-}
 
-// startMeilisearch launches MeiliSearch as a background process
-func (a *App) startMeilisearch() error {
-	homeDir, err := os.UserHomeDir()
+	// Start MeiliSearch if not already running, unless an external server or
+	// the embedded backend is configured
+	if !backend.Embedded() && config.Current().MeilisearchURL == "" && !engine.Healthy(engine.Endpoint()) {
+		a.startMeilisearch()
+	}
+
+	// Keep indexed directories in sync while the app is running
+	watcher, err := indexer.NewWatcher()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+		fmt.Printf("Failed to start file watcher: %v\n", err)
+	} else {
+		a.watcher = watcher
+		go watcher.Run(ctx)
+		a.watchRoots()
 	}
 
-	memexDir := filepath.Join(homeDir, ".memex")
-	meilisearchBinary := filepath.Join(memexDir, "meilisearch")
+	// Re-index roots on their schedules
+	go a.runSchedule(ctx)
+}
 
-	// Check if meilisearch binary exists
-	if _, err := os.Stat(meilisearchBinary); os.IsNotExist(err) {
-		return fmt.Errorf("meilisearch binary not found at %s", meilisearchBinary)
+// watchRoots watches every registered root with its rules
+func (a *App) watchRoots() {
+	list, err := roots.List()
+	if err != nil {
+		fmt.Printf("Failed to read roots: %v\n", err)
+		return
+	}
+	for _, root := range list {
+		if err := a.watcher.Add(root.Path, root.Options(indexer.DefaultOptions())); err != nil {
+			fmt.Printf("Failed to watch %s: %v\n", root.Path, err)
+		}
 	}
+}
 
-	// Launch MeiliSearch
-	cmd := exec.Command(
-		meilisearchBinary,
-		"--db-path", filepath.Join(memexDir, "data.ms"),
-		"--http-addr", "127.0.0.1:7700",
-		"--no-analytics",
-	)
+// scheduleInterval is how often the roots are checked for a scheduled run
+const scheduleInterval = time.Minute
+
+// runSchedule re-indexes roots as their schedules fall due, one at a time,
+// until ctx is cancelled. A failed run is retried at the next due time rather
+// than every check.
+func (a *App) runSchedule(ctx context.Context) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	retryAt := make(map[string]time.Time)
+	for {
+		now := time.Now()
+		due, err := roots.Due(now)
+		if err != nil {
+			fmt.Printf("Failed to read roots: %v\n", err)
+		}
+		for _, root := range due {
+			if now.Before(retryAt[root.Path]) {
+				continue
+			}
+			interval, _ := root.Schedule.Interval()
+			retryAt[root.Path] = now.Add(interval)
 
-	// Redirect output to avoid blocking
-	cmd.Stdout = nil
-	cmd.Stderr = nil
+			if err := a.indexRoot(root); err != nil {
+				fmt.Printf("Scheduled index of %s failed: %v\n", root.Path, err)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start meilisearch: %w", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	a.meilisearchCmd = cmd
-
-	// Wait for MeiliSearch to be ready
-	for i := 0; i < 30; i++ {
-		time.Sleep(500 * time.Millisecond)
-		if a.GetMeilisearchHealth() {
-			a.meilisearchReady = true
-			fmt.Println("MeiliSearch started successfully")
-			return nil
-		}
+// startMeilisearch launches MeiliSearch under a supervisor that restarts it
+// on crash. State changes are sent to the frontend as "engine:state" events.
+func (a *App) startMeilisearch() {
+	supervisor := engine.NewSupervisor(engine.DefaultSettings())
+	supervisor.OnStateChange = func(change engine.StateChange) {
+		fmt.Printf("MeiliSearch %s %s\n", change.State, change.URL+change.Error)
+		wailsruntime.EventsEmit(a.ctx, "engine:state", change)
 	}
 
-	return fmt.Errorf("meilisearch failed to start within 15 seconds")
+	if err := supervisor.Start(); err != nil {
+		// Another memex process (usually `memex serve`) owns the server
+		fmt.Printf("Not starting MeiliSearch: %v\n", err)
+		return
+	}
+	a.meilisearch = supervisor
 }
 
 // shutdown cleans up MeiliSearch process
 func (a *App) shutdown(ctx context.Context) {
-	if a.meilisearchCmd != nil && a.meilisearchCmd.Process != nil {
-		a.meilisearchCmd.Process.Kill()
+	if a.watcher != nil {
+		a.watcher.Close()
+	}
+
+	if a.meilisearch != nil {
+		a.meilisearch.Stop()
 	}
 }
 
+// GetEngineState returns the state of the MeiliSearch server. When the server
+// is managed elsewhere it reports ready or stopped based on its health, and
+// the embedded backend reports ready with the directory of its index.
+func (a *App) GetEngineState() engine.StateChange {
+	if a.meilisearch != nil {
+		return a.meilisearch.State()
+	}
+
+	b := backend.New()
+	if b.Healthy() {
+		return engine.StateChange{State: engine.StateReady, URL: b.Location()}
+	}
+	return engine.StateChange{State: engine.StateStopped}
+}
+
 // SearchResult represents a search result for the frontend
 type SearchResult struct {
-	ID            string  `json:"id"`
-	Path          string  `json:"path"`
-	Content       string  `json:"content"`
-	Type          string  `json:"type"`
-	Title         string  `json:"title"`
-	RankingScore  float64 `json:"rankingScore"`
+	ID           string  `json:"id"`
+	Path         string  `json:"path"`
+	Content      string  `json:"content"`
+	Type         string  `json:"type"`
+	Title        string  `json:"title"`
+	Page         int     `json:"page,omitempty"`
+	RankingScore float64 `json:"rankingScore"`
+
+	// Snippet is HTML: escaped text around the best match, with matched
+	// words wrapped in <mark>
+	Snippet string `json:"snippet,omitempty"`
+
+	// Passages lists the best matching parts of a large file
+	Passages []PassageResult `json:"passages,omitempty"`
 }
 
-// SearchResponse represents the search response
+// PassageResult locates a matching passage within a file
+type PassageResult struct {
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Page      int    `json:"page,omitempty"`
+	Snippet   string `json:"snippet,omitempty"`
+}
+
+// SearchOptions selects a page of results and their order. Sort is a key
+// and optional direction, e.g. "mtime:desc"; empty sorts by relevance.
+// Facets asks for facet counts, and Selection narrows to chosen facets.
+type SearchOptions struct {
+	Limit     int                   `json:"limit"`
+	Offset    int                   `json:"offset"`
+	Page      int                   `json:"page,omitempty"`
+	Sort      string                `json:"sort,omitempty"`
+	Facets    bool                  `json:"facets,omitempty"`
+	Selection search.FacetSelection `json:"selection"`
+}
+
+// SearchResponse represents the search response. TotalFiles counts the
+// matching files on the first page, and is a lower bound unless TotalExact;
+// later pages leave it out.
 type SearchResponse struct {
 	Hits               []SearchResult `json:"hits"`
 	Query              string         `json:"query"`
+	Offset             int64          `json:"offset"`
+	Limit              int64          `json:"limit"`
+	HasMore            bool           `json:"hasMore"`
+	Facets             *search.Facets `json:"facets,omitempty"`
+	TotalFiles         *int64         `json:"totalFiles,omitempty"`
+	TotalExact         bool           `json:"totalExact"`
 	ProcessingTimeMs   int64          `json:"processingTimeMs"`
 	EstimatedTotalHits int64          `json:"estimatedTotalHits"`
 	Error              string         `json:"error,omitempty"`
 }
 
 // Search performs a search query
-func (a *App) Search(query string, limit int) SearchResponse {
+func (a *App) Search(query string, options SearchOptions) SearchResponse {
 	if query == "" {
 		return SearchResponse{
 			Hits:  []SearchResult{},
@@ -121,22 +230,43 @@ func (a *App) Search(query string, limit int) SearchResponse {
 		}
 	}
 
-	result, err := search.Search(query, int64(limit))
+	sort, err := search.ParseSort(options.Sort)
 	if err != nil {
 		return SearchResponse{
 			Query: query,
-			Error: fmt.Sprintf("Search failed: %v", err),
+			Error: err.Error(),
 		}
 	}
 
-	// Convert meilisearch results to our frontend format
-	hits := make([]SearchResult, 0, len(result.Hits))
-	for _, hit := range result.Hits {
-		// Decode the MeiliSearch Hit into our Document type, then convert to SearchResult
-		var doc types.Document
-		if err := hit.Decode(&doc); err != nil {
-			continue
+	opts := search.DefaultSearchOptions()
+	opts.Limit = int64(options.Limit)
+	opts.Offset = int64(options.Offset)
+	opts.Page = int64(options.Page)
+	opts.Sort = sort
+	opts.Facets = options.Facets
+	opts.Totals = true
+	opts.Selection = options.Selection
+	opts.HighlightPreTag, opts.HighlightPostTag = highlightStart, highlightEnd
+
+	result, err := search.Search(query, opts)
+	var queryErr *search.QueryError
+	if errors.As(err, &queryErr) {
+		return SearchResponse{
+			Query: query,
+			Error: err.Error(),
 		}
+	}
+	if err != nil {
+		return SearchResponse{
+			Query: query,
+			Error: fmt.Sprintf("Search failed: %v", err),
+		}
+	}
+
+	// Convert search results to our frontend format
+	hits := make([]SearchResult, 0, len(result.Results))
+	for _, r := range result.Results {
+		doc := r.Document
 
 		sr := SearchResult{
 			ID:           doc.ID,
@@ -144,26 +274,40 @@ func (a *App) Search(query string, limit int) SearchResponse {
 			Content:      doc.Content,
 			Type:         doc.Ext,  // File extension
 			Title:        doc.Name, // File name
-			RankingScore: 0,        // Will be populated if available
+			Page:         r.Page,
+			Snippet:      snippetHTML(r.Snippet),
+			RankingScore: r.RankingScore,
 		}
-
-		// Try to get the ranking score from the raw hit data
-		if scoreData, ok := hit["_rankingScore"]; ok {
-			var score float64
-			if err := json.Unmarshal(scoreData, &score); err == nil {
-				sr.RankingScore = score
-			}
+		if doc.Title != "" {
+			sr.Title = doc.Title
+		}
+		for _, p := range r.Passages {
+			sr.Passages = append(sr.Passages, PassageResult{
+				StartLine: p.StartLine,
+				EndLine:   p.EndLine,
+				Page:      p.Page,
+				Snippet:   snippetHTML(p.Snippet),
+			})
 		}
 
 		hits = append(hits, sr)
 	}
 
-	return SearchResponse{
+	response := SearchResponse{
 		Hits:               hits,
 		Query:              result.Query,
+		Offset:             result.Offset,
+		Limit:              result.Limit,
+		HasMore:            result.HasMore,
+		Facets:             result.Facets,
+		TotalExact:         result.TotalExact,
 		ProcessingTimeMs:   result.ProcessingTimeMs,
 		EstimatedTotalHits: result.EstimatedTotalHits,
 	}
+	if result.Counted {
+		response.TotalFiles = &result.TotalFiles
+	}
+	return response
 }
 
 // OpenFile opens a file in the default editor
@@ -192,18 +336,156 @@ func (a *App) IndexFile(path string) error {
 	return indexer.IndexFile(path)
 }
 
-// IndexDirectory indexes all files in a directory
+// IndexDirectory registers a directory as a root, unless it is one already,
+// and indexes it with the root's rules
 func (a *App) IndexDirectory(path string) error {
-	// Pass empty ignore patterns for now - could be made configurable later
-	return indexer.IndexDirectory(path, []string{})
+	root, err := roots.Get(path)
+	if errors.Is(err, roots.ErrNotFound) {
+		root, err = roots.Add(roots.Root{Path: path})
+	}
+	if err != nil {
+		return err
+	}
+	return a.indexRoot(root)
+}
+
+// ListRoots returns the registered roots
+func (a *App) ListRoots() ([]roots.Root, error) {
+	return roots.List()
+}
+
+// AddRoot registers a root, or replaces the rules of a registered one,
+// without indexing it; ReindexRoot does that
+func (a *App) AddRoot(root roots.Root) (roots.Root, error) {
+	return roots.Add(root)
+}
+
+// RemoveRoot stops watching a root, unregisters it and removes its files
+// from the index, returning how many were removed
+func (a *App) RemoveRoot(path string) (int, error) {
+	root, err := roots.Get(path)
+	if err != nil {
+		return 0, err
+	}
+	if a.watcher != nil {
+		if err := a.watcher.Remove(root.Path); err != nil {
+			fmt.Printf("Failed to stop watching %s: %v\n", root.Path, err)
+		}
+	}
+	return roots.Remove(root.Path)
+}
+
+// ReindexRoot indexes a registered root again with its rules
+func (a *App) ReindexRoot(path string) error {
+	root, err := roots.Get(path)
+	if err != nil {
+		return err
+	}
+	return a.indexRoot(root)
+}
+
+// indexRoot indexes a root and watches it for changes. Progress is sent to
+// the frontend as "index:progress" events, and CancelIndexing stops the run.
+// Only one root is indexed at a time.
+func (a *App) indexRoot(root roots.Root) error {
+	ctx, cancel := context.WithCancel(a.ctx)
+	defer cancel()
+
+	a.indexMu.Lock()
+	if a.cancelIndex != nil {
+		a.indexMu.Unlock()
+		return errors.New("a directory is already being indexed")
+	}
+	a.cancelIndex = cancel
+	a.indexMu.Unlock()
+
+	defer func() {
+		a.indexMu.Lock()
+		a.cancelIndex = nil
+		a.indexMu.Unlock()
+	}()
+
+	nested, err := roots.Nested(root.Path)
+	if err != nil {
+		return err
+	}
+	opts := root.Options(indexer.DefaultOptions())
+	opts.Keep = nested
+	opts.Progress = a.emitProgress()
+	_, err = indexer.IndexDirectory(ctx, root.Path, opts)
+	if errors.Is(err, context.Canceled) {
+		return errors.New("indexing cancelled")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Pick up later changes to the directory without a manual re-index
+	if a.watcher != nil {
+		return a.watcher.Add(root.Path, root.Options(indexer.DefaultOptions()))
+	}
+	return nil
+}
+
+// CancelIndexing stops the running IndexDirectory call, reporting whether
+// there was one. Uploads already started still finish.
+func (a *App) CancelIndexing() bool {
+	a.indexMu.Lock()
+	defer a.indexMu.Unlock()
+
+	if a.cancelIndex == nil {
+		return false
+	}
+	a.cancelIndex()
+	return true
+}
+
+// progressInterval is the shortest time between per-file progress events,
+// so large directories don't flood the frontend
+const progressInterval = 100 * time.Millisecond
+
+// emitProgress returns a progress callback that forwards events to the
+// frontend. Per-file events are throttled; uploads, unreadable files and the
+// final event are always sent.
+func (a *App) emitProgress() func(indexer.Progress) {
+	var last time.Time
+	return func(p indexer.Progress) {
+		switch {
+		case p.Kind == indexer.ProgressUploaded, p.Kind == indexer.ProgressDone,
+			p.Reason == indexer.SkipUnreadable:
+		case time.Since(last) < progressInterval:
+			return
+		}
+		last = time.Now()
+		wailsruntime.EventsEmit(a.ctx, "index:progress", p)
+	}
 }
 
-// GetMeilisearchHealth checks if MeiliSearch is running
+// GetMeilisearchHealth checks if the search backend is reachable and the
+// index exists
 func (a *App) GetMeilisearchHealth() bool {
-	c := client.New()
-	index := c.GetIndex()
+	stats, err := backend.New().Stats()
+	return err == nil && stats.Exists
+}
+
+// GetStatus reports the engine version and address, what is in the index,
+// when it was last indexed, failed tasks and out-of-date settings
+func (a *App) GetStatus() (*status.Status, error) {
+	return status.Get()
+}
+
+// Private-use characters that mark matches in snippets, chosen because they
+// do not occur in ordinary text and survive HTML escaping
+const (
+	highlightStart = "\ue000"
+	highlightEnd   = "\ue001"
+)
 
-	// Try to get index stats as a health check
-	_, err := index.GetStats()
-	return err == nil
+// snippetHTML escapes a snippet for display and turns the match markers into
+// <mark> elements
+func snippetHTML(snippet string) string {
+	return strings.NewReplacer(
+		highlightStart, "<mark>",
+		highlightEnd, "</mark>",
+	).Replace(html.EscapeString(snippet))
 }
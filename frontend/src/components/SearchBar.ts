@@ -1,23 +1,35 @@
 import { SearchService } from '../services/search';
-import type { SearchResult } from '../types/search';
+import type { EngineStatus, Facets, FacetSelection, FacetValue, SearchResult } from '../types/search';
 import { WindowHide } from '../wailsjs/runtime/runtime';
 
 export class SearchBar {
   private container: HTMLElement;
   private searchInput: HTMLInputElement;
   private resultsContainer: HTMLElement;
+  private facetsContainer: HTMLElement;
+  private countContainer: HTMLElement;
   private searchService: SearchService;
   private selectedIndex: number = 0;
   private results: SearchResult[] = [];
   private searchTimeout?: number;
+  private query: string = '';
+  private hasMore: boolean = false;
+  private loadingMore: boolean = false;
+  private facets?: Facets;
+  private totalFiles?: number;
+  private totalExact: boolean = false;
+  private selection: Required<FacetSelection> = { extensions: [], directories: [], modified: [] };
 
   constructor() {
     this.searchService = new SearchService();
     this.container = this.createSearchBar();
     this.searchInput = this.container.querySelector('#search-input') as HTMLInputElement;
     this.resultsContainer = this.container.querySelector('#search-results') as HTMLElement;
+    this.facetsContainer = this.container.querySelector('#search-facets') as HTMLElement;
+    this.countContainer = this.container.querySelector('#search-count') as HTMLElement;
 
     this.setupEventListeners();
+    this.watchEngineStatus();
     document.body.appendChild(this.container);
 
     // Focus input immediately
@@ -102,6 +114,12 @@ export class SearchBar {
         max-height: 400px;
         overflow-y: auto;
       ">
+        <div id="search-count" style="
+          padding: 8px 16px 0;
+          font-size: 11px;
+          color: #9ca3af;
+        "></div>
+        <div id="search-facets"></div>
         <div id="search-results"></div>
       </div>
     `;
@@ -117,6 +135,14 @@ export class SearchBar {
 
     this.searchInput.addEventListener('keydown', (e) => this.handleKeyDown(e));
 
+    // Fetch the next page as the user nears the end of the results
+    const wrapper = this.container.querySelector('#search-results-wrapper') as HTMLElement;
+    wrapper.addEventListener('scroll', () => {
+      if (wrapper.scrollTop + wrapper.clientHeight >= wrapper.scrollHeight - 80) {
+        this.loadMore();
+      }
+    });
+
     // Close button - hide window instead of quit
     const closeBtn = this.container.querySelector('#close-btn');
     closeBtn?.addEventListener('click', () => {
@@ -129,6 +155,27 @@ export class SearchBar {
     });
   }
 
+  private async watchEngineStatus(): Promise<void> {
+    this.searchService.onEngineStatus((status) => this.showEngineStatus(status));
+    try {
+      this.showEngineStatus(await this.searchService.getEngineStatus());
+    } catch (error) {
+      console.error('Engine status error:', error);
+    }
+  }
+
+  private showEngineStatus(status: EngineStatus): void {
+    const placeholders: Record<string, string> = {
+      starting: 'Starting search engine...',
+      crashed: 'Search engine stopped unexpectedly, restarting...',
+      stopped: 'Search engine is not running',
+    };
+    this.searchInput.placeholder = placeholders[status.state] || 'Search files...';
+    if (status.error) {
+      console.error('Search engine:', status.error);
+    }
+  }
+
   private handleKeyDown(e: KeyboardEvent): void {
     switch (e.key) {
       case 'ArrowDown':
@@ -154,37 +201,155 @@ export class SearchBar {
     const query = this.searchInput.value.trim();
     const wrapper = this.container.querySelector('#search-results-wrapper') as HTMLElement;
 
+    this.query = query;
     if (!query) {
       wrapper.style.display = 'none';
       this.results = [];
+      this.hasMore = false;
       return;
     }
 
     try {
-      const response = await this.searchService.search(query);
+      const response = await this.searchService.search(query, { facets: true, selection: this.selection });
+      if (query !== this.query) {
+        return; // Superseded by a newer query
+      }
       this.results = response.hits;
+      this.hasMore = response.hasMore;
+      this.facets = response.facets;
+      this.totalFiles = response.totalFiles;
+      this.totalExact = response.totalExact;
       this.selectedIndex = 0;
+      wrapper.scrollTop = 0;
+      this.renderFacets();
       this.renderResults();
     } catch (error) {
       console.error('Search error:', error);
+      const message = error instanceof Error ? error.message : 'Check if MeiliSearch is running.';
       this.resultsContainer.innerHTML = `
         <div style="padding: 20px; text-align: center; color: #ef4444;">
-          Search error. Check if MeiliSearch is running.
+          ${this.escapeHTML(message)}
         </div>
       `;
       wrapper.style.display = 'block';
     }
   }
 
+  private async loadMore(): Promise<void> {
+    if (!this.hasMore || this.loadingMore) {
+      return;
+    }
+
+    const query = this.query;
+    this.loadingMore = true;
+    try {
+      const response = await this.searchService.search(query, {
+        offset: this.results.length,
+        selection: this.selection,
+      });
+      if (query !== this.query) {
+        return;
+      }
+      this.results = this.results.concat(response.hits);
+      this.hasMore = response.hasMore;
+      this.renderResults();
+    } catch (error) {
+      console.error('Search error:', error);
+      this.hasMore = false;
+    } finally {
+      this.loadingMore = false;
+    }
+  }
+
+  private escapeHTML(text: string): string {
+    return text
+      .replace(/&/g, '&amp;')
+      .replace(/</g, '&lt;')
+      .replace(/>/g, '&gt;')
+      .replace(/"/g, '&quot;')
+      .replace(/'/g, '&#39;');
+  }
+
+  private toggleFacet(facet: keyof FacetSelection, value: string): void {
+    const values = this.selection[facet];
+    const i = values.indexOf(value);
+    if (i >= 0) {
+      values.splice(i, 1);
+    } else {
+      values.push(value);
+    }
+    this.performSearch();
+  }
+
+  // renderCount shows how many files match, counted on the first page like
+  // the CLI does
+  private renderCount(): void {
+    const total = this.totalFiles;
+    if (total === undefined) {
+      this.countContainer.textContent = '';
+      return;
+    }
+    const results = total === 1 ? 'result' : 'results';
+    this.countContainer.textContent = this.totalExact ? `${total} ${results}` : `At least ${total} ${results}`;
+  }
+
+  private renderFacets(): void {
+    const groups: [keyof FacetSelection, FacetValue[], (v: FacetValue) => string][] = [
+      ['extensions', this.facets?.extensions || [], v => v.value.replace(/^\./, '')],
+      ['directories', this.facets?.directories || [], v => v.value.split('/').pop() || v.value],
+      ['modified', (this.facets?.modified || []).filter(v => v.count > 0), v => v.label || v.value],
+    ];
+
+    const chips = groups.flatMap(([facet, values, label]) => {
+      // Keep selected values visible so they can be cleared
+      const shown = [...values];
+      for (const value of this.selection[facet]) {
+        if (!shown.some(v => v.value === value)) {
+          shown.push({ value, count: 0 });
+        }
+      }
+      return shown.map(v => {
+        const selected = this.selection[facet].includes(v.value);
+        return `
+          <button class="search-facet" data-facet="${facet}" data-value="${this.escapeHTML(v.value)}" title="${this.escapeHTML(v.value)}" style="
+            border: 1px solid ${selected ? '#3b82f6' : 'rgba(0, 0, 0, 0.1)'};
+            background: ${selected ? 'rgba(59, 130, 246, 0.1)' : 'transparent'};
+            color: #374151;
+            border-radius: 10px;
+            padding: 1px 8px;
+            font-size: 11px;
+            cursor: pointer;
+            white-space: nowrap;
+          ">${this.escapeHTML(label(v))} <span style="color: #9ca3af;">${v.count}</span></button>
+        `;
+      });
+    });
+
+    this.facetsContainer.style.cssText = chips.length
+      ? 'display: flex; flex-wrap: wrap; gap: 4px; padding: 8px 16px; border-bottom: 1px solid rgba(229, 231, 235, 0.5);'
+      : 'display: none;';
+    this.facetsContainer.innerHTML = chips.join('');
+
+    this.facetsContainer.querySelectorAll<HTMLElement>('.search-facet').forEach(chip => {
+      chip.addEventListener('click', () => {
+        this.toggleFacet(chip.dataset.facet as keyof FacetSelection, chip.dataset.value || '');
+        this.searchInput.focus();
+      });
+    });
+  }
+
   private renderResults(): void {
     const wrapper = this.container.querySelector('#search-results-wrapper') as HTMLElement;
 
-    if (this.results.length === 0) {
+    // Stay open while facets are selected, so an empty selection can be undone
+    const selecting = Object.values(this.selection).some(values => values.length > 0);
+    if (this.results.length === 0 && !selecting) {
       wrapper.style.display = 'none';
       return;
     }
 
     wrapper.style.display = 'block';
+    this.renderCount();
     this.resultsContainer.innerHTML = this.results
       .map((result, index) => this.renderResultItem(result, index))
       .join('');
@@ -201,7 +366,11 @@ export class SearchBar {
     const isSelected = index === this.selectedIndex;
     const fileType = this.getFileType(result.path);
     const fileName = result.path.split('/').pop() || result.path;
-    const filePath = result.path;
+    const filePath = [
+      result.path,
+      result.page ? `page ${result.page}` : '',
+      ...(result.passages || []).map(p => `lines ${p.startLine}–${p.endLine}`),
+    ].filter(Boolean).join(' · ');
 
     return `
       <div class="search-result-item" data-index="${index}" style="
@@ -247,6 +416,18 @@ export class SearchBar {
             ">
               ${filePath}
             </div>
+            ${result.snippet ? `
+            <div class="search-result-snippet" style="
+              margin-top: 2px;
+              font-size: 12px;
+              color: #374151;
+              display: -webkit-box;
+              -webkit-line-clamp: 2;
+              -webkit-box-orient: vertical;
+              overflow: hidden;
+            ">
+              ${result.snippet}
+            </div>` : ''}
           </div>
         </div>
       </div>
@@ -281,6 +462,9 @@ export class SearchBar {
     this.selectedIndex = (this.selectedIndex + 1) % this.results.length;
     this.renderResults();
     this.scrollToSelected();
+    if (this.selectedIndex >= this.results.length - 3) {
+      this.loadMore();
+    }
   }
 
   private selectPrevious(): void {
@@ -1,9 +1,17 @@
-import { Search, GetMeilisearchHealth, OpenFile, IndexFile, IndexDirectory } from '../wailsjs/go/main/App';
-import type { SearchResponse } from '../types/search';
+import { Search, GetMeilisearchHealth, GetStatus, GetEngineState, OpenFile, IndexFile, IndexDirectory, CancelIndexing, ListRoots, AddRoot, RemoveRoot, ReindexRoot } from '../wailsjs/go/main/App';
+import { EventsOn } from '../wailsjs/runtime/runtime';
+import { main, roots, status } from '../wailsjs/go/models';
+import type { EngineStatus, IndexProgress, SearchOptions, SearchResponse } from '../types/search';
 
 export class SearchService {
-  async search(query: string, limit: number = 20): Promise<SearchResponse> {
-    const response = await Search(query, limit);
+  async search(query: string, options: SearchOptions = {}): Promise<SearchResponse> {
+    const response = await Search(query, main.SearchOptions.createFrom({
+      limit: options.limit ?? 20,
+      offset: options.offset ?? 0,
+      sort: options.sort,
+      facets: options.facets,
+      selection: options.selection ?? {},
+    }));
 
     if (response.error) {
       throw new Error(response.error);
@@ -16,12 +24,19 @@ export class SearchService {
         content: hit.content,
         type: hit.type,
         title: hit.title,
+        page: hit.page,
+        snippet: hit.snippet,
+        passages: hit.passages?.map(p => ({ startLine: p.startLine, endLine: p.endLine, page: p.page, snippet: p.snippet })),
         _rankingScore: hit.rankingScore,
       })),
       query: response.query,
       processingTimeMs: response.processingTimeMs,
-      limit: limit,
-      offset: 0,
+      limit: response.limit,
+      offset: response.offset,
+      hasMore: response.hasMore,
+      facets: response.facets,
+      totalFiles: response.totalFiles,
+      totalExact: response.totalExact,
       estimatedTotalHits: response.estimatedTotalHits,
     };
   }
@@ -34,6 +49,18 @@ export class SearchService {
     }
   }
 
+  async getStatus(): Promise<status.Status> {
+    return GetStatus();
+  }
+
+  async getEngineStatus(): Promise<EngineStatus> {
+    return (await GetEngineState()) as EngineStatus;
+  }
+
+  onEngineStatus(callback: (status: EngineStatus) => void): void {
+    EventsOn('engine:state', callback);
+  }
+
   async openFile(path: string): Promise<void> {
     return OpenFile(path);
   }
@@ -45,4 +72,33 @@ export class SearchService {
   async indexDirectory(path: string): Promise<void> {
     return IndexDirectory(path);
   }
+
+  // cancelIndexing stops the running indexDirectory call, resolving to
+  // false if nothing was being indexed
+  async cancelIndexing(): Promise<boolean> {
+    return CancelIndexing();
+  }
+
+  async listRoots(): Promise<roots.Root[]> {
+    return (await ListRoots()) ?? [];
+  }
+
+  // addRoot registers a root, or replaces a registered root's rules, without
+  // indexing it; call reindexRoot for that
+  async addRoot(root: Partial<roots.Root> & { path: string }): Promise<roots.Root> {
+    return AddRoot(roots.Root.createFrom(root));
+  }
+
+  // removeRoot resolves to the number of files removed from the index
+  async removeRoot(path: string): Promise<number> {
+    return RemoveRoot(path);
+  }
+
+  async reindexRoot(path: string): Promise<void> {
+    return ReindexRoot(path);
+  }
+
+  onIndexProgress(callback: (progress: IndexProgress) => void): void {
+    EventsOn('index:progress', callback);
+  }
 }
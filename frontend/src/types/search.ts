@@ -4,14 +4,95 @@ export interface SearchResult {
   content: string;
   type: string;
   title?: string;
+  page?: number;
+  /** HTML: escaped text around the best match, matches wrapped in <mark> */
+  snippet?: string;
+  passages?: Passage[];
   _rankingScore?: number;
 }
 
+export interface Passage {
+  startLine: number;
+  endLine: number;
+  page?: number;
+  snippet?: string;
+}
+
+export interface SearchOptions {
+  limit?: number;
+  offset?: number;
+  /** A sort key and optional direction, e.g. "mtime:desc"; relevance if unset */
+  sort?: string;
+  /** Request facet counts along with the results */
+  facets?: boolean;
+  selection?: FacetSelection;
+}
+
+export interface FacetValue {
+  value: string;
+  label?: string;
+  count: number;
+}
+
+export interface Facets {
+  extensions: FacetValue[];
+  directories: FacetValue[];
+  modified: FacetValue[];
+}
+
+/** Facet values to narrow results to; values of one facet are ORed */
+export interface FacetSelection {
+  extensions?: string[];
+  directories?: string[];
+  modified?: string[];
+}
+
 export interface SearchResponse {
   hits: SearchResult[];
   query: string;
   processingTimeMs: number;
   limit: number;
   offset: number;
+  hasMore: boolean;
+  facets?: Facets;
+  /** Matching files, on the first page only; a lower bound unless totalExact */
+  totalFiles?: number;
+  totalExact: boolean;
   estimatedTotalHits: number;
 }
+
+export type EngineState = 'starting' | 'ready' | 'crashed' | 'stopped';
+
+export interface EngineStatus {
+  state: EngineState;
+  url?: string;
+  error?: string;
+}
+
+export type IndexProgressKind = 'discovered' | 'extracted' | 'skipped' | 'uploaded' | 'done';
+
+export type SkipReason = 'ignored' | 'unchanged' | 'unreadable';
+
+export interface IndexStats {
+  added: number;
+  updated: number;
+  unchanged: number;
+  removed: number;
+  errors: { path: string; error: string }[] | null;
+}
+
+// An "index:progress" event; the counts are running totals for the run
+export interface IndexProgress {
+  kind: IndexProgressKind;
+  root: string;
+  path?: string;
+  reason?: SkipReason;
+  error?: string;
+  documents?: number;
+  discovered: number;
+  processed: number;
+  walked: boolean;
+  uploaded: number;
+  elapsed_ns: number;
+  stats?: IndexStats;
+}
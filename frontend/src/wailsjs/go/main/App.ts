@@ -2,12 +2,31 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+import {engine} from '../models';
 import {main} from '../models';
+import {roots} from '../models';
+import {status} from '../models';
+
+export function AddRoot(arg1: roots.Root): Promise<roots.Root> {
+  return window['go']['main']['App']['AddRoot'](arg1);
+}
+
+export function CancelIndexing(): Promise<boolean> {
+  return window['go']['main']['App']['CancelIndexing']();
+}
+
+export function GetEngineState(): Promise<engine.StateChange> {
+  return window['go']['main']['App']['GetEngineState']();
+}
 
 export function GetMeilisearchHealth(): Promise<boolean> {
   return window['go']['main']['App']['GetMeilisearchHealth']();
 }
 
+export function GetStatus(): Promise<status.Status> {
+  return window['go']['main']['App']['GetStatus']();
+}
+
 export function IndexDirectory(arg1: string): Promise<void> {
   return window['go']['main']['App']['IndexDirectory'](arg1);
 }
@@ -16,10 +35,22 @@ export function IndexFile(arg1: string): Promise<void> {
   return window['go']['main']['App']['IndexFile'](arg1);
 }
 
+export function ListRoots(): Promise<Array<roots.Root>> {
+  return window['go']['main']['App']['ListRoots']();
+}
+
 export function OpenFile(arg1: string): Promise<void> {
   return window['go']['main']['App']['OpenFile'](arg1);
 }
 
-export function Search(arg1: string, arg2: number): Promise<main.SearchResponse> {
+export function ReindexRoot(arg1: string): Promise<void> {
+  return window['go']['main']['App']['ReindexRoot'](arg1);
+}
+
+export function RemoveRoot(arg1: string): Promise<number> {
+  return window['go']['main']['App']['RemoveRoot'](arg1);
+}
+
+export function Search(arg1: string, arg2: main.SearchOptions): Promise<main.SearchResponse> {
   return window['go']['main']['App']['Search'](arg1, arg2);
 }
@@ -1,12 +1,143 @@
+export namespace engine {
+
+	export class StateChange {
+	    state: string;
+	    url?: string;
+	    error?: string;
+
+	    static createFrom(source: any = {}) {
+	        return new StateChange(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.state = source["state"];
+	        this.url = source["url"];
+	        this.error = source["error"];
+	    }
+	}
+
+}
+
+export namespace indexer {
+
+	export class Run {
+	    root: string;
+	    started_at: any;
+	    finished_at: any;
+	    added: number;
+	    updated: number;
+	    unchanged: number;
+	    removed: number;
+	    errors: number;
+
+	    static createFrom(source: any = {}) {
+	        return new Run(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.root = source["root"];
+	        this.started_at = this.convertValues(source["started_at"], null);
+	        this.finished_at = this.convertValues(source["finished_at"], null);
+	        this.added = source["added"];
+	        this.updated = source["updated"];
+	        this.unchanged = source["unchanged"];
+	        this.removed = source["removed"];
+	        this.errors = source["errors"];
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
 export namespace main {
 
+	export class PassageResult {
+	    startLine: number;
+	    endLine: number;
+	    page?: number;
+	    snippet?: string;
+
+	    static createFrom(source: any = {}) {
+	        return new PassageResult(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.startLine = source["startLine"];
+	        this.endLine = source["endLine"];
+	        this.page = source["page"];
+	        this.snippet = source["snippet"];
+	    }
+	}
+	export class SearchOptions {
+	    limit: number;
+	    offset: number;
+	    page?: number;
+	    sort?: string;
+	    facets?: boolean;
+	    selection: search.FacetSelection;
+
+	    static createFrom(source: any = {}) {
+	        return new SearchOptions(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.limit = source["limit"];
+	        this.offset = source["offset"];
+	        this.page = source["page"];
+	        this.sort = source["sort"];
+	        this.facets = source["facets"];
+	        this.selection = this.convertValues(source["selection"], search.FacetSelection);
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class SearchResult {
 	    id: string;
 	    path: string;
 	    content: string;
 	    type: string;
 	    title: string;
+	    page?: number;
 	    rankingScore: number;
+	    snippet?: string;
+	    passages?: PassageResult[];
 
 	    static createFrom(source: any = {}) {
 	        return new SearchResult(source);
@@ -19,12 +150,39 @@ export namespace main {
 	        this.content = source["content"];
 	        this.type = source["type"];
 	        this.title = source["title"];
+	        this.page = source["page"];
 	        this.rankingScore = source["rankingScore"];
+	        this.snippet = source["snippet"];
+	        this.passages = this.convertValues(source["passages"], PassageResult);
 	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class SearchResponse {
 	    hits: SearchResult[];
 	    query: string;
+	    offset: number;
+	    limit: number;
+	    hasMore: boolean;
+	    facets?: search.Facets;
+	    totalFiles?: number;
+	    totalExact: boolean;
 	    processingTimeMs: number;
 	    estimatedTotalHits: number;
 	    error?: string;
@@ -37,6 +195,12 @@ export namespace main {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.hits = this.convertValues(source["hits"], SearchResult);
 	        this.query = source["query"];
+	        this.offset = source["offset"];
+	        this.limit = source["limit"];
+	        this.hasMore = source["hasMore"];
+	        this.facets = this.convertValues(source["facets"], search.Facets);
+	        this.totalFiles = source["totalFiles"];
+	        this.totalExact = source["totalExact"];
 	        this.processingTimeMs = source["processingTimeMs"];
 	        this.estimatedTotalHits = source["estimatedTotalHits"];
 	        this.error = source["error"];
@@ -63,3 +227,262 @@ export namespace main {
 
 }
 
+export namespace roots {
+
+	export class Root {
+	    path: string;
+	    ignore?: string[];
+	    extensions?: string[];
+	    exclude_extensions?: string[];
+	    max_depth?: number;
+	    schedule?: string;
+	    added_at: any;
+
+	    static createFrom(source: any = {}) {
+	        return new Root(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.ignore = source["ignore"];
+	        this.extensions = source["extensions"];
+	        this.exclude_extensions = source["exclude_extensions"];
+	        this.max_depth = source["max_depth"];
+	        this.schedule = source["schedule"];
+	        this.added_at = this.convertValues(source["added_at"], null);
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace search {
+
+	export class FacetSelection {
+	    extensions?: string[];
+	    directories?: string[];
+	    modified?: string[];
+
+	    static createFrom(source: any = {}) {
+	        return new FacetSelection(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.extensions = source["extensions"];
+	        this.directories = source["directories"];
+	        this.modified = source["modified"];
+	    }
+	}
+	export class FacetValue {
+	    value: string;
+	    label?: string;
+	    count: number;
+
+	    static createFrom(source: any = {}) {
+	        return new FacetValue(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.value = source["value"];
+	        this.label = source["label"];
+	        this.count = source["count"];
+	    }
+	}
+	export class Facets {
+	    extensions: FacetValue[];
+	    directories: FacetValue[];
+	    modified: FacetValue[];
+
+	    static createFrom(source: any = {}) {
+	        return new Facets(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.extensions = this.convertValues(source["extensions"], FacetValue);
+	        this.directories = this.convertValues(source["directories"], FacetValue);
+	        this.modified = this.convertValues(source["modified"], FacetValue);
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace status {
+
+	export class Root {
+	    path: string;
+	    files: number;
+	    last_run?: indexer.Run;
+
+	    static createFrom(source: any = {}) {
+	        return new Root(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.files = source["files"];
+	        this.last_run = this.convertValues(source["last_run"], indexer.Run);
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Status {
+	    backend: string;
+	    url: string;
+	    healthy: boolean;
+	    version?: string;
+	    index: string;
+	    index_exists: boolean;
+	    is_indexing: boolean;
+	    documents: number;
+	    files: number;
+	    database_size: number;
+	    documents_size: number;
+	    field_distribution: Record<string, number>;
+	    extensions: search.FacetValue[];
+	    roots: Root[];
+	    last_indexed?: any;
+	    pending_tasks: number;
+	    failed_tasks: number;
+	    recent_failures: Task[];
+	    settings_problems: string[];
+
+	    static createFrom(source: any = {}) {
+	        return new Status(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.backend = source["backend"];
+	        this.url = source["url"];
+	        this.healthy = source["healthy"];
+	        this.version = source["version"];
+	        this.index = source["index"];
+	        this.index_exists = source["index_exists"];
+	        this.is_indexing = source["is_indexing"];
+	        this.documents = source["documents"];
+	        this.files = source["files"];
+	        this.database_size = source["database_size"];
+	        this.documents_size = source["documents_size"];
+	        this.field_distribution = source["field_distribution"];
+	        this.extensions = this.convertValues(source["extensions"], search.FacetValue);
+	        this.roots = this.convertValues(source["roots"], Root);
+	        this.last_indexed = this.convertValues(source["last_indexed"], null);
+	        this.pending_tasks = source["pending_tasks"];
+	        this.failed_tasks = source["failed_tasks"];
+	        this.recent_failures = this.convertValues(source["recent_failures"], Task);
+	        this.settings_problems = source["settings_problems"];
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Task {
+	    uid: number;
+	    type: string;
+	    error: string;
+	    finished_at: any;
+
+	    static createFrom(source: any = {}) {
+	        return new Task(source);
+	    }
+
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.uid = source["uid"];
+	        this.type = source["type"];
+	        this.error = source["error"];
+	        this.finished_at = this.convertValues(source["finished_at"], null);
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
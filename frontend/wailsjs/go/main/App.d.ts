@@ -1,13 +1,30 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {engine} from '../models';
 import {main} from '../models';
+import {roots} from '../models';
+import {status} from '../models';
+
+export function AddRoot(arg1:roots.Root):Promise<roots.Root>;
+
+export function CancelIndexing():Promise<boolean>;
+
+export function GetEngineState():Promise<engine.StateChange>;
 
 export function GetMeilisearchHealth():Promise<boolean>;
 
+export function GetStatus():Promise<status.Status>;
+
 export function IndexDirectory(arg1:string):Promise<void>;
 
 export function IndexFile(arg1:string):Promise<void>;
 
+export function ListRoots():Promise<Array<roots.Root>>;
+
 export function OpenFile(arg1:string):Promise<void>;
 
-export function Search(arg1:string,arg2:number):Promise<main.SearchResponse>;
+export function ReindexRoot(arg1:string):Promise<void>;
+
+export function RemoveRoot(arg1:string):Promise<number>;
+
+export function Search(arg1:string,arg2:main.SearchOptions):Promise<main.SearchResponse>;
@@ -2,10 +2,26 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddRoot(arg1) {
+  return window['go']['main']['App']['AddRoot'](arg1);
+}
+
+export function CancelIndexing() {
+  return window['go']['main']['App']['CancelIndexing']();
+}
+
+export function GetEngineState() {
+  return window['go']['main']['App']['GetEngineState']();
+}
+
 export function GetMeilisearchHealth() {
   return window['go']['main']['App']['GetMeilisearchHealth']();
 }
 
+export function GetStatus() {
+  return window['go']['main']['App']['GetStatus']();
+}
+
 export function IndexDirectory(arg1) {
   return window['go']['main']['App']['IndexDirectory'](arg1);
 }
@@ -14,10 +30,22 @@ export function IndexFile(arg1) {
   return window['go']['main']['App']['IndexFile'](arg1);
 }
 
+export function ListRoots() {
+  return window['go']['main']['App']['ListRoots']();
+}
+
 export function OpenFile(arg1) {
   return window['go']['main']['App']['OpenFile'](arg1);
 }
 
+export function ReindexRoot(arg1) {
+  return window['go']['main']['App']['ReindexRoot'](arg1);
+}
+
+export function RemoveRoot(arg1) {
+  return window['go']['main']['App']['RemoveRoot'](arg1);
+}
+
 export function Search(arg1, arg2) {
   return window['go']['main']['App']['Search'](arg1, arg2);
 }
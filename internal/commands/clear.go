@@ -3,32 +3,44 @@ package commands
 import (
 	"fmt"
 
-	"github.com/sahil485/memex/pkg/client"
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/spf13/cobra"
 )
 
-func ClearIndex(args []string) error {
-	c := client.New()
-	idx := c.GetIndex()
+func newClearIndexCommand(g *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear-index",
+		Short: "Delete every document from the index",
+		Long:  `Delete every document from the index, keeping the index and its settings.`,
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV); err != nil {
+				return err
+			}
+			return runClearIndex(g)
+		},
+	}
+}
 
-	fmt.Println("Clearing all documents from index...")
+func runClearIndex(g *globalFlags) error {
+	g.printf("Clearing all documents from index...\n")
 
 	// Delete all documents from the index
-	task, err := idx.DeleteAllDocuments(nil)
-	if err != nil {
+	if err := backend.New().DeleteAllDocuments(); err != nil {
 		return fmt.Errorf("failed to clear index: %w", err)
 	}
 
-	// Wait for the deletion to complete
-	taskInfo, err := c.WaitForTask(task.TaskUID)
-	if err != nil {
-		return fmt.Errorf("failed to wait for deletion task: %w", err)
+	if g.structured() {
+		index := config.Current().IndexName
+		p := g.printer()
+		if g.format == formatTSV {
+			p.row(index)
+		} else if err := p.json(map[string]any{"index": index, "cleared": true}); err != nil {
+			return err
+		}
+		return p.flush()
 	}
-
-	// Check if the task failed
-	if taskInfo.Status == "failed" {
-		return fmt.Errorf("deletion task failed: %s", taskInfo.Error.Message)
-	}
-
 	fmt.Println("✓ Index cleared successfully")
 	return nil
 }
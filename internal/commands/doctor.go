@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/sahil485/memex/pkg/doctor"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCommand(g *globalFlags) *cobra.Command {
+	var fix bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the configuration, Meilisearch and the index for problems",
+		Long: `Check the configuration, the Meilisearch binary and version, whether the
+server answers, free disk space, the index and its settings, failed tasks
+and indexed files that no longer exist, suggesting a fix for each problem.
+
+With --fix, doctor creates a missing index, reapplies its settings, removes
+a stale endpoint file, makes the binary executable and removes deleted
+files from the index. Exits with status 1 if any check fails.`,
+		Annotations: map[string]string{configOptional: "true"},
+		Args:        usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV); err != nil {
+				return err
+			}
+			return runDoctor(g, fix)
+		},
+	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "repair the problems that can be repaired safely")
+	return cmd
+}
+
+// doctorSymbols mark each outcome in text output
+var doctorSymbols = map[doctor.Outcome]string{
+	doctor.Pass:  "✓",
+	doctor.Warn:  "!",
+	doctor.Fail:  "✗",
+	doctor.Fixed: "✓",
+	doctor.Skip:  "-",
+}
+
+func runDoctor(g *globalFlags, fix bool) error {
+	results := doctor.Run(doctor.Options{
+		Fix:        fix,
+		ConfigPath: g.configPathOrDefault(),
+		ConfigErr:  g.configErr,
+	})
+
+	if g.structured() {
+		p := g.printer()
+		if g.format == formatJSON {
+			if err := p.json(results); err != nil {
+				return err
+			}
+		}
+		for _, r := range results {
+			switch g.format {
+			case formatNDJSON:
+				if err := p.json(r); err != nil {
+					return err
+				}
+			case formatTSV:
+				p.row(r.Name, string(r.Outcome), r.Message, r.Fix)
+			}
+		}
+		if err := p.flush(); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			if r.Outcome == doctor.Fixed {
+				fmt.Printf("%s %s: fixed: %s\n", doctorSymbols[r.Outcome], r.Name, r.Message)
+			} else {
+				fmt.Printf("%s %s: %s\n", doctorSymbols[r.Outcome], r.Name, r.Message)
+			}
+			if r.Fix != "" {
+				fmt.Printf("    Fix: %s\n", r.Fix)
+			}
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Outcome == doctor.Fail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
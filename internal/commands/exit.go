@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"errors"
+	"net"
+
+	meilisearch "github.com/meilisearch/meilisearch-go"
+	"github.com/sahil485/memex/pkg/search"
+)
+
+// Exit codes, so scripts can tell classes of failure apart
+const (
+	ExitOK          = 0
+	ExitFailure     = 1 // any failure not covered below
+	ExitUsage       = 2 // unknown command, bad flag or argument, invalid query
+	ExitConfig      = 3 // the configuration file or environment is invalid
+	ExitUnavailable = 4 // Meilisearch could not be reached
+	ExitPartial     = 5 // indexing finished but some files were skipped
+)
+
+// exitError attaches an exit code to an error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageError(err error) error {
+	return &exitError{code: ExitUsage, err: err}
+}
+
+// ExitCode returns the exit code for the outcome err
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var exit *exitError
+	if errors.As(err, &exit) {
+		return exit.code
+	}
+
+	var queryErr *search.QueryError
+	if errors.As(err, &queryErr) {
+		return ExitUsage
+	}
+	if unavailable(err) {
+		return ExitUnavailable
+	}
+	return ExitFailure
+}
+
+// unavailable reports whether err means Meilisearch did not answer, as
+// opposed to answering with an error
+func unavailable(err error) bool {
+	var meiliErr *meilisearch.Error
+	if errors.As(err, &meiliErr) {
+		switch meiliErr.ErrCode {
+		case meilisearch.MeilisearchCommunicationError,
+			meilisearch.MeilisearchTimeoutError,
+			meilisearch.MeilisearchMaxRetriesExceeded:
+			return true
+		}
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
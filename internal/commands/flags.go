@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sahil485/memex/pkg/indexer"
+	"github.com/sahil485/memex/pkg/search"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// indexFlags are the flags shared by index and watch. Limits left at zero
+// keep their configured values.
+type indexFlags struct {
+	ignore      []string
+	batchSize   int
+	batchBytes  int
+	maxInFlight int
+	workers     int
+}
+
+func (f *indexFlags) register(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&f.ignore, "ignore", nil, "absolute paths or base-name globs to skip; repeat or separate with commas")
+	flags.IntVar(&f.batchSize, "batch-size", 0, "maximum documents per upload (default from configuration)")
+	flags.IntVar(&f.batchBytes, "batch-bytes", 0, "approximate maximum bytes per upload (default from configuration)")
+	flags.IntVar(&f.maxInFlight, "max-in-flight", 0, "upload tasks that may be pending at once (default from configuration)")
+	flags.IntVar(&f.workers, "workers", 0, "files read and hashed at once (default: one per CPU)")
+}
+
+// options returns the indexer options for the flags that were set
+func (f *indexFlags) options(cmd *cobra.Command) (indexer.Options, error) {
+	opts := indexer.DefaultOptions()
+
+	for _, p := range f.ignore {
+		if p = strings.TrimSpace(p); p != "" {
+			opts.IgnorePatterns = append(opts.IgnorePatterns, p)
+		}
+	}
+
+	limits := []struct {
+		name  string
+		value int
+		dst   *int
+	}{
+		{"batch-size", f.batchSize, &opts.BatchSize},
+		{"batch-bytes", f.batchBytes, &opts.BatchBytes},
+		{"max-in-flight", f.maxInFlight, &opts.MaxInFlight},
+		{"workers", f.workers, &opts.Workers},
+	}
+	for _, l := range limits {
+		if !cmd.Flags().Changed(l.name) {
+			continue
+		}
+		if err := checkPositive(l.name, int64(l.value)); err != nil {
+			return opts, err
+		}
+		*l.dst = l.value
+	}
+	return opts, nil
+}
+
+// checkPositive rejects flag values below one
+func checkPositive(name string, value int64) error {
+	if value < 1 {
+		return usageError(fmt.Errorf("--%s must be a positive integer, got %d", name, value))
+	}
+	return nil
+}
+
+// usageArgs makes argument validation errors exit with ExitUsage
+func usageArgs(validate cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			return usageError(err)
+		}
+		return nil
+	}
+}
+
+// completeDirectories lets the shell complete directory names
+func completeDirectories(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveFilterDirs
+}
+
+// completeFormat offers the output formats
+func completeFormat(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	values := make([]string, len(outputFormats))
+	for i, f := range outputFormats {
+		values[i] = string(f)
+	}
+	return values, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSort offers the sort keys with each direction
+func completeSort(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	keys := []search.SortKey{search.SortRelevance, search.SortModified, search.SortSize, search.SortName}
+	var values []string
+	for _, k := range keys {
+		values = append(values, string(k))
+		if k != search.SortRelevance {
+			values = append(values, string(k)+":asc", string(k)+":desc")
+		}
+	}
+	return values, cobra.ShellCompDirectiveNoFileComp
+}
@@ -1,53 +1,163 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/sahil485/memex/pkg/indexer"
+	"github.com/spf13/cobra"
 )
 
-func Index(args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("usage: memex index <directory> [--ignore pattern1,pattern2,...]")
-	}
-
-	directory := args[0]
-	var ignorePatterns []string
+func newIndexCommand(g *globalFlags) *cobra.Command {
+	var flags indexFlags
 
-	// Parse --ignore flags (can be specified multiple times)
-	for i := 1; i < len(args); i++ {
-		if args[i] == "--ignore" {
-			if i+1 >= len(args) {
-				return fmt.Errorf("--ignore requires a pattern argument")
+	cmd := &cobra.Command{
+		Use:   "index <directory>",
+		Short: "Index the files under a directory",
+		Long: `Index the files under a directory. Files that are unchanged since the last
+run are skipped, and files that were deleted are removed from the index.`,
+		Example: `  memex index ~/Documents
+  memex index ~/src --ignore node_modules,'*.log' --workers 4`,
+		Args:              usageArgs(cobra.ExactArgs(1)),
+		ValidArgsFunction: completeDirectories,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV, formatPaths); err != nil {
+				return err
 			}
-			// Get the next argument
-			patterns := args[i+1]
-			// Split comma-separated patterns
-			parts := strings.Split(patterns, ",")
-			for _, p := range parts {
-				p = strings.TrimSpace(p)
-				if p != "" {
-					ignorePatterns = append(ignorePatterns, p)
-				}
+			opts, err := flags.options(cmd)
+			if err != nil {
+				return err
 			}
-			i++ // Skip the pattern argument
+			opts.Log = g.log()
+			return runIndex(g, args[0], opts)
+		},
+	}
+	flags.register(cmd.Flags())
+	return cmd
+}
+
+// indexOutput is the machine-readable outcome of indexing a directory
+type indexOutput struct {
+	Directory string       `json:"directory"`
+	Added     int          `json:"added"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Removed   int          `json:"removed"`
+	Errors    []indexError `json:"errors"`
+}
+
+type indexError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+func runIndex(g *globalFlags, directory string, opts indexer.Options) error {
+	ctx, stop := signalContext()
+	defer stop()
+
+	stats, err := indexWithProgress(ctx, g, directory, opts)
+	if err != nil {
+		return err
+	}
+
+	if g.structured() {
+		if err := printIndexStats(g.printer(), directory, stats); err != nil {
+			return err
 		}
+	} else {
+		printIndexSummary(stats)
 	}
+	return partialError(stats)
+}
 
-	fmt.Printf("Indexing directory %s...\n", directory)
-	if len(ignorePatterns) > 0 {
-		fmt.Printf("Ignoring %d patterns:\n", len(ignorePatterns))
-		for _, p := range ignorePatterns {
-			fmt.Printf("  - %s\n", p)
+// signalContext returns a context cancelled by Ctrl+C or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// indexWithProgress indexes directory, showing a progress bar on a terminal
+func indexWithProgress(ctx context.Context, g *globalFlags, directory string, opts indexer.Options) (*indexer.IndexStats, error) {
+	g.printf("Indexing directory %s...\n", directory)
+	if len(opts.IgnorePatterns) > 0 {
+		g.printf("Ignoring %d patterns:\n", len(opts.IgnorePatterns))
+		for _, p := range opts.IgnorePatterns {
+			g.printf("  - %s\n", p)
 		}
 	}
 
-	err := indexer.IndexDirectory(directory, ignorePatterns)
+	// A terminal gets a progress bar in place of a line per file
+	if !g.structured() && !g.verbose && isTerminal(os.Stdout) {
+		opts.Log = nil
+		opts.Progress = newProgressBar(os.Stdout).update
+	}
+
+	stats, err := indexer.IndexDirectory(ctx, directory, opts)
+	if errors.Is(err, context.Canceled) {
+		return nil, errors.New("indexing cancelled")
+	}
 	if err != nil {
-		return fmt.Errorf("indexing failed: %w", err)
+		return nil, fmt.Errorf("indexing failed: %w", err)
 	}
+	return stats, nil
+}
+
+// printIndexSummary prints the counts of a run and the files it could not read
+func printIndexSummary(stats *indexer.IndexStats) {
+	fmt.Printf("✓ Indexing complete (%d added, %d updated, %d unchanged, %d removed)\n",
+		stats.Added, stats.Updated, stats.Unchanged, stats.Removed)
 
-	fmt.Println("✓ Indexing complete")
+	if len(stats.Errors) > 0 {
+		fmt.Printf("%d files could not be read:\n", len(stats.Errors))
+		for _, e := range stats.Errors {
+			fmt.Printf("  - %v\n", e)
+		}
+	}
+}
+
+// partialError returns an ExitPartial error if some files could not be read
+func partialError(stats *indexer.IndexStats) error {
+	if len(stats.Errors) > 0 {
+		return &exitError{code: ExitPartial, err: fmt.Errorf("%d files could not be read", len(stats.Errors))}
+	}
 	return nil
 }
+
+// printIndexStats prints the outcome of indexing. A TSV row holds the
+// directory, the added, updated, unchanged and removed counts and the number
+// of errors; paths lists the files that could not be read.
+func printIndexStats(p *printer, directory string, stats *indexer.IndexStats) error {
+	switch p.format {
+	case formatTSV:
+		p.row(directory, strconv.Itoa(stats.Added), strconv.Itoa(stats.Updated),
+			strconv.Itoa(stats.Unchanged), strconv.Itoa(stats.Removed), strconv.Itoa(len(stats.Errors)))
+	case formatPaths:
+		for _, e := range stats.Errors {
+			p.path(e.Path)
+		}
+	default:
+		if err := p.json(newIndexOutput(directory, stats)); err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+func newIndexOutput(directory string, stats *indexer.IndexStats) indexOutput {
+	out := indexOutput{
+		Directory: directory,
+		Added:     stats.Added,
+		Updated:   stats.Updated,
+		Unchanged: stats.Unchanged,
+		Removed:   stats.Removed,
+		Errors:    make([]indexError, 0, len(stats.Errors)),
+	}
+	for _, e := range stats.Errors {
+		out.Errors = append(out.Errors, indexError{Path: e.Path, Error: e.Err.Error()})
+	}
+	return out
+}
@@ -2,18 +2,46 @@ package commands
 
 import (
 	"fmt"
-	"github.com/sahil485/memex/pkg/client"
+
+	"github.com/sahil485/memex/pkg/backend"
 	"github.com/sahil485/memex/pkg/config"
+	"github.com/spf13/cobra"
 )
 
-func Init(args []string) error {
-	fmt.Println("Initializing memex...")
+func newInitCommand(g *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "init",
+		Short: "Create the index and apply its settings",
+		Long: `Create the index if it does not exist and apply its searchable, filterable
+and sortable attributes. Run it again after upgrading memex.`,
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV); err != nil {
+				return err
+			}
+			return runInit(g)
+		},
+	}
+}
 
-	err := client.InitializeIndex()
+func runInit(g *globalFlags) error {
+	g.printf("Initializing memex...\n")
+
+	err := backend.New().Init()
 	if err != nil {
 		return fmt.Errorf("failed to initialize: %w", err)
 	}
 
-	fmt.Printf("✓ Index '%s' ready\n", config.IndexName)
+	index := config.Current().IndexName
+	if g.structured() {
+		p := g.printer()
+		if g.format == formatTSV {
+			p.row(index)
+		} else if err := p.json(map[string]string{"index": index}); err != nil {
+			return err
+		}
+		return p.flush()
+	}
+	fmt.Printf("✓ Index '%s' ready\n", index)
 	return nil
 }
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// outputFormat is how a command prints its results
+type outputFormat string
+
+const (
+	formatText   outputFormat = "text"
+	formatJSON   outputFormat = "json"
+	formatNDJSON outputFormat = "ndjson"
+	formatTSV    outputFormat = "tsv"
+	formatPaths  outputFormat = "paths"
+)
+
+var outputFormats = []outputFormat{formatText, formatJSON, formatNDJSON, formatTSV, formatPaths}
+
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+func (f *outputFormat) Set(s string) error {
+	for _, format := range outputFormats {
+		if string(format) == s {
+			*f = format
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", formatList(outputFormats))
+}
+
+func (f *outputFormat) Type() string {
+	return "format"
+}
+
+func formatList(formats []outputFormat) string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
+
+// printer writes the records of a machine-readable format to stdout. Each
+// record ends with a newline, or a NUL byte with --print0.
+type printer struct {
+	format outputFormat
+	end    byte
+	w      *bufio.Writer
+}
+
+func (g *globalFlags) printer() *printer {
+	p := &printer{format: g.format, end: '\n', w: bufio.NewWriter(os.Stdout)}
+	if g.print0 {
+		p.end = 0
+	}
+	return p
+}
+
+// json writes v as an indented document for json, or as one line for ndjson
+func (p *printer) json(v any) error {
+	var (
+		data []byte
+		err  error
+	)
+	if p.format == formatJSON {
+		data, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	p.w.Write(data)
+	p.w.WriteByte(p.end)
+	return nil
+}
+
+// row writes tab-separated fields. Backslashes, tabs and line breaks in a
+// field are escaped, so every row is one line.
+func (p *printer) row(fields ...string) {
+	for i, f := range fields {
+		if i > 0 {
+			p.w.WriteByte('\t')
+		}
+		p.w.WriteString(tsvEscaper.Replace(f))
+	}
+	p.w.WriteByte(p.end)
+}
+
+// path writes a path as its own record
+func (p *printer) path(path string) {
+	p.w.WriteString(path)
+	p.w.WriteByte(p.end)
+}
+
+func (p *printer) flush() error {
+	return p.w.Flush()
+}
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sahil485/memex/pkg/indexer"
+)
+
+// progressInterval is the shortest time between redraws of the progress bar
+const progressInterval = 100 * time.Millisecond
+
+// progressWidth is the number of cells in the progress bar
+const progressWidth = 30
+
+// progressBar draws indexing progress on one terminal line, printing
+// unreadable files above it as they come
+type progressBar struct {
+	out   io.Writer
+	drawn time.Time
+
+	// width is the length of the line last drawn, so it can be cleared
+	width int
+}
+
+func newProgressBar(out io.Writer) *progressBar {
+	return &progressBar{out: out}
+}
+
+// update is an indexer.Options.Progress callback
+func (b *progressBar) update(p indexer.Progress) {
+	switch {
+	case p.Kind == indexer.ProgressDone:
+		b.clear()
+		return
+	case p.Kind == indexer.ProgressSkipped && p.Reason == indexer.SkipUnreadable:
+		b.clear()
+		fmt.Fprintf(b.out, "Skipping %s: %s\n", p.Path, p.Error)
+	case p.Kind == indexer.ProgressExtracted && p.Error != "":
+		b.clear()
+		fmt.Fprintf(b.out, "Indexing %s without content: %s\n", p.Path, p.Error)
+	case time.Since(b.drawn) < progressInterval:
+		return
+	}
+	b.draw(p)
+}
+
+// draw replaces the current line with the bar for p
+func (b *progressBar) draw(p indexer.Progress) {
+	b.drawn = time.Now()
+
+	var line string
+	if p.Walked && p.Processed == p.Discovered {
+		// Everything is read; the last batches are still uploading
+		line = fmt.Sprintf("%d files read, %d documents uploaded", p.Processed, p.Uploaded)
+	} else {
+		// Until the walk ends the total is a lower bound
+		total := fmt.Sprint(p.Discovered)
+		if !p.Walked {
+			total += "+"
+		}
+
+		filled := 0
+		if p.Discovered > 0 {
+			filled = progressWidth * p.Processed / p.Discovered
+		}
+		line = fmt.Sprintf("[%s%s] %d/%s files",
+			strings.Repeat("#", filled), strings.Repeat("-", progressWidth-filled), p.Processed, total)
+		if eta, ok := progressETA(p); ok {
+			line += fmt.Sprintf(", ETA %s", eta)
+		}
+	}
+
+	fmt.Fprintf(b.out, "\r%-*s", b.width, line)
+	b.width = len(line)
+}
+
+// clear erases the bar so other output can take its line
+func (b *progressBar) clear() {
+	if b.width > 0 {
+		fmt.Fprintf(b.out, "\r%s\r", strings.Repeat(" ", b.width))
+		b.width = 0
+	}
+}
+
+// progressETA estimates the time left from the average time per file so far
+func progressETA(p indexer.Progress) (time.Duration, bool) {
+	if p.Processed == 0 || p.Elapsed < time.Second {
+		return 0, false
+	}
+	left := time.Duration(p.Discovered-p.Processed) * (p.Elapsed / time.Duration(p.Processed))
+	return left.Round(time.Second), true
+}
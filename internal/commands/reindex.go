@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sahil485/memex/pkg/indexer"
+	"github.com/sahil485/memex/pkg/roots"
+	"github.com/spf13/cobra"
+)
+
+func newReindexCommand(g *globalFlags) *cobra.Command {
+	var (
+		flags indexFlags
+		all   bool
+		due   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "reindex [root]",
+		Short: "Index registered roots again with their rules",
+		Long: `Index a registered root again with the ignore patterns, extensions and depth
+limit it was added with. --all re-indexes every root, and --due those whose
+schedule calls for a run, e.g. from cron. Flags apply on top of each root's
+rules for this run only.`,
+		Example: `  memex reindex ~/Documents
+  memex reindex --all
+  memex reindex --due --format ndjson`,
+		Args:              usageArgs(cobra.MaximumNArgs(1)),
+		ValidArgsFunction: completeRoots,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV, formatPaths); err != nil {
+				return err
+			}
+			selected := 0
+			for _, set := range []bool{len(args) == 1, all, due} {
+				if set {
+					selected++
+				}
+			}
+			if selected != 1 {
+				return usageError(errors.New("name a root, or pass one of --all or --due"))
+			}
+
+			list, err := selectRoots(args, all, due)
+			if err != nil {
+				return err
+			}
+			opts, err := flags.options(cmd)
+			if err != nil {
+				return err
+			}
+			opts.Log = g.log()
+			return runReindex(g, list, opts)
+		},
+	}
+	flags.register(cmd.Flags())
+	cmd.Flags().BoolVar(&all, "all", false, "re-index every registered root")
+	cmd.Flags().BoolVar(&due, "due", false, "re-index the roots whose schedule calls for a run")
+	return cmd
+}
+
+// selectRoots returns the roots reindex was asked for
+func selectRoots(args []string, all, due bool) ([]roots.Root, error) {
+	switch {
+	case all:
+		return roots.List()
+	case due:
+		return roots.Due(time.Now())
+	}
+
+	root, err := roots.Get(args[0])
+	if errors.Is(err, roots.ErrNotFound) {
+		return nil, usageError(fmt.Errorf("%w; add it with: memex roots add %s", err, args[0]))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []roots.Root{root}, nil
+}
+
+// runReindex indexes each root in turn. A root that fails does not stop the
+// others; cancelling does.
+func runReindex(g *globalFlags, list []roots.Root, base indexer.Options) error {
+	ctx, stop := signalContext()
+	defer stop()
+
+	if len(list) == 0 {
+		g.printf("No roots to re-index\n")
+	}
+
+	var (
+		outputs []indexOutput
+		errs    []error
+		partial bool
+	)
+	for _, root := range list {
+		opts := root.Options(base)
+		nested, err := roots.Nested(root.Path)
+		if err != nil {
+			return err
+		}
+		opts.Keep = nested
+
+		stats, err := indexWithProgress(ctx, g, root.Path, opts)
+		if ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", root.Path, err))
+			g.printf("✗ %v\n", err)
+			continue
+		}
+		partial = partial || len(stats.Errors) > 0
+
+		switch {
+		case !g.structured():
+			printIndexSummary(stats)
+		case g.format == formatJSON:
+			outputs = append(outputs, newIndexOutput(root.Path, stats))
+		default:
+			if err := printIndexStats(g.printer(), root.Path, stats); err != nil {
+				return err
+			}
+		}
+	}
+
+	// JSON output is one array, so it is printed once every root is done
+	if g.format == formatJSON {
+		if outputs == nil {
+			outputs = []indexOutput{}
+		}
+		p := g.printer()
+		if err := p.json(outputs); err != nil {
+			return err
+		}
+		if err := p.flush(); err != nil {
+			return err
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if partial {
+		return &exitError{code: ExitPartial, err: errors.New("some files could not be read")}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+// globalFlags holds the flags shared by every command
+type globalFlags struct {
+	configPath string
+	url        string
+	json       bool
+	verbose    bool
+	format     outputFormat
+	print0     bool
+
+	// configErr is why the configuration failed to load, for commands that
+	// run on defaults instead
+	configErr error
+}
+
+// verbosef prints diagnostics to stderr when --verbose is set
+func (g *globalFlags) verbosef(format string, args ...any) {
+	if g.verbose {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+// structured reports whether output is machine-readable rather than text
+func (g *globalFlags) structured() bool {
+	return g.format != formatText
+}
+
+// log returns where indexer progress goes: stdout for text, stderr when
+// stdout is machine-readable and --verbose asks for it, and nowhere otherwise
+func (g *globalFlags) log() io.Writer {
+	switch {
+	case !g.structured():
+		return os.Stdout
+	case g.verbose:
+		return os.Stderr
+	}
+	return nil
+}
+
+// printf prints human-readable output, which --format suppresses
+func (g *globalFlags) printf(format string, args ...any) {
+	if !g.structured() {
+		fmt.Printf(format, args...)
+	}
+}
+
+// checkFormat rejects output formats the command cannot print
+func (g *globalFlags) checkFormat(cmd *cobra.Command, supported ...outputFormat) error {
+	if g.format == formatText || slices.Contains(supported, g.format) {
+		return nil
+	}
+	if len(supported) == 0 {
+		return usageError(fmt.Errorf("%s only prints text, not --format %s", cmd.Name(), g.format))
+	}
+	return usageError(fmt.Errorf("%s does not support --format %s; use one of text, %s", cmd.Name(), g.format, formatList(supported)))
+}
+
+// NewRootCommand returns the memex command tree
+func NewRootCommand() *cobra.Command {
+	g := &globalFlags{format: formatText}
+
+	// Completion scripts are registered under the command's name, so name it
+	// after the installed binary, e.g. memex-cli
+	root := &cobra.Command{
+		Use:   filepath.Base(os.Args[0]),
+		Short: "Index and search your local files with Meilisearch",
+		Long: `memex indexes the files in your directories into Meilisearch and searches
+them by name, content and metadata.
+
+Run "memex serve" to start Meilisearch, "memex init" to create the index and
+"memex index <directory>" to fill it.`,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkOutput(cmd); err != nil {
+				return err
+			}
+			return g.loadConfig(cmd)
+		},
+	}
+	root.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError(err)
+	})
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&g.configPath, "config", "", "configuration file (default "+config.Path()+")")
+	flags.StringVar(&g.url, "url", "", "Meilisearch URL, overriding the configuration and MEMEX_URL")
+	flags.Var(&g.format, "format", "output format: "+formatList(outputFormats))
+	flags.BoolVar(&g.json, "json", false, "shorthand for --format json")
+	flags.BoolVar(&g.print0, "print0", false, "end ndjson, tsv and paths records with NUL instead of newline, for xargs -0")
+	flags.BoolVarP(&g.verbose, "verbose", "v", false, "print configuration, requests and timings to stderr")
+	root.RegisterFlagCompletionFunc("format", completeFormat)
+
+	root.AddCommand(
+		newInitCommand(g),
+		newSearchCommand(g),
+		newIndexCommand(g),
+		newWatchCommand(g),
+		newRootsCommand(g),
+		newReindexCommand(g),
+		newServeCommand(g),
+		newStatusCommand(g),
+		newDoctorCommand(g),
+		newClearIndexCommand(g),
+	)
+	return root
+}
+
+// checkOutput resolves --json into --format and checks --print0 fits it
+func (g *globalFlags) checkOutput(cmd *cobra.Command) error {
+	if g.json {
+		if cmd.Flags().Changed("format") && g.format != formatJSON {
+			return usageError(fmt.Errorf("--json conflicts with --format %s", g.format))
+		}
+		g.format = formatJSON
+	}
+	if g.print0 {
+		switch g.format {
+		case formatNDJSON, formatTSV, formatPaths:
+		default:
+			return usageError(fmt.Errorf("--print0 needs --format ndjson, tsv or paths"))
+		}
+	}
+	return nil
+}
+
+// configOptional marks commands that run on the default configuration when
+// the configuration file is invalid, recording the error in configErr
+const configOptional = "config-optional"
+
+// loadConfig loads the configuration named by --config and applies --url
+func (g *globalFlags) loadConfig(cmd *cobra.Command) error {
+	path := g.configPathOrDefault()
+
+	cfg, err := config.Load(path)
+	if err != nil && cmd.Annotations[configOptional] != "" {
+		g.configErr, cfg = err, config.Default()
+	} else if err != nil {
+		return &exitError{code: ExitConfig, err: fmt.Errorf("invalid configuration: %w", err)}
+	}
+	if g.url != "" {
+		if err := cfg.SetURL(g.url); err != nil {
+			return usageError(fmt.Errorf("--url: %w", err))
+		}
+	}
+	config.Use(cfg)
+
+	g.verbosef("Configuration: %s", path)
+	g.verbosef("Meilisearch: %s (index %s)", engine.Endpoint(), cfg.IndexName)
+	return nil
+}
+
+// configPathOrDefault returns the configuration file in use
+func (g *globalFlags) configPathOrDefault() string {
+	if g.configPath != "" {
+		return g.configPath
+	}
+	return config.Path()
+}
+
+// Execute runs the command named by the process arguments and returns the
+// exit code for its outcome
+func Execute() int {
+	cmd, err := NewRootCommand().ExecuteC()
+	if err == nil {
+		return ExitOK
+	}
+
+	// Cobra reports unknown subcommands and bad arguments as plain errors
+	if strings.HasPrefix(err.Error(), "unknown command") {
+		err = usageError(err)
+	}
+	code := ExitCode(err)
+
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if code == ExitUsage {
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+	}
+	return code
+}
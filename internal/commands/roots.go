@@ -0,0 +1,314 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sahil485/memex/pkg/indexer"
+	"github.com/sahil485/memex/pkg/roots"
+	"github.com/spf13/cobra"
+)
+
+func newRootsCommand(g *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "roots",
+		Short: "Manage the directories memex keeps indexed",
+		Long: `Manage the registry of indexed directories. Each root keeps its own ignore
+patterns, extensions, depth limit and re-index schedule, which reindex and the
+desktop app apply. The registry is stored in ~/.memex/roots.json.`,
+		Args: usageArgs(cobra.NoArgs),
+	}
+	cmd.AddCommand(
+		newRootsAddCommand(g),
+		newRootsRemoveCommand(g),
+		newRootsListCommand(g),
+	)
+	return cmd
+}
+
+func newRootsAddCommand(g *globalFlags) *cobra.Command {
+	var (
+		root    roots.Root
+		noIndex bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add <directory>",
+		Short: "Register a directory and index it",
+		Long: `Register a directory as a root and index it with its rules. Adding a root
+that is already registered replaces its rules; files they now exclude are
+removed from the index.`,
+		Example: `  memex roots add ~/Documents --schedule daily
+  memex roots add ~/notes --ext md,txt --max-depth 2
+  memex roots add ~/src --ignore node_modules,'*.log' --exclude-ext json --no-index`,
+		Args:              usageArgs(cobra.ExactArgs(1)),
+		ValidArgsFunction: completeDirectories,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV, formatPaths); err != nil {
+				return err
+			}
+			if err := checkRoot(root); err != nil {
+				return err
+			}
+			root.Path = args[0]
+			return runRootsAdd(g, root, noIndex)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVar(&root.Ignore, "ignore", nil, "absolute paths or base-name globs to skip; repeat or separate with commas")
+	flags.StringSliceVar(&root.Extensions, "ext", nil, "index only these extensions instead of the configured ones")
+	flags.StringSliceVar(&root.ExcludeExtensions, "exclude-ext", nil, "extensions to leave out")
+	flags.IntVar(&root.MaxDepth, "max-depth", 0, "directory levels to index; 1 is the files directly in the root (default: no limit)")
+	flags.Var((*scheduleFlag)(&root.Schedule), "schedule", "re-index hourly, daily, weekly or every duration such as 6h (default: only on request)")
+	flags.BoolVar(&noIndex, "no-index", false, "register the root without indexing it now")
+	cmd.RegisterFlagCompletionFunc("schedule", completeSchedule)
+	return cmd
+}
+
+// checkRoot rejects flag values the registry would refuse, as usage errors
+func checkRoot(root roots.Root) error {
+	if root.MaxDepth < 0 {
+		return usageError(fmt.Errorf("--max-depth must not be negative, got %d", root.MaxDepth))
+	}
+	return nil
+}
+
+func runRootsAdd(g *globalFlags, root roots.Root, noIndex bool) error {
+	root, err := roots.Add(root)
+	if err != nil {
+		return fmt.Errorf("failed to add root: %w", err)
+	}
+	g.printf("✓ Added root %s\n", root.Path)
+
+	var indexErr error
+	if !noIndex {
+		opts := root.Options(indexer.DefaultOptions())
+		opts.Log = g.log()
+		if g.structured() {
+			// The root record is the output; keep the run quiet
+			opts.Log = nil
+		}
+		if opts.Keep, err = roots.Nested(root.Path); err != nil {
+			return err
+		}
+		indexErr = runIndexRoot(g, root, opts)
+	}
+
+	if g.structured() {
+		if err := printRoots(g.printer(), []rootOutput{newRootOutput(root, nil)}); err != nil {
+			return err
+		}
+	}
+	return indexErr
+}
+
+// runIndexRoot indexes a root, printing its summary as text
+func runIndexRoot(g *globalFlags, root roots.Root, opts indexer.Options) error {
+	ctx, stop := signalContext()
+	defer stop()
+
+	stats, err := indexWithProgress(ctx, g, root.Path, opts)
+	if err != nil {
+		return err
+	}
+	if !g.structured() {
+		printIndexSummary(stats)
+	}
+	return partialError(stats)
+}
+
+func newRootsRemoveCommand(g *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:     "remove <directory>",
+		Aliases: []string{"rm"},
+		Short:   "Unregister a root and remove its files from the index",
+		Long: `Unregister a root and delete the documents of its files from the index.
+Files that are also under another registered root stay indexed.`,
+		Example:           `  memex roots remove ~/Downloads`,
+		Args:              usageArgs(cobra.ExactArgs(1)),
+		ValidArgsFunction: completeRoots,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV, formatPaths); err != nil {
+				return err
+			}
+			return runRootsRemove(g, args[0])
+		},
+	}
+}
+
+func runRootsRemove(g *globalFlags, path string) error {
+	root, err := roots.Get(path)
+	if err != nil {
+		return err
+	}
+
+	removed, err := roots.Remove(root.Path)
+	if err != nil {
+		return err
+	}
+
+	if !g.structured() {
+		fmt.Printf("✓ Removed root %s (%d files removed from the index)\n", root.Path, removed)
+		return nil
+	}
+
+	p := g.printer()
+	switch g.format {
+	case formatTSV:
+		p.row(root.Path, strconv.Itoa(removed))
+	case formatPaths:
+		p.path(root.Path)
+	default:
+		if err := p.json(map[string]any{"path": root.Path, "removed": removed}); err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+func newRootsListCommand(g *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the registered roots and their rules",
+		Args:    usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV, formatPaths); err != nil {
+				return err
+			}
+			return runRootsList(g)
+		},
+	}
+}
+
+// rootOutput is a root with its latest run, for machine-readable output
+type rootOutput struct {
+	roots.Root
+	LastRun *indexer.Run `json:"last_run,omitempty"`
+}
+
+func newRootOutput(root roots.Root, runs []indexer.Run) rootOutput {
+	out := rootOutput{Root: root}
+	for i := range runs {
+		if runs[i].Root == root.Path {
+			out.LastRun = &runs[i]
+		}
+	}
+	return out
+}
+
+func runRootsList(g *globalFlags) error {
+	list, err := roots.List()
+	if err != nil {
+		return err
+	}
+	runs, err := indexer.ReadRuns()
+	if err != nil {
+		return err
+	}
+
+	outputs := make([]rootOutput, len(list))
+	for i, r := range list {
+		outputs[i] = newRootOutput(r, runs)
+	}
+
+	if g.structured() {
+		return printRoots(g.printer(), outputs)
+	}
+
+	if len(outputs) == 0 {
+		fmt.Println("No roots registered; add one with: memex roots add <directory>")
+		return nil
+	}
+	for _, r := range outputs {
+		fmt.Println(r.Path)
+		if len(r.Ignore) > 0 {
+			fmt.Printf("  Ignore:     %s\n", strings.Join(r.Ignore, ", "))
+		}
+		if len(r.Extensions) > 0 {
+			fmt.Printf("  Extensions: %s\n", strings.Join(r.Extensions, ", "))
+		}
+		if len(r.ExcludeExtensions) > 0 {
+			fmt.Printf("  Excluded:   %s\n", strings.Join(r.ExcludeExtensions, ", "))
+		}
+		if r.MaxDepth > 0 {
+			fmt.Printf("  Max depth:  %d\n", r.MaxDepth)
+		}
+		if r.Schedule != "" {
+			fmt.Printf("  Schedule:   %s\n", r.Schedule)
+		}
+		if r.LastRun != nil {
+			fmt.Printf("  Indexed:    %s\n", r.LastRun.FinishedAt.Local().Format(timeLayout))
+		} else {
+			fmt.Println("  Indexed:    never")
+		}
+	}
+	return nil
+}
+
+// printRoots prints roots as a JSON array, one JSON object per line for
+// ndjson, TSV rows of path, schedule, max depth and last indexed time, or
+// their paths
+func printRoots(p *printer, list []rootOutput) error {
+	switch p.format {
+	case formatJSON:
+		if err := p.json(list); err != nil {
+			return err
+		}
+	case formatTSV:
+		for _, r := range list {
+			indexed := ""
+			if r.LastRun != nil {
+				indexed = r.LastRun.FinishedAt.Format(timeLayout)
+			}
+			p.row(r.Path, string(r.Schedule), strconv.Itoa(r.MaxDepth), indexed)
+		}
+	case formatPaths:
+		for _, r := range list {
+			p.path(r.Path)
+		}
+	default:
+		for _, r := range list {
+			if err := p.json(r); err != nil {
+				return err
+			}
+		}
+	}
+	return p.flush()
+}
+
+// scheduleFlag validates --schedule when it is parsed
+type scheduleFlag roots.Schedule
+
+func (f *scheduleFlag) String() string {
+	return string(*f)
+}
+
+func (f *scheduleFlag) Set(s string) error {
+	if _, err := roots.Schedule(s).Interval(); err != nil {
+		return err
+	}
+	*f = scheduleFlag(s)
+	return nil
+}
+
+func (f *scheduleFlag) Type() string {
+	return "schedule"
+}
+
+// completeSchedule offers the named schedules
+func completeSchedule(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"hourly", "daily", "weekly"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRoots offers the registered roots
+func completeRoots(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	list, _ := roots.List()
+	paths := make([]string, len(list))
+	for i, r := range list {
+		paths[i] = r.Path
+	}
+	return paths, cobra.ShellCompDirectiveNoFileComp
+}
@@ -1,46 +1,306 @@
 package commands
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sahil485/memex/pkg/search"
-	"github.com/sahil485/memex/pkg/types"
+	"github.com/spf13/cobra"
 )
 
-func Search(args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("usage: memex search <query>")
+// searchOperators are the query operators offered by completion
+var searchOperators = []string{"ext:", "in:", "path:", "modified:", "size:"}
+
+func newSearchCommand(g *globalFlags) *cobra.Command {
+	var (
+		sortFlag string
+		limit    int64
+		page     int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "search <query>...",
+		Short: "Search indexed files",
+		Long: `Search indexed files by name, content and metadata.
+
+The words of the query may be followed by operators that narrow the results:
+ext:pdf,docx, in:~/Documents, path:src/, modified:<7d and size:>10MB. Put a
+- before an operator or word to exclude it; in that case separate the query
+from the flags with --, as in: memex search -- invoice -draft`,
+		Example: `  memex search quarterly report ext:pdf
+  memex search --sort mtime:desc --page 2 invoice
+  memex search -- budget -draft in:~/Documents`,
+		Args:              usageArgs(cobra.MinimumNArgs(1)),
+		ValidArgsFunction: completeQuery,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV, formatPaths); err != nil {
+				return err
+			}
+			opts := search.DefaultSearchOptions()
+			sort, err := search.ParseSort(sortFlag)
+			if err != nil {
+				return usageError(fmt.Errorf("--sort: %w", err))
+			}
+			opts.Sort = sort
+			if cmd.Flags().Changed("limit") {
+				if err := checkPositive("limit", limit); err != nil {
+					return err
+				}
+				opts.Limit = limit
+			}
+			if cmd.Flags().Changed("page") {
+				if err := checkPositive("page", page); err != nil {
+					return err
+				}
+				opts.Page = page
+			}
+
+			// Accept unquoted multi-word queries such as: memex search invoice ext:pdf
+			return runSearch(g, strings.Join(args, " "), opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&sortFlag, "sort", string(search.SortRelevance), "order by relevance, mtime, size or name, optionally with :asc or :desc")
+	flags.Int64Var(&limit, "limit", 0, fmt.Sprintf("results per page (default %d)", search.DefaultSearchOptions().Limit))
+	flags.Int64Var(&page, "page", 1, "1-based page of results to show")
+	cmd.RegisterFlagCompletionFunc("sort", completeSort)
+	return cmd
+}
+
+func runSearch(g *globalFlags, query string, opts search.SearchOptions) error {
+	opts.Facets, opts.Totals = true, true
+
+	if !g.structured() && opts.HighlightPreTag == "" && opts.HighlightPostTag == "" && isTerminal(os.Stdout) {
+		opts.HighlightPreTag, opts.HighlightPostTag = ansiHighlight, ansiReset
 	}
 
-	query := args[0]
+	if g.verbose {
+		if q, err := search.ParseQuery(query); err == nil {
+			g.verbosef("Query: %q", q.Text)
+			if q.Filter != "" {
+				g.verbosef("Filter: %s", q.Filter)
+			}
+		}
+		g.verbosef("Sort: %s", opts.Sort)
+	}
 
-	results, err := search.Search(query, 10)
+	start := time.Now()
+	results, err := search.Search(query, opts)
+	var queryErr *search.QueryError
+	if errors.As(err, &queryErr) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("search failed: %w", err)
 	}
+	g.verbosef("Search took %v (%d ms in Meilisearch)", time.Since(start).Round(time.Millisecond), results.ProcessingTimeMs)
 
-	fmt.Printf("Found %d results:\n", results.EstimatedTotalHits)
-	for _, hit := range results.Hits {
-		// Decode to Document struct
-		var doc types.Document
-		if err := hit.DecodeInto(&doc); err != nil {
-			return fmt.Errorf("failed to decode document: %w", err)
-		}
+	if g.structured() {
+		return printSearchResults(g.printer(), results)
+	}
 
-		rankingScore := 0.0
-		if scoreRaw, ok := hit["_rankingScore"]; ok {
-			var score float64
-			if err := json.Unmarshal(scoreRaw, &score); err == nil {
-				rankingScore = score
-			}
-		}
+	switch {
+	case !results.Counted:
+		fmt.Printf("Page %d:\n", results.Offset/results.Limit+1)
+	case results.TotalExact:
+		fmt.Printf("Found %d results:\n", results.TotalFiles)
+	default:
+		fmt.Printf("Found at least %d results:\n", results.TotalFiles)
+	}
+	if f := results.Facets; f != nil {
+		printFacet("Types", f.Extensions, func(v search.FacetValue) string { return strings.TrimPrefix(v.Value, ".") })
+		printFacet("Folders", f.Directories, func(v search.FacetValue) string { return v.Value })
+		printFacet("Modified", f.Modified, func(v search.FacetValue) string { return v.Label })
+		fmt.Println()
+	}
+	for _, r := range results.Results {
+		doc := r.Document
 
 		// Print formatted result
-		fmt.Printf("  - %s (score: %.2f)\n", doc.Path, rankingScore)
+		fmt.Printf("  - %s (score: %.2f)\n", doc.Path, r.RankingScore)
 		fmt.Printf("    Name: %s\n", doc.Name)
+		if r.Page > 0 {
+			fmt.Printf("    Page: %d\n", r.Page)
+		}
+		if len(r.Passages) == 0 && r.Snippet != "" {
+			fmt.Printf("    %s\n", r.Snippet)
+		}
+		for _, p := range r.Passages {
+			if p.Page > 0 {
+				fmt.Printf("    Lines %d-%d (page %d)\n", p.StartLine, p.EndLine, p.Page)
+			} else {
+				fmt.Printf("    Lines %d-%d\n", p.StartLine, p.EndLine)
+			}
+			if p.Snippet != "" {
+				fmt.Printf("      %s\n", p.Snippet)
+			}
+		}
 		fmt.Println()
 	}
 
+	if results.HasMore {
+		page := results.Offset/results.Limit + 2
+		fmt.Printf("More results: add --page %d\n", page)
+	}
+
 	return nil
 }
+
+// printFacet prints the values of a facet on one line, e.g.
+// "Types: png 40 · svg 12", leaving out values without matches
+func printFacet(title string, values []search.FacetValue, label func(search.FacetValue) string) {
+	var parts []string
+	for _, v := range values {
+		if v.Count > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", label(v), v.Count))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Printf("  %s: %s\n", title, strings.Join(parts, " · "))
+	}
+}
+
+// ANSI escapes used to highlight matches when printing to a terminal
+const (
+	ansiHighlight = "\x1b[1;33m"
+	ansiReset     = "\x1b[0m"
+)
+
+// isTerminal reports whether f is a character device rather than a pipe or
+// file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// searchOutput is the JSON document for a page of search results. Total
+// counts the matching files, and is a lower bound unless TotalExact; both
+// are given on the first page only.
+type searchOutput struct {
+	Query      string         `json:"query"`
+	Total      *int64         `json:"total,omitempty"`
+	TotalExact *bool          `json:"total_exact,omitempty"`
+	Offset     int64          `json:"offset"`
+	Limit      int64          `json:"limit"`
+	HasMore    bool           `json:"has_more"`
+	Facets     *search.Facets `json:"facets,omitempty"`
+	Results    []searchHit    `json:"results"`
+}
+
+// searchHit is a result in machine-readable output; ndjson prints one per
+// line
+type searchHit struct {
+	Path     string          `json:"path"`
+	Name     string          `json:"name"`
+	Score    float64         `json:"score"`
+	Snippet  string          `json:"snippet"`
+	Ext      string          `json:"ext"`
+	Size     int64           `json:"size"`
+	Mtime    time.Time       `json:"mtime"`
+	Page     int             `json:"page,omitempty"`
+	Passages []searchPassage `json:"passages,omitempty"`
+}
+
+type searchPassage struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Page      int    `json:"page,omitempty"`
+	Snippet   string `json:"snippet,omitempty"`
+}
+
+func newSearchOutput(results *search.Response) searchOutput {
+	out := searchOutput{
+		Query:   results.Query,
+		Offset:  results.Offset,
+		Limit:   results.Limit,
+		HasMore: results.HasMore,
+		Facets:  results.Facets,
+		Results: make([]searchHit, 0, len(results.Results)),
+	}
+	if results.Counted {
+		out.Total, out.TotalExact = &results.TotalFiles, &results.TotalExact
+	}
+	for _, r := range results.Results {
+		hit := searchHit{
+			Path:    r.Document.Path,
+			Name:    r.Document.Name,
+			Score:   r.RankingScore,
+			Snippet: r.Snippet,
+			Ext:     r.Document.Ext,
+			Size:    r.Document.Size,
+			Mtime:   time.Unix(r.Document.ModTime, 0).UTC(),
+			Page:    r.Page,
+		}
+		for _, p := range r.Passages {
+			hit.Passages = append(hit.Passages, searchPassage(p))
+		}
+		out.Results = append(out.Results, hit)
+	}
+	return out
+}
+
+// printSearchResults prints results in a machine-readable format. A TSV row
+// holds the path, score, extension, size, modification time and snippet.
+func printSearchResults(p *printer, results *search.Response) error {
+	out := newSearchOutput(results)
+	if p.format == formatJSON {
+		if err := p.json(out); err != nil {
+			return err
+		}
+		return p.flush()
+	}
+
+	for _, hit := range out.Results {
+		switch p.format {
+		case formatNDJSON:
+			if err := p.json(hit); err != nil {
+				return err
+			}
+		case formatTSV:
+			p.row(hit.Path, strconv.FormatFloat(hit.Score, 'f', 4, 64), hit.Ext,
+				strconv.FormatInt(hit.Size, 10), hit.Mtime.Format(time.RFC3339), hit.Snippet)
+		case formatPaths:
+			p.path(hit.Path)
+		}
+	}
+	return p.flush()
+}
+
+// completeQuery completes query operators, and indexed directories after
+// in: and path:
+func completeQuery(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	directive := cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+
+	term := strings.TrimPrefix(toComplete, "-")
+	negation := toComplete[:len(toComplete)-len(term)]
+	for _, op := range []string{"in:", "path:"} {
+		if !strings.HasPrefix(term, op) {
+			continue
+		}
+		dirs, err := search.Directories()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		prefix := strings.TrimPrefix(term, op)
+		var values []string
+		for _, d := range dirs {
+			if strings.HasPrefix(d.Value, prefix) {
+				values = append(values, negation+op+d.Value)
+			}
+		}
+		return values, directive
+	}
+
+	var values []string
+	for _, op := range searchOperators {
+		if strings.HasPrefix(op, term) {
+			values = append(values, negation+op)
+		}
+	}
+	return values, directive
+}
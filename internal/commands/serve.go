@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+func newServeCommand(g *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Run Meilisearch and restart it if it crashes",
+		Long: `Start the bundled Meilisearch server and supervise it until interrupted.
+Nothing is started if a server already answers at the configured URL, or if
+the embedded backend is configured, since it needs no server.`,
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd); err != nil {
+				return err
+			}
+			return runServe()
+		},
+	}
+}
+
+func runServe() error {
+	if backend.Embedded() {
+		fmt.Printf("✓ The embedded backend needs no server; its index is at %s\n", backend.New().Location())
+		return nil
+	}
+	if url := engine.Endpoint(); engine.Healthy(url) {
+		fmt.Printf("✓ MeiliSearch is already running on %s\n", url)
+		return nil
+	}
+
+	settings := engine.DefaultSettings()
+	fmt.Printf("Starting MeiliSearch from %s...\n", settings.BinaryPath)
+	fmt.Printf("Logs: %s\n", engine.LogPath())
+
+	supervisor := engine.NewSupervisor(settings)
+	supervisor.OnStateChange = func(change engine.StateChange) {
+		switch change.State {
+		case engine.StateReady:
+			fmt.Printf("✓ MeiliSearch running on %s (Ctrl+C to stop)\n", change.URL)
+		case engine.StateCrashed:
+			fmt.Printf("✗ %s, restarting...\n", change.Error)
+		}
+	}
+
+	if err := supervisor.Start(); err != nil {
+		if errors.Is(err, engine.ErrAlreadyRunning) {
+			pid, _ := engine.LockOwner()
+			return fmt.Errorf("%w (pid %d, lockfile %s)", err, pid, engine.LockPath())
+		}
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case <-signals:
+		fmt.Println("Stopping MeiliSearch...")
+		supervisor.Stop()
+	case <-supervisor.Done():
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/search"
+	"github.com/sahil485/memex/pkg/status"
+	"github.com/spf13/cobra"
+)
+
+// timeLayout is how times are shown in status output
+const timeLayout = "2006-01-02 15:04"
+
+func newStatusCommand(g *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show what is in the index and whether Meilisearch is healthy",
+		Long: `Show the Meilisearch version and address, how many files are indexed and
+how much space they take, counts per file type and indexed directory, when
+indexing last ran, pending and failed tasks, and whether the index settings
+are those applied by init.
+
+Exits with status 4 if Meilisearch cannot be reached.`,
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd, formatJSON, formatNDJSON, formatTSV, formatPaths); err != nil {
+				return err
+			}
+			return runStatus(g)
+		},
+	}
+}
+
+func runStatus(g *globalFlags) error {
+	start := time.Now()
+	s, err := status.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get status: %w", err)
+	}
+	g.verbosef("Status took %v", time.Since(start).Round(time.Millisecond))
+
+	if g.structured() {
+		err = printStatusRecords(g.printer(), s)
+	} else {
+		printStatus(s)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !s.Healthy {
+		if s.Backend == config.BackendEmbedded {
+			return &exitError{code: ExitUnavailable, err: fmt.Errorf("embedded index at %s cannot be created", s.URL)}
+		}
+		return &exitError{code: ExitUnavailable, err: fmt.Errorf("meilisearch is not reachable at %s", s.URL)}
+	}
+	return nil
+}
+
+// printStatusRecords prints the status in a machine-readable format. TSV and
+// paths list the indexed roots; a TSV row holds the path, the file count and
+// when the root was last indexed.
+func printStatusRecords(p *printer, s *status.Status) error {
+	switch p.format {
+	case formatTSV:
+		for _, r := range s.Roots {
+			p.row(r.Path, strconv.FormatInt(r.Files, 10), r.LastRun.FinishedAt.Format(time.RFC3339))
+		}
+	case formatPaths:
+		for _, r := range s.Roots {
+			p.path(r.Path)
+		}
+	default:
+		if err := p.json(s); err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+func printStatus(s *status.Status) {
+	switch {
+	case s.Backend == config.BackendEmbedded && !s.Healthy:
+		fmt.Printf("✗ Embedded index at %s cannot be created\n", s.URL)
+	case s.Backend == config.BackendEmbedded:
+		fmt.Printf("✓ Embedded index (%s) at %s\n", s.Version, s.URL)
+	case !s.Healthy:
+		fmt.Printf("✗ MeiliSearch is not reachable at %s\n", s.URL)
+	default:
+		fmt.Printf("✓ MeiliSearch %s at %s\n", s.Version, s.URL)
+	}
+	if s.Healthy {
+		switch {
+		case !s.IndexExists:
+			fmt.Printf("✗ Index '%s' does not exist; run init\n", s.Index)
+		case s.IsIndexing:
+			fmt.Printf("  Index '%s': %d files (%d documents), %s on disk, indexing\n",
+				s.Index, s.Files, s.Documents, formatBytes(s.DatabaseSize))
+		default:
+			fmt.Printf("  Index '%s': %d files (%d documents), %s on disk\n",
+				s.Index, s.Files, s.Documents, formatBytes(s.DatabaseSize))
+		}
+	}
+
+	if s.LastIndexed != nil {
+		fmt.Printf("  Last indexed: %s\n", s.LastIndexed.Local().Format(timeLayout))
+	} else {
+		fmt.Println("  Last indexed: never")
+	}
+
+	if s.IndexExists {
+		if s.Backend != config.BackendEmbedded {
+			fmt.Printf("  Tasks: %d pending, %d failed\n", s.PendingTasks, s.FailedTasks)
+			for _, t := range s.RecentFailures {
+				fmt.Printf("    ✗ #%d %s: %s\n", t.UID, t.Type, t.Error)
+			}
+		}
+
+		if len(s.SettingsProblems) == 0 {
+			fmt.Println("  Settings: up to date")
+		} else {
+			fmt.Println("  Settings: out of date; run init")
+			for _, p := range s.SettingsProblems {
+				fmt.Printf("    - %s\n", p)
+			}
+		}
+
+		printFacet("Types", s.Extensions, func(v search.FacetValue) string { return strings.TrimPrefix(v.Value, ".") })
+		printFacet("Fields", fieldValues(s.FieldDistribution), func(v search.FacetValue) string { return v.Value })
+	}
+
+	if len(s.Roots) > 0 {
+		fmt.Println("  Roots:")
+		for _, r := range s.Roots {
+			if s.IndexExists {
+				fmt.Printf("    %s: %d files, indexed %s\n", r.Path, r.Files, r.LastRun.FinishedAt.Local().Format(timeLayout))
+			} else {
+				fmt.Printf("    %s: indexed %s\n", r.Path, r.LastRun.FinishedAt.Local().Format(timeLayout))
+			}
+		}
+	}
+}
+
+// fieldValues orders the field distribution by count, most common first
+func fieldValues(distribution map[string]int64) []search.FacetValue {
+	values := make([]search.FacetValue, 0, len(distribution))
+	for field, n := range distribution {
+		values = append(values, search.FacetValue{Value: field, Count: n})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	return values
+}
+
+// formatBytes formats a size with a binary unit, e.g. 12.3 MB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sahil485/memex/pkg/indexer"
+	"github.com/spf13/cobra"
+)
+
+func newWatchCommand(g *globalFlags) *cobra.Command {
+	var flags indexFlags
+
+	cmd := &cobra.Command{
+		Use:   "watch <directory>...",
+		Short: "Index directories and keep them up to date as files change",
+		Long: `Bring each directory up to date, then watch it and index files as they are
+created, changed, renamed or deleted until interrupted.`,
+		Example:           `  memex watch ~/Documents ~/Desktop --ignore '*.tmp'`,
+		Args:              usageArgs(cobra.MinimumNArgs(1)),
+		ValidArgsFunction: completeDirectories,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := g.checkFormat(cmd); err != nil {
+				return err
+			}
+			opts, err := flags.options(cmd)
+			if err != nil {
+				return err
+			}
+			return runWatch(args, opts)
+		},
+	}
+	flags.register(cmd.Flags())
+	return cmd
+}
+
+func runWatch(directories []string, opts indexer.Options) error {
+	watcher, err := indexer.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Bring each root up to date before applying live changes on top
+	for _, directory := range directories {
+		fmt.Printf("Syncing %s...\n", directory)
+		stats, err := indexer.IndexDirectory(ctx, directory, opts)
+		if errors.Is(err, context.Canceled) {
+			return errors.New("indexing cancelled")
+		}
+		if err != nil {
+			return fmt.Errorf("indexing failed: %w", err)
+		}
+		fmt.Printf("✓ %s synced (%d added, %d updated, %d removed)\n",
+			directory, stats.Added, stats.Updated, stats.Removed)
+
+		if err := watcher.Add(directory, opts); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Watching for changes (Ctrl+C to stop)...")
+	err = watcher.Run(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	fmt.Println("✓ Stopped watching")
+	return nil
+}
@@ -0,0 +1,755 @@
+// Package meilitest runs an in-memory stand-in for the Meilisearch endpoints
+// memex uses, so the packages that talk to Meilisearch can be tested without
+// a server.
+package meilitest
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	meilisearch "github.com/meilisearch/meilisearch-go"
+	"github.com/sahil485/memex/pkg/client"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// Index is the index the server's Client uses
+const Index = "files"
+
+// Server answers the document, task, search and settings endpoints of
+// Meilisearch from memory. Writes are applied before they are acknowledged,
+// so every task has succeeded by the time it is polled.
+//
+// Searches match documents whose searchable attributes contain every query
+// word, in insertion order unless sorted. Hits hold only the displayed
+// attributes that were asked for. Filters are recorded but not
+// applied, so tests of filtering assert on Searches and DocumentFilters
+// instead.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	indexes  map[string]*index
+	tasks    []meilisearch.Task
+	searches []types.SearchRequest
+	fetches  []string
+}
+
+// index holds the documents of an index in insertion order
+type index struct {
+	ids       []string
+	documents map[string]types.Hit
+	settings  map[string]json.RawMessage
+}
+
+// displayed returns the displayedAttributes setting; nil displays all
+func (x *index) displayed() []string {
+	var attributes []string
+	json.Unmarshal(x.settings["displayedAttributes"], &attributes)
+	return attributes
+}
+
+// NewServer starts a server that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{indexes: make(map[string]*index)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, map[string]string{"status": "available"})
+	})
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, map[string]string{"pkgVersion": "test"})
+	})
+	mux.HandleFunc("GET /stats", s.stats)
+	mux.HandleFunc("POST /indexes", s.createIndex)
+	mux.HandleFunc("POST /indexes/{uid}/documents", s.write(addDocuments))
+	mux.HandleFunc("PUT /indexes/{uid}/documents", s.write(updateDocuments))
+	mux.HandleFunc("POST /indexes/{uid}/documents/delete-batch", s.write(deleteDocuments))
+	mux.HandleFunc("DELETE /indexes/{uid}/documents", s.write(deleteAllDocuments))
+	mux.HandleFunc("GET /indexes/{uid}/documents/{id}", s.getDocument)
+	mux.HandleFunc("POST /indexes/{uid}/documents/fetch", s.fetchDocuments)
+	mux.HandleFunc("GET /indexes/{uid}/settings", s.getSettings)
+	mux.HandleFunc("PUT /indexes/{uid}/settings/{name}", s.write(updateSetting))
+	mux.HandleFunc("PATCH /indexes/{uid}/settings/{name}", s.write(updateSetting))
+	mux.HandleFunc("POST /indexes/{uid}/search", s.search)
+	mux.HandleFunc("POST /multi-search", s.multiSearch)
+	mux.HandleFunc("GET /tasks/{uid}", s.getTask)
+	mux.HandleFunc("GET /tasks", s.listTasks)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a client for Index on the server
+func (s *Server) Client() *client.Client {
+	return client.Open(s.URL, Index)
+}
+
+// Documents returns the documents of Index by ID
+func (s *Server) Documents() map[string]types.Hit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	documents := make(map[string]types.Hit)
+	if x, ok := s.indexes[Index]; ok {
+		for id, doc := range x.documents {
+			documents[id] = doc
+		}
+	}
+	return documents
+}
+
+// Searches returns the search requests received so far, including each
+// query of a multi-search
+func (s *Server) Searches() []types.SearchRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.searches)
+}
+
+// DocumentFilters returns the filters of the document fetches received so
+// far, empty for a fetch of every document
+func (s *Server) DocumentFilters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.fetches)
+}
+
+// Tasks returns the tasks enqueued so far, oldest first
+func (s *Server) Tasks() []meilisearch.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.tasks)
+}
+
+func reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// fail replies with a Meilisearch error
+func fail(w http.ResponseWriter, status int, code, message string) {
+	reply(w, status, map[string]string{
+		"message": message,
+		"code":    code,
+		"type":    "invalid_request",
+		"link":    "https://docs.meilisearch.com/errors#" + code,
+	})
+}
+
+// index returns the named index, creating it if create is set, as
+// Meilisearch does when documents are added to a missing index. The lock
+// must be held.
+func (s *Server) index(uid string, create bool) *index {
+	x, ok := s.indexes[uid]
+	if !ok && create {
+		x = &index{documents: make(map[string]types.Hit), settings: make(map[string]json.RawMessage)}
+		s.indexes[uid] = x
+	}
+	return x
+}
+
+// enqueue records a finished task and replies with its summary. The lock
+// must be held.
+func (s *Server) enqueue(w http.ResponseWriter, uid string, taskType meilisearch.TaskType, err error) {
+	now := time.Now().UTC()
+	task := meilisearch.Task{
+		UID:        int64(len(s.tasks)),
+		IndexUID:   uid,
+		Status:     meilisearch.TaskStatusSucceeded,
+		Type:       taskType,
+		EnqueuedAt: now,
+		StartedAt:  now,
+		FinishedAt: now,
+	}
+	if err != nil {
+		task.Status = meilisearch.TaskStatusFailed
+		task.Error.Message = err.Error()
+		task.Error.Code = "bad_request"
+	}
+	s.tasks = append(s.tasks, task)
+
+	reply(w, http.StatusAccepted, meilisearch.TaskInfo{
+		TaskUID:    task.UID,
+		IndexUID:   uid,
+		Status:     meilisearch.TaskStatusEnqueued,
+		Type:       taskType,
+		EnqueuedAt: now,
+	})
+}
+
+// writeFunc applies a request body to an index
+type writeFunc func(x *index, r *http.Request, body []byte) (meilisearch.TaskType, error)
+
+// write wraps a writeFunc in a handler that reads the body, applies it
+// under the lock and replies with a task
+func (s *Server) write(apply writeFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := readAll(r)
+		if err != nil {
+			fail(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		uid := r.PathValue("uid")
+		taskType, err := apply(s.index(uid, true), r, body)
+		s.enqueue(w, uid, taskType, err)
+	}
+}
+
+func readAll(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+	return io.ReadAll(r.Body)
+}
+
+func (s *Server) createIndex(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UID string `json:"uid"`
+	}
+	data, err := readAll(r)
+	if err == nil {
+		err = json.Unmarshal(data, &body)
+	}
+	if err != nil || body.UID == "" {
+		fail(w, http.StatusBadRequest, "missing_index_uid", "an index uid is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var exists error
+	if s.index(body.UID, false) != nil {
+		exists = fmt.Errorf("index `%s` already exists", body.UID)
+	}
+	s.index(body.UID, true)
+	s.enqueue(w, body.UID, meilisearch.TaskTypeIndexCreation, exists)
+}
+
+func decodeDocuments(body []byte) ([]types.Hit, error) {
+	var docs []types.Hit
+	if err := json.Unmarshal(body, &docs); err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if _, err := documentID(doc); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func documentID(doc types.Hit) (string, error) {
+	raw, ok := doc["id"]
+	if !ok {
+		return "", fmt.Errorf("document has no id")
+	}
+	var id string
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return strings.TrimSpace(string(raw)), nil
+	}
+	return id, nil
+}
+
+// put stores a document, keeping the position of one it replaces
+func (x *index) put(doc types.Hit) {
+	id, _ := documentID(doc)
+	if _, ok := x.documents[id]; !ok {
+		x.ids = append(x.ids, id)
+	}
+	x.documents[id] = doc
+}
+
+func addDocuments(x *index, _ *http.Request, body []byte) (meilisearch.TaskType, error) {
+	docs, err := decodeDocuments(body)
+	if err != nil {
+		return meilisearch.TaskTypeDocumentAdditionOrUpdate, err
+	}
+	for _, doc := range docs {
+		x.put(doc)
+	}
+	return meilisearch.TaskTypeDocumentAdditionOrUpdate, nil
+}
+
+func updateDocuments(x *index, _ *http.Request, body []byte) (meilisearch.TaskType, error) {
+	docs, err := decodeDocuments(body)
+	if err != nil {
+		return meilisearch.TaskTypeDocumentAdditionOrUpdate, err
+	}
+	for _, doc := range docs {
+		id, _ := documentID(doc)
+		merged := make(types.Hit)
+		for k, v := range x.documents[id] {
+			merged[k] = v
+		}
+		for k, v := range doc {
+			merged[k] = v
+		}
+		x.put(merged)
+	}
+	return meilisearch.TaskTypeDocumentAdditionOrUpdate, nil
+}
+
+func deleteDocuments(x *index, _ *http.Request, body []byte) (meilisearch.TaskType, error) {
+	var ids []string
+	if err := json.Unmarshal(body, &ids); err != nil {
+		return meilisearch.TaskTypeDocumentDeletion, err
+	}
+	for _, id := range ids {
+		delete(x.documents, id)
+	}
+	x.ids = slices.DeleteFunc(x.ids, func(id string) bool {
+		_, ok := x.documents[id]
+		return !ok
+	})
+	return meilisearch.TaskTypeDocumentDeletion, nil
+}
+
+func deleteAllDocuments(x *index, _ *http.Request, _ []byte) (meilisearch.TaskType, error) {
+	x.ids = nil
+	x.documents = make(map[string]types.Hit)
+	return meilisearch.TaskTypeDocumentDeletion, nil
+}
+
+// settingNames maps the setting routes to their keys in the settings object
+var settingNames = map[string]string{
+	"searchable-attributes": "searchableAttributes",
+	"filterable-attributes": "filterableAttributes",
+	"sortable-attributes":   "sortableAttributes",
+	"displayed-attributes":  "displayedAttributes",
+	"faceting":              "faceting",
+}
+
+func updateSetting(x *index, r *http.Request, body []byte) (meilisearch.TaskType, error) {
+	key, ok := settingNames[r.PathValue("name")]
+	if !ok {
+		return meilisearch.TaskTypeSettingsUpdate, fmt.Errorf("unknown setting %s", r.PathValue("name"))
+	}
+	if !json.Valid(body) {
+		return meilisearch.TaskTypeSettingsUpdate, fmt.Errorf("invalid %s", key)
+	}
+	x.settings[key] = json.RawMessage(body)
+	return meilisearch.TaskTypeSettingsUpdate, nil
+}
+
+func (s *Server) getSettings(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x := s.index(r.PathValue("uid"), false)
+	if x == nil {
+		fail(w, http.StatusNotFound, "index_not_found", "index not found")
+		return
+	}
+
+	// Unset settings have their Meilisearch defaults
+	settings := map[string]json.RawMessage{
+		"searchableAttributes": json.RawMessage(`["*"]`),
+		"filterableAttributes": json.RawMessage(`[]`),
+		"sortableAttributes":   json.RawMessage(`[]`),
+		"displayedAttributes":  json.RawMessage(`["*"]`),
+		"faceting":             json.RawMessage(`{"maxValuesPerFacet":100,"sortFacetValuesBy":{"*":"alpha"}}`),
+	}
+	for k, v := range x.settings {
+		settings[k] = v
+	}
+	reply(w, http.StatusOK, settings)
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := meilisearch.Stats{Indexes: make(map[string]meilisearch.StatsIndex)}
+	for uid, x := range s.indexes {
+		fields := make(map[string]int64)
+		var size int64
+		for _, doc := range x.documents {
+			for k, v := range doc {
+				fields[k]++
+				size += int64(len(v))
+			}
+		}
+		stats.Indexes[uid] = meilisearch.StatsIndex{
+			NumberOfDocuments: int64(len(x.documents)),
+			FieldDistribution: fields,
+			RawDocumentDbSize: size,
+		}
+		stats.DatabaseSize += size
+	}
+	reply(w, http.StatusOK, stats)
+}
+
+// project keeps the listed fields of a document; none keeps them all
+func project(doc types.Hit, fields []string) types.Hit {
+	if len(fields) == 0 || slices.Contains(fields, "*") {
+		return doc
+	}
+	projected := make(types.Hit)
+	for _, f := range fields {
+		if v, ok := doc[f]; ok {
+			projected[f] = v
+		}
+	}
+	return projected
+}
+
+func (s *Server) getDocument(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var doc types.Hit
+	if x := s.index(r.PathValue("uid"), false); x != nil {
+		doc = x.documents[r.PathValue("id")]
+	}
+	if doc == nil {
+		fail(w, http.StatusNotFound, "document_not_found", fmt.Sprintf("Document `%s` not found.", r.PathValue("id")))
+		return
+	}
+
+	var fields []string
+	if f := r.URL.Query().Get("fields"); f != "" {
+		fields = strings.Split(f, ",")
+	}
+	reply(w, http.StatusOK, project(doc, fields))
+}
+
+func (s *Server) fetchDocuments(w http.ResponseWriter, r *http.Request) {
+	var query meilisearch.DocumentsQuery
+	data, err := readAll(r)
+	if err == nil {
+		err = json.Unmarshal(data, &query)
+	}
+	if err != nil {
+		fail(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 20
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	filter, _ := query.Filter.(string)
+	s.fetches = append(s.fetches, filter)
+	x := s.index(r.PathValue("uid"), false)
+	if x == nil {
+		fail(w, http.StatusNotFound, "index_not_found", "index not found")
+		return
+	}
+
+	results := []types.Hit{}
+	for _, id := range page(x.ids, query.Offset, query.Limit) {
+		results = append(results, project(x.documents[id], query.Fields))
+	}
+	reply(w, http.StatusOK, map[string]any{
+		"results": results,
+		"offset":  query.Offset,
+		"limit":   query.Limit,
+		"total":   len(x.ids),
+	})
+}
+
+func page[T any](items []T, offset, limit int64) []T {
+	from := min(offset, int64(len(items)))
+	to := min(from+limit, int64(len(items)))
+	return items[from:to]
+}
+
+func (s *Server) getTask(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.Atoi(r.PathValue("uid"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil || uid < 0 || uid >= len(s.tasks) {
+		fail(w, http.StatusNotFound, "task_not_found", "task not found")
+		return
+	}
+	reply(w, http.StatusOK, s.tasks[uid])
+}
+
+// listTasks returns the tasks newest first, filtered by the indexUids and
+// statuses parameters
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
+	split := func(name string) []string {
+		if v := r.URL.Query().Get(name); v != "" {
+			return strings.Split(v, ",")
+		}
+		return nil
+	}
+	indexes, statuses := split("indexUids"), split("statuses")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := []meilisearch.Task{}
+	for _, task := range slices.Backward(s.tasks) {
+		if len(indexes) > 0 && !slices.Contains(indexes, task.IndexUID) {
+			continue
+		}
+		if len(statuses) > 0 && !slices.Contains(statuses, string(task.Status)) {
+			continue
+		}
+		results = append(results, task)
+	}
+	reply(w, http.StatusOK, map[string]any{
+		"results": results,
+		"total":   len(results),
+		"limit":   len(results),
+		"from":    0,
+		"next":    nil,
+	})
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	var request meilisearch.SearchRequest
+	data, err := readAll(r)
+	if err == nil {
+		err = json.Unmarshal(data, &request)
+	}
+	if err != nil {
+		fail(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response, err := s.run(r.PathValue("uid"), &request)
+	if err != nil {
+		fail(w, http.StatusNotFound, "index_not_found", err.Error())
+		return
+	}
+	reply(w, http.StatusOK, response)
+}
+
+func (s *Server) multiSearch(w http.ResponseWriter, r *http.Request) {
+	var request meilisearch.MultiSearchRequest
+	data, err := readAll(r)
+	if err == nil {
+		err = json.Unmarshal(data, &request)
+	}
+	if err != nil {
+		fail(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]*meilisearch.SearchResponse, len(request.Queries))
+	for i, query := range request.Queries {
+		if results[i], err = s.run(query.IndexUID, query); err != nil {
+			fail(w, http.StatusNotFound, "index_not_found", err.Error())
+			return
+		}
+	}
+	reply(w, http.StatusOK, map[string]any{"results": results})
+}
+
+// run records a search and answers it. The lock must be held.
+func (s *Server) run(uid string, request *meilisearch.SearchRequest) (*meilisearch.SearchResponse, error) {
+	filter, _ := request.Filter.(string)
+	s.searches = append(s.searches, types.SearchRequest{
+		Query:                 request.Query,
+		Filter:                filter,
+		Sort:                  request.Sort,
+		Offset:                request.Offset,
+		Limit:                 request.Limit,
+		Facets:                request.Facets,
+		AttributesToRetrieve:  request.AttributesToRetrieve,
+		AttributesToCrop:      request.AttributesToCrop,
+		CropLength:            request.CropLength,
+		CropMarker:            request.CropMarker,
+		AttributesToHighlight: request.AttributesToHighlight,
+		HighlightPreTag:       request.HighlightPreTag,
+		HighlightPostTag:      request.HighlightPostTag,
+		ShowRankingScore:      request.ShowRankingScore,
+		ShowMatchesPosition:   request.ShowMatchesPosition,
+	})
+
+	x := s.index(uid, false)
+	if x == nil {
+		return nil, fmt.Errorf("index `%s` not found", uid)
+	}
+
+	words, excluded := queryWords(request.Query)
+	var matched []types.Hit
+	for _, id := range x.ids {
+		doc := x.documents[id]
+		if matches(doc, words, excluded) {
+			matched = append(matched, doc)
+		}
+	}
+	if len(request.Sort) > 0 {
+		slices.SortStableFunc(matched, func(a, b types.Hit) int {
+			return compareBy(a, b, request.Sort)
+		})
+	}
+
+	limit := request.Limit
+	if limit == 0 {
+		limit = 20
+	}
+	response := &meilisearch.SearchResponse{
+		Query:              request.Query,
+		Offset:             request.Offset,
+		Limit:              limit,
+		EstimatedTotalHits: int64(len(matched)),
+	}
+	displayed := x.displayed()
+	for _, doc := range page(matched, request.Offset, limit) {
+		response.Hits = append(response.Hits, hit(project(doc, displayed), request, words))
+	}
+	if len(request.Facets) > 0 {
+		distribution, err := json.Marshal(facetDistribution(matched, request.Facets))
+		if err != nil {
+			return nil, err
+		}
+		response.FacetDistribution = distribution
+	}
+	return response, nil
+}
+
+// queryWords splits a query into lowercase words to match and words
+// excluded with a leading -. Quotes are dropped, so phrase words match
+// anywhere.
+func queryWords(query string) (words, excluded []string) {
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if w, ok := strings.CutPrefix(word, "-"); ok {
+			if w = strings.Trim(w, `"`); w != "" {
+				excluded = append(excluded, w)
+			}
+			continue
+		}
+		if word = strings.Trim(word, `"`); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words, excluded
+}
+
+// text returns the searchable string values of a document, lowercased
+func text(doc types.Hit) map[string]string {
+	values := make(map[string]string)
+	for _, attribute := range types.SearchableAttributes {
+		var value string
+		if json.Unmarshal(doc[attribute], &value) == nil {
+			values[attribute] = strings.ToLower(value)
+		}
+	}
+	return values
+}
+
+// matches reports whether each word, and none of the excluded ones, is in
+// a searchable attribute of the document
+func matches(doc types.Hit, words, excluded []string) bool {
+	values := text(doc)
+	contains := func(word string) bool {
+		for _, v := range values {
+			if strings.Contains(v, word) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, word := range excluded {
+		if contains(word) {
+			return false
+		}
+	}
+	for _, word := range words {
+		if !contains(word) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareBy orders documents by "attribute:asc|desc" keys. Numbers compare
+// by value, anything else as JSON text.
+func compareBy(a, b types.Hit, keys []string) int {
+	for _, key := range keys {
+		attribute, direction, _ := strings.Cut(key, ":")
+		var c int
+		var x, y float64
+		if json.Unmarshal(a[attribute], &x) == nil && json.Unmarshal(b[attribute], &y) == nil {
+			c = cmp.Compare(x, y)
+		} else {
+			c = strings.Compare(string(a[attribute]), string(b[attribute]))
+		}
+		if direction == "desc" {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// hit formats a matched document as requested
+func hit(doc types.Hit, request *meilisearch.SearchRequest, words []string) meilisearch.Hit {
+	h := make(meilisearch.Hit)
+	for k, v := range project(doc, request.AttributesToRetrieve) {
+		h[k] = v
+	}
+
+	// Formatted attributes are returned whole, neither cropped nor marked
+	if formatted := append(slices.Clone(request.AttributesToCrop), request.AttributesToHighlight...); len(formatted) > 0 {
+		h["_formatted"], _ = json.Marshal(project(doc, formatted))
+	}
+	if request.ShowRankingScore {
+		h["_rankingScore"] = json.RawMessage(`1`)
+	}
+	if request.ShowMatchesPosition {
+		type position struct {
+			Start  int `json:"start"`
+			Length int `json:"length"`
+		}
+		positions := make(map[string][]position)
+		for attribute, value := range text(doc) {
+			for _, word := range words {
+				if i := strings.Index(value, word); i >= 0 {
+					positions[attribute] = append(positions[attribute], position{Start: i, Length: len(word)})
+				}
+			}
+		}
+		h["_matchesPosition"], _ = json.Marshal(positions)
+	}
+	return h
+}
+
+// facetDistribution counts the values of each facet, counting each element
+// of an array
+func facetDistribution(docs []types.Hit, facets []string) map[string]map[string]int64 {
+	distribution := make(map[string]map[string]int64)
+	for _, facet := range facets {
+		counts := make(map[string]int64)
+		for _, doc := range docs {
+			raw, ok := doc[facet]
+			if !ok {
+				continue
+			}
+			var values []any
+			if json.Unmarshal(raw, &values) != nil {
+				var value any
+				json.Unmarshal(raw, &value)
+				values = []any{value}
+			}
+			for _, v := range values {
+				counts[fmt.Sprint(v)]++
+			}
+		}
+		distribution[facet] = counts
+	}
+	return distribution
+}
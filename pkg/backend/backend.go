@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"path/filepath"
+
+	"github.com/sahil485/memex/pkg/client"
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/embedded"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// SearchBackend stores the documents of the index and searches them. Writes
+// return once the change is visible to searches.
+type SearchBackend interface {
+	// Name is config.BackendMeilisearch or config.BackendEmbedded
+	Name() string
+
+	// Location is the URL of the server or the directory of the index
+	Location() string
+
+	// Healthy reports whether the backend can be reached
+	Healthy() bool
+
+	// Version describes the engine, e.g. the Meilisearch release
+	Version() (string, error)
+
+	// Init creates the index if it does not exist and applies its settings
+	Init() error
+
+	// ApplySettings sets the attributes to search, filter and sort on, and
+	// CheckSettings describes how the index differs from them
+	ApplySettings() error
+	CheckSettings() ([]string, error)
+
+	Stats() (*types.IndexStats, error)
+
+	// AddDocuments replaces documents by ID; UpdateDocuments merges the
+	// fields of partial documents into the stored ones
+	AddDocuments(docs any) error
+	UpdateDocuments(docs any) error
+
+	DeleteDocuments(ids []string) error
+	DeleteAllDocuments() error
+
+	// GetDocument decodes the requested fields of a document into dst,
+	// reporting false if no document has the ID
+	GetDocument(id string, fields []string, dst any) (bool, error)
+
+	// EachDocument calls fn with the requested fields of every document
+	// matching filter, or of every document if filter is empty
+	EachDocument(filter string, fields []string, fn func(hit types.Hit) error) error
+
+	Search(request *types.SearchRequest) (*types.SearchResponse, error)
+	MultiSearch(requests ...*types.SearchRequest) ([]types.SearchResponse, error)
+}
+
+// New returns the backend selected by the configuration
+func New() SearchBackend {
+	cfg := config.Current()
+	if cfg.Backend == config.BackendEmbedded {
+		return embedded.Open(filepath.Join(cfg.EmbeddedPath, cfg.IndexName))
+	}
+	return client.New()
+}
+
+// Embedded reports whether the configuration selects the embedded backend,
+// which needs no Meilisearch server
+func Embedded() bool {
+	return config.Current().Backend == config.BackendEmbedded
+}
@@ -1,32 +1,170 @@
 package client
 
 import (
-	"sync"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"time"
 
 	meilisearch "github.com/meilisearch/meilisearch-go"
 	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/engine"
+	"github.com/sahil485/memex/pkg/types"
 )
 
+// Client is the Meilisearch search backend
 type Client struct {
-	ms meilisearch.ServiceManager
+	ms    meilisearch.ServiceManager
+	url   string
+	index string
 }
 
-var (
-	instance *Client
-	once     sync.Once
-)
+// httpClient is shared by every Client, so connections to the server are
+// reused across calls to New
+var httpClient = &http.Client{}
 
+// New returns a client for the configured index on the current Meilisearch
+// endpoint. The endpoint is re-resolved on every call, so a server that
+// restarts on a different port is picked up without restarting the caller.
 func New() *Client {
-	once.Do(func() {
-		ms := meilisearch.New(config.MeilisearchURL)
-		instance = &Client{ms: ms}
-	})
-	return instance
+	return Open(engine.Endpoint(), config.Current().IndexName)
+}
+
+// Open returns a client for the named index on the server at url
+func Open(url, index string) *Client {
+	return &Client{
+		ms:    meilisearch.New(url, meilisearch.WithCustomClient(httpClient)),
+		url:   url,
+		index: index,
+	}
+}
+
+// Name identifies the backend
+func (c *Client) Name() string {
+	return config.BackendMeilisearch
+}
+
+// Location returns the endpoint the client talks to
+func (c *Client) Location() string {
+	return c.url
+}
+
+// Healthy reports whether Meilisearch answers at the endpoint
+func (c *Client) Healthy() bool {
+	return engine.Healthy(c.url)
 }
 
 func (c *Client) GetIndex() meilisearch.IndexManager {
-	return c.ms.Index(config.IndexName)
+	return c.ms.Index(c.index)
+}
+
+// Search runs a single search against the index
+func (c *Client) Search(request *types.SearchRequest) (*types.SearchResponse, error) {
+	response, err := c.GetIndex().Search(request.Query, searchRequest(request))
+	if err != nil {
+		return nil, err
+	}
+	return searchResponse(response)
+}
+
+// MultiSearch runs several searches against the index in one request
+func (c *Client) MultiSearch(requests ...*types.SearchRequest) ([]types.SearchResponse, error) {
+	queries := make([]*meilisearch.SearchRequest, len(requests))
+	for i, r := range requests {
+		queries[i] = searchRequest(r)
+		queries[i].IndexUID = c.index
+	}
+
+	multi, err := c.ms.MultiSearch(&meilisearch.MultiSearchRequest{Queries: queries})
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]types.SearchResponse, len(multi.Results))
+	for i := range multi.Results {
+		response, err := searchResponse(&multi.Results[i])
+		if err != nil {
+			return nil, err
+		}
+		responses[i] = *response
+	}
+	return responses, nil
+}
+
+func searchRequest(r *types.SearchRequest) *meilisearch.SearchRequest {
+	request := &meilisearch.SearchRequest{
+		Query:                 r.Query,
+		Sort:                  r.Sort,
+		Offset:                r.Offset,
+		Limit:                 r.Limit,
+		Facets:                r.Facets,
+		AttributesToRetrieve:  r.AttributesToRetrieve,
+		AttributesToCrop:      r.AttributesToCrop,
+		CropLength:            r.CropLength,
+		CropMarker:            r.CropMarker,
+		AttributesToHighlight: r.AttributesToHighlight,
+		HighlightPreTag:       r.HighlightPreTag,
+		HighlightPostTag:      r.HighlightPostTag,
+		ShowRankingScore:      r.ShowRankingScore,
+		ShowMatchesPosition:   r.ShowMatchesPosition,
+	}
+	// An empty filter string is rejected, so it is left out
+	if r.Filter != "" {
+		request.Filter = r.Filter
+	}
+	return request
+}
+
+func searchResponse(r *meilisearch.SearchResponse) (*types.SearchResponse, error) {
+	response := &types.SearchResponse{
+		Query:              r.Query,
+		Hits:               make([]types.Hit, len(r.Hits)),
+		EstimatedTotalHits: r.EstimatedTotalHits,
+		ProcessingTimeMs:   r.ProcessingTimeMs,
+	}
+	for i, hit := range r.Hits {
+		response.Hits[i] = types.Hit(hit)
+	}
+	if len(r.FacetDistribution) > 0 {
+		if err := json.Unmarshal(r.FacetDistribution, &response.FacetDistribution); err != nil {
+			return nil, fmt.Errorf("failed to decode facets: %w", err)
+		}
+	}
+	return response, nil
+}
+
+// Version returns the version of the Meilisearch server
+func (c *Client) Version() (string, error) {
+	version, err := c.ms.Version()
+	if err != nil {
+		return "", err
+	}
+	return version.PkgVersion, nil
+}
+
+// Stats returns the database size and the statistics of the index
+func (c *Client) Stats() (*types.IndexStats, error) {
+	stats, err := c.ms.GetStats()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &types.IndexStats{DatabaseSize: stats.DatabaseSize}
+	index, ok := stats.Indexes[c.index]
+	if !ok {
+		return s, nil
+	}
+	s.Exists = true
+	s.IsIndexing = index.IsIndexing
+	s.Documents = index.NumberOfDocuments
+	s.DocumentsSize = index.RawDocumentDbSize
+	s.FieldDistribution = index.FieldDistribution
+	return s, nil
+}
+
+// Tasks lists the tasks of the index that match query
+func (c *Client) Tasks(query *meilisearch.TasksQuery) (*meilisearch.TaskResult, error) {
+	query.IndexUIDS = []string{c.index}
+	return c.ms.GetTasks(query)
 }
 
 func (c *Client) CreateIndex(indexName string) (*meilisearch.TaskInfo, error) {
@@ -39,3 +177,20 @@ func (c *Client) WaitForTask(taskUID int64) (*meilisearch.Task, error) {
 	// Wait up to 1 seconds for the task to complete
 	return c.ms.WaitForTask(taskUID, 1*time.Second)
 }
+
+// wait blocks until the enqueued task has finished, returning its error if
+// it failed
+func (c *Client) wait(task *meilisearch.TaskInfo, err error) error {
+	if err != nil {
+		return err
+	}
+
+	taskInfo, err := c.WaitForTask(task.TaskUID)
+	if err != nil {
+		return fmt.Errorf("failed to wait for task: %w", err)
+	}
+	if taskInfo.Status == meilisearch.TaskStatusFailed {
+		return fmt.Errorf("%s task failed: %s", taskInfo.Type, taskInfo.Error.Message)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+
+	meilisearch "github.com/meilisearch/meilisearch-go"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// documentPageSize is how many documents are fetched per request when
+// walking the whole index
+const documentPageSize = 1000
+
+// AddDocuments adds documents, replacing any stored with the same ID, and
+// waits until they are indexed
+func (c *Client) AddDocuments(docs any) error {
+	return c.wait(c.GetIndex().AddDocuments(docs, nil))
+}
+
+// UpdateDocuments merges partial documents into the stored ones and waits
+// until they are indexed
+func (c *Client) UpdateDocuments(docs any) error {
+	return c.wait(c.GetIndex().UpdateDocuments(docs, nil))
+}
+
+// DeleteDocuments removes documents by ID and waits until they are gone
+func (c *Client) DeleteDocuments(ids []string) error {
+	return c.wait(c.GetIndex().DeleteDocuments(ids, nil))
+}
+
+// DeleteAllDocuments empties the index, keeping its settings
+func (c *Client) DeleteAllDocuments() error {
+	return c.wait(c.GetIndex().DeleteAllDocuments(nil))
+}
+
+// GetDocument decodes the requested fields of a document into dst. It
+// reports false if no document has the ID.
+func (c *Client) GetDocument(id string, fields []string, dst any) (bool, error) {
+	err := c.GetIndex().GetDocument(id, &meilisearch.DocumentQuery{Fields: fields}, dst)
+	var apiErr *meilisearch.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// EachDocument pages through every document in the index matching filter,
+// or every document if it is empty, retrieving only the requested fields,
+// and calls fn for each one
+func (c *Client) EachDocument(filter string, fields []string, fn func(hit types.Hit) error) error {
+	index := c.GetIndex()
+
+	var offset int64
+	for {
+		query := &meilisearch.DocumentsQuery{
+			Offset: offset,
+			Limit:  documentPageSize,
+			Fields: fields,
+		}
+		if filter != "" {
+			query.Filter = filter
+		}
+		var page meilisearch.DocumentsResult
+		err := index.GetDocuments(query, &page)
+		if err != nil {
+			return err
+		}
+
+		for _, hit := range page.Results {
+			if err := fn(types.Hit(hit)); err != nil {
+				return err
+			}
+		}
+
+		offset += int64(len(page.Results))
+		if len(page.Results) == 0 || offset >= page.Total {
+			return nil
+		}
+	}
+}
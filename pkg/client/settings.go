@@ -1,51 +1,101 @@
 package client
 
-func ConfigureIndexSettings() error {
-	c := New()
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	meilisearch "github.com/meilisearch/meilisearch-go"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// ApplySettings sets the searchable, filterable, sortable and displayed
+// attributes of the index and how its facets are counted, waiting until
+// each change is in effect
+func (c *Client) ApplySettings() error {
 	index := c.GetIndex()
 
-	_, err := index.UpdateSearchableAttributes(&[]string{
-		"name",
-		"title",
-		"content",
-		"tags",
-		"path",
-	})
+	err := c.wait(index.UpdateSearchableAttributes(&types.SearchableAttributes))
+	if err != nil {
+		return err
+	}
+
+	filterable := make([]interface{}, len(types.FilterableAttributes))
+	for i, a := range types.FilterableAttributes {
+		filterable[i] = a
+	}
+	err = c.wait(index.UpdateFilterableAttributes(&filterable))
 	if err != nil {
 		return err
 	}
 
-	_, err = index.UpdateFilterableAttributes(&[]interface{}{
-		"ext",
-		"dir",
-		"mod_time",
-		"size",
-		"tags",
-	})
+	err = c.wait(index.UpdateSortableAttributes(&types.SortableAttributes))
 	if err != nil {
 		return err
 	}
 
-	_, err = index.UpdateSortableAttributes(&[]string{
-		"mod_time",
-		"size",
-		"name",
-	})
+	// Facet values are ranked by count, so the most common ones are kept
+	// when there are more than MaxValuesPerFacet
+	err = c.wait(index.UpdateFaceting(&meilisearch.Faceting{
+		MaxValuesPerFacet: types.MaxValuesPerFacet,
+		SortFacetValuesBy: map[string]meilisearch.SortFacetType{
+			"*": meilisearch.SortFacetTypeCount,
+		},
+	}))
 	if err != nil {
 		return err
 	}
 
-	_, err = index.UpdateDisplayedAttributes(&[]string{
-		"id",
-		"path",
-		"name",
-		"dir",
-		"ext",
-		"size",
-		"mod_time",
-		"title",
-		"tags",
-	})
+	displayed := types.DisplayedAttributes()
+	return c.wait(index.UpdateDisplayedAttributes(&displayed))
+}
 
-	return err
+// CheckSettings compares the index settings with those applied by
+// ApplySettings and describes each difference. Searchable attributes are
+// compared in order, since the order ranks matches.
+func (c *Client) CheckSettings() ([]string, error) {
+	settings, err := c.GetIndex().GetSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	if !slices.Equal(settings.SearchableAttributes, types.SearchableAttributes) {
+		problems = append(problems, fmt.Sprintf("searchable attributes are %v, expected %v",
+			settings.SearchableAttributes, types.SearchableAttributes))
+	}
+	sets := []struct {
+		name     string
+		actual   []string
+		expected []string
+	}{
+		{"filterable", settings.FilterableAttributes, types.FilterableAttributes},
+		{"sortable", settings.SortableAttributes, types.SortableAttributes},
+		{"displayed", settings.DisplayedAttributes, types.DisplayedAttributes()},
+	}
+	for _, set := range sets {
+		if missing := missingFrom(set.actual, set.expected); len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("%s attributes lack %s", set.name, strings.Join(missing, ", ")))
+		}
+	}
+	if f := settings.Faceting; f == nil || f.MaxValuesPerFacet != types.MaxValuesPerFacet ||
+		f.SortFacetValuesBy["*"] != meilisearch.SortFacetTypeCount {
+		problems = append(problems, fmt.Sprintf("facet values are not limited to %d sorted by count", types.MaxValuesPerFacet))
+	}
+	return problems, nil
+}
+
+// missingFrom returns the expected values that are not in actual. A "*"
+// wildcard in actual includes everything.
+func missingFrom(actual, expected []string) []string {
+	if slices.Contains(actual, "*") {
+		return nil
+	}
+	var missing []string
+	for _, v := range expected {
+		if !slices.Contains(actual, v) {
+			missing = append(missing, v)
+		}
+	}
+	return missing
 }
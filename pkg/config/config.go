@@ -1,13 +1,43 @@
 package config
 
+// Built-in defaults, used when neither the config file nor the environment
+// overrides them. See Load.
 const (
-	MeilisearchURL  = "http://127.0.0.1:58273"
-	MeilisearchPort = 58273
-	IndexName       = "files"
+	DefaultMeilisearchHost = "127.0.0.1"
+	DefaultMeilisearchPort = 58273
+	DefaultIndexName       = "files"
 )
 
-// IgnoredDirectories contains directory names that should be skipped during indexing
-var IgnoredDirectories = map[string]bool{
+// Search backends the backend setting selects between
+const (
+	// BackendMeilisearch uses a Meilisearch server, managed by pkg/engine
+	// or external
+	BackendMeilisearch = "meilisearch"
+
+	// BackendEmbedded keeps the index in files under EmbeddedPath, with no
+	// server to run
+	BackendEmbedded = "embedded"
+)
+
+// Upload batching defaults used by the indexer
+const (
+	// DefaultBatchSize is the maximum number of documents per upload
+	DefaultBatchSize = 1000
+
+	// DefaultBatchBytes is the approximate maximum payload size per upload,
+	// kept well below Meilisearch's 100MB request limit
+	DefaultBatchBytes = 32 << 20
+
+	// DefaultMaxInFlight is how many upload tasks may be pending at once
+	DefaultMaxInFlight = 4
+)
+
+// DefaultCropLength is the number of words shown around a match in result
+// snippets
+const DefaultCropLength = 30
+
+// DefaultIgnoredDirectories contains directory names that should be skipped during indexing
+var DefaultIgnoredDirectories = map[string]bool{
 	// macOS system directories
 	"Library":      true,
 	"Applications": true,
@@ -65,5 +95,5 @@ var IgnoredDirectories = map[string]bool{
 }
 
 func ShouldIgnoreDirectory(dirName string) bool {
-	return IgnoredDirectories[dirName]
+	return Current().ShouldIgnoreDirectory(dirName)
 }
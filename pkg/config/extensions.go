@@ -1,7 +1,7 @@
 package config
 
-// AllowedExtensions contains all file extensions that should be indexed
-var AllowedExtensions = map[string]bool{
+// DefaultAllowedExtensions contains all file extensions that should be indexed
+var DefaultAllowedExtensions = map[string]bool{
 	// Plain text
 	".txt": true,
 	".md":  true,
@@ -58,14 +58,16 @@ var AllowedExtensions = map[string]bool{
 	// Database
 	".sql": true,
 
-	// Documents (metadata only)
+	// Documents
 	".pdf":  true,
 	".docx": true,
 	".xlsx": true,
 	".pptx": true,
-	".doc":  true,
-	".xls":  true,
-	".ppt":  true,
+
+	// Documents (metadata only)
+	".doc": true,
+	".xls": true,
+	".ppt": true,
 
 	// Data files (metadata only)
 	".csv": true,
@@ -92,20 +94,16 @@ var AllowedExtensions = map[string]bool{
 }
 
 func IsAllowedExtension(ext string) bool {
-	return AllowedExtensions[ext]
+	return Current().IsAllowedExtension(ext)
 }
 
-// IgnoredContentExtensions contains file extensions that should be indexed
+// DefaultIgnoredContentExtensions contains file extensions that should be indexed
 // (for metadata) but their content should NOT be read/indexed
-var IgnoredContentExtensions = map[string]bool{
+var DefaultIgnoredContentExtensions = map[string]bool{
 	// Documents
-	".pdf":  true,
-	".docx": true,
-	".xlsx": true,
-	".pptx": true,
-	".doc":  true,
-	".xls":  true,
-	".ppt":  true,
+	".doc": true,
+	".xls": true,
+	".ppt": true,
 
 	// Data files
 	".csv": true,
@@ -132,5 +130,5 @@ var IgnoredContentExtensions = map[string]bool{
 }
 
 func ShouldIgnoreContent(ext string) bool {
-	return IgnoredContentExtensions[ext]
+	return Current().ShouldIgnoreContent(ext)
 }
\ No newline at end of file
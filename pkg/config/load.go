@@ -0,0 +1,499 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the user's configuration: the built-in defaults, overlaid with
+// ~/.memex/config.toml (or $MEMEX_CONFIG) and then environment variables.
+type Config struct {
+	// Path is the file the configuration was loaded from, or empty if no
+	// file exists and only defaults and environment variables apply
+	Path string
+
+	// Backend is BackendMeilisearch or BackendEmbedded
+	Backend string
+
+	// EmbeddedPath is the directory holding the embedded backend's indexes
+	EmbeddedPath string
+
+	// MeilisearchURL points the CLI and app at an externally managed
+	// server. When empty, the server launched by pkg/engine is used.
+	MeilisearchURL string
+	IndexName      string
+
+	// Where and how pkg/engine runs the managed Meilisearch server
+	MeilisearchHost   string
+	MeilisearchPort   int
+	MeilisearchBinary string
+	MeilisearchDBPath string
+
+	BatchSize   int
+	BatchBytes  int
+	MaxInFlight int
+
+	// Workers is the number of files read concurrently; 0 means one per CPU
+	Workers int
+
+	IgnoredDirectories       map[string]bool
+	AllowedExtensions        map[string]bool
+	IgnoredContentExtensions map[string]bool
+
+	// CropLength is the number of words kept around the best match in a
+	// result snippet
+	CropLength int
+
+	// Markers placed around matched words in snippets printed by the CLI.
+	// When both are empty the CLI colours matches on a terminal.
+	HighlightPreTag  string
+	HighlightPostTag string
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	dir := Dir()
+
+	return &Config{
+		Backend:                  BackendMeilisearch,
+		EmbeddedPath:             filepath.Join(dir, "index"),
+		IndexName:                DefaultIndexName,
+		MeilisearchHost:          DefaultMeilisearchHost,
+		MeilisearchPort:          DefaultMeilisearchPort,
+		MeilisearchBinary:        filepath.Join(dir, "meilisearch"),
+		MeilisearchDBPath:        filepath.Join(dir, "data.ms"),
+		BatchSize:                DefaultBatchSize,
+		BatchBytes:               DefaultBatchBytes,
+		MaxInFlight:              DefaultMaxInFlight,
+		IgnoredDirectories:       copySet(DefaultIgnoredDirectories),
+		AllowedExtensions:        copySet(DefaultAllowedExtensions),
+		IgnoredContentExtensions: copySet(DefaultIgnoredContentExtensions),
+		CropLength:               DefaultCropLength,
+	}
+}
+
+func (c *Config) ShouldIgnoreDirectory(dirName string) bool {
+	return c.IgnoredDirectories[dirName]
+}
+
+func (c *Config) IsAllowedExtension(ext string) bool {
+	return c.AllowedExtensions[ext]
+}
+
+func (c *Config) ShouldIgnoreContent(ext string) bool {
+	return c.IgnoredContentExtensions[ext]
+}
+
+var (
+	current   = Default()
+	currentMu sync.RWMutex
+)
+
+// Current returns the configuration in use. It is the built-in default
+// until Init or Use is called.
+func Current() *Config {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	return current
+}
+
+// Use replaces the configuration in use
+func Use(c *Config) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = c
+}
+
+// Init loads the configuration from Path and makes it current
+func Init() error {
+	c, err := Load(Path())
+	if err != nil {
+		return err
+	}
+	Use(c)
+	return nil
+}
+
+// Dir returns the memex state directory, ~/.memex
+func Dir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".memex"
+	}
+	return filepath.Join(home, ".memex")
+}
+
+// Path returns $MEMEX_CONFIG if set, otherwise ~/.memex/config.toml
+func Path() string {
+	if p := os.Getenv("MEMEX_CONFIG"); p != "" {
+		return p
+	}
+	return filepath.Join(Dir(), "config.toml")
+}
+
+// fileConfig mirrors the layout of config.toml. Fields use validating types
+// so that bad values are reported with the line they appear on.
+type fileConfig struct {
+	Backend *backend `toml:"backend"`
+
+	Embedded struct {
+		Path *filePath `toml:"path"`
+	} `toml:"embedded"`
+
+	Meilisearch struct {
+		URL    *httpURL  `toml:"url"`
+		Index  *name     `toml:"index"`
+		Host   *name     `toml:"host"`
+		Port   *port     `toml:"port"`
+		Binary *filePath `toml:"binary"`
+		DBPath *filePath `toml:"db_path"`
+	} `toml:"meilisearch"`
+
+	Indexing struct {
+		BatchSize   *positiveInt `toml:"batch_size"`
+		BatchBytes  *positiveInt `toml:"batch_bytes"`
+		MaxInFlight *positiveInt `toml:"max_in_flight"`
+		Workers     *positiveInt `toml:"workers"`
+
+		// Each list replaces the built-in one; the extra_ variant adds to it
+		IgnoredDirectories            *[]name      `toml:"ignored_directories"`
+		ExtraIgnoredDirectories       []name       `toml:"extra_ignored_directories"`
+		AllowedExtensions             *[]extension `toml:"allowed_extensions"`
+		ExtraAllowedExtensions        []extension  `toml:"extra_allowed_extensions"`
+		IgnoredContentExtensions      *[]extension `toml:"ignored_content_extensions"`
+		ExtraIgnoredContentExtensions []extension  `toml:"extra_ignored_content_extensions"`
+	} `toml:"indexing"`
+
+	Search struct {
+		CropLength       *positiveInt `toml:"crop_length"`
+		HighlightPreTag  *string      `toml:"highlight_pre_tag"`
+		HighlightPostTag *string      `toml:"highlight_post_tag"`
+	} `toml:"search"`
+}
+
+// Load reads the configuration file at path and applies environment
+// overrides. A missing file is not an error.
+func Load(path string) (*Config, error) {
+	c := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err == nil {
+		c.Path = path
+		if err := c.applyFile(path, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Config) applyFile(path string, data []byte) error {
+	var f fileConfig
+
+	md, err := toml.Decode(string(data), &f)
+	if err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			if perr.LastKey != "" {
+				return fmt.Errorf("%s:%d: %s: %s", path, perr.Position.Line, perr.LastKey, perr.Message)
+			}
+			return fmt.Errorf("%s:%d: %s", path, perr.Position.Line, perr.Message)
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		key := undecoded[0]
+		return fmt.Errorf("%s:%d: unknown key %q", path, keyLine(data, key), key.String())
+	}
+
+	if f.Backend != nil {
+		c.Backend = string(*f.Backend)
+	}
+	if f.Embedded.Path != nil {
+		c.EmbeddedPath = string(*f.Embedded.Path)
+	}
+
+	m := f.Meilisearch
+	if m.URL != nil {
+		c.MeilisearchURL = string(*m.URL)
+	}
+	if m.Index != nil {
+		c.IndexName = string(*m.Index)
+	}
+	if m.Host != nil {
+		c.MeilisearchHost = string(*m.Host)
+	}
+	if m.Port != nil {
+		c.MeilisearchPort = int(*m.Port)
+	}
+	if m.Binary != nil {
+		c.MeilisearchBinary = string(*m.Binary)
+	}
+	if m.DBPath != nil {
+		c.MeilisearchDBPath = string(*m.DBPath)
+	}
+
+	ix := f.Indexing
+	if ix.BatchSize != nil {
+		c.BatchSize = int(*ix.BatchSize)
+	}
+	if ix.BatchBytes != nil {
+		c.BatchBytes = int(*ix.BatchBytes)
+	}
+	if ix.MaxInFlight != nil {
+		c.MaxInFlight = int(*ix.MaxInFlight)
+	}
+	if ix.Workers != nil {
+		c.Workers = int(*ix.Workers)
+	}
+
+	c.IgnoredDirectories = mergeSet(c.IgnoredDirectories, ix.IgnoredDirectories, ix.ExtraIgnoredDirectories)
+	c.AllowedExtensions = mergeSet(c.AllowedExtensions, ix.AllowedExtensions, ix.ExtraAllowedExtensions)
+	c.IgnoredContentExtensions = mergeSet(c.IgnoredContentExtensions, ix.IgnoredContentExtensions, ix.ExtraIgnoredContentExtensions)
+
+	sr := f.Search
+	if sr.CropLength != nil {
+		c.CropLength = int(*sr.CropLength)
+	}
+	if sr.HighlightPreTag != nil {
+		c.HighlightPreTag = *sr.HighlightPreTag
+	}
+	if sr.HighlightPostTag != nil {
+		c.HighlightPostTag = *sr.HighlightPostTag
+	}
+
+	return nil
+}
+
+// SetURL points the configuration at an external Meilisearch server. The
+// URL is validated in the same way as MEMEX_URL.
+func (c *Config) SetURL(raw string) error {
+	var u httpURL
+	if err := u.UnmarshalText([]byte(raw)); err != nil {
+		return err
+	}
+	c.MeilisearchURL = string(u)
+	return nil
+}
+
+// applyEnv overrides settings from MEMEX_* environment variables
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("MEMEX_BACKEND"); v != "" {
+		var b backend
+		if err := b.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("MEMEX_BACKEND: %w", err)
+		}
+		c.Backend = string(b)
+	}
+	if v := os.Getenv("MEMEX_URL"); v != "" {
+		var u httpURL
+		if err := u.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("MEMEX_URL: %w", err)
+		}
+		c.MeilisearchURL = string(u)
+	}
+	if v := os.Getenv("MEMEX_INDEX"); v != "" {
+		var n name
+		if err := n.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("MEMEX_INDEX: %w", err)
+		}
+		c.IndexName = string(n)
+	}
+	if v := os.Getenv("MEMEX_PORT"); v != "" {
+		var p port
+		if err := p.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("MEMEX_PORT: %w", err)
+		}
+		c.MeilisearchPort = int(p)
+	}
+
+	ints := []struct {
+		env string
+		dst *int
+	}{
+		{"MEMEX_BATCH_SIZE", &c.BatchSize},
+		{"MEMEX_BATCH_BYTES", &c.BatchBytes},
+		{"MEMEX_MAX_IN_FLIGHT", &c.MaxInFlight},
+		{"MEMEX_WORKERS", &c.Workers},
+	}
+	for _, i := range ints {
+		v := os.Getenv(i.env)
+		if v == "" {
+			continue
+		}
+		var n positiveInt
+		if err := n.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("%s: %w", i.env, err)
+		}
+		*i.dst = int(n)
+	}
+
+	return nil
+}
+
+// httpURL is an absolute http or https URL
+type httpURL string
+
+func (u *httpURL) UnmarshalText(text []byte) error {
+	parsed, err := url.Parse(string(text))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", text)
+	}
+	*u = httpURL(strings.TrimSuffix(string(text), "/"))
+	return nil
+}
+
+// backend is the name of a search backend
+type backend string
+
+func (b *backend) UnmarshalText(text []byte) error {
+	s := strings.ToLower(strings.TrimSpace(string(text)))
+	if s != BackendMeilisearch && s != BackendEmbedded {
+		return fmt.Errorf("must be %q or %q, got %q", BackendMeilisearch, BackendEmbedded, text)
+	}
+	*b = backend(s)
+	return nil
+}
+
+// positiveInt is an integer greater than zero
+type positiveInt int
+
+func (n *positiveInt) UnmarshalText(text []byte) error {
+	v, err := strconv.Atoi(string(text))
+	if err != nil || v < 1 {
+		return fmt.Errorf("must be a positive integer, got %s", text)
+	}
+	*n = positiveInt(v)
+	return nil
+}
+
+// port is a TCP port number
+type port int
+
+func (p *port) UnmarshalText(text []byte) error {
+	v, err := strconv.Atoi(string(text))
+	if err != nil || v < 1 || v > 65535 {
+		return fmt.Errorf("must be a port between 1 and 65535, got %s", text)
+	}
+	*p = port(v)
+	return nil
+}
+
+// filePath is a path with a leading ~/ expanded to the home directory
+type filePath string
+
+func (p *filePath) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		return fmt.Errorf("path must not be empty")
+	}
+	if strings.HasPrefix(s, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		s = filepath.Join(home, s[2:])
+	}
+	*p = filePath(s)
+	return nil
+}
+
+// name is a non-empty string without path separators
+type name string
+
+func (n *name) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" || strings.ContainsAny(s, `/\`) {
+		return fmt.Errorf("%q must be a non-empty name without slashes", text)
+	}
+	*n = name(s)
+	return nil
+}
+
+// extension is a file extension including its leading dot, e.g. ".md"
+type extension string
+
+func (e *extension) UnmarshalText(text []byte) error {
+	s := strings.ToLower(strings.TrimSpace(string(text)))
+	if len(s) < 2 || !strings.HasPrefix(s, ".") || strings.ContainsAny(s, `/\ `) {
+		return fmt.Errorf("%q is not a file extension like \".md\"", text)
+	}
+	*e = extension(s)
+	return nil
+}
+
+// mergeSet returns replace (if set) or base, plus extra
+func mergeSet[T ~string](base map[string]bool, replace *[]T, extra []T) map[string]bool {
+	set := base
+	if replace != nil {
+		set = make(map[string]bool, len(*replace))
+		for _, v := range *replace {
+			set[string(v)] = true
+		}
+	}
+	for _, v := range extra {
+		set[string(v)] = true
+	}
+	return set
+}
+
+func copySet(m map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// keyLine finds the line a dotted key is defined on, tracking [table]
+// headers. It returns 0 if the key cannot be found.
+func keyLine(data []byte, key toml.Key) int {
+	table := strings.Join(key[:len(key)-1], ".")
+	last := key[len(key)-1]
+
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(text, "[") {
+			header := strings.Trim(text, "[] ")
+			if header == key.String() {
+				return line
+			}
+			current = header
+			continue
+		}
+
+		k, _, ok := strings.Cut(text, "=")
+		if !ok {
+			continue
+		}
+		k = strings.Trim(strings.TrimSpace(k), `"'`)
+		if current == table && k == last {
+			return line
+		}
+		if current == "" && k == key.String() {
+			return line
+		}
+	}
+	return 0
+}
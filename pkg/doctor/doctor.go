@@ -0,0 +1,397 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	meilisearch "github.com/meilisearch/meilisearch-go"
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/client"
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/engine"
+	"github.com/sahil485/memex/pkg/indexer"
+)
+
+// Outcome is how a check ended
+type Outcome string
+
+const (
+	Pass  Outcome = "pass"
+	Warn  Outcome = "warn"
+	Fail  Outcome = "fail"
+	Fixed Outcome = "fixed"
+	Skip  Outcome = "skip"
+)
+
+// Thresholds for the free space check
+const (
+	lowDiskSpace      = 1 << 30
+	criticalDiskSpace = 100 << 20
+)
+
+// defaultMeilisearchURL is where a Meilisearch started by hand listens
+const defaultMeilisearchURL = "http://127.0.0.1:7700"
+
+// Result is the outcome of one check. Fix suggests how to repair a check
+// that did not pass.
+type Result struct {
+	Name    string  `json:"name"`
+	Outcome Outcome `json:"outcome"`
+	Message string  `json:"message"`
+	Fix     string  `json:"fix,omitempty"`
+}
+
+// Options controls a run of the checks
+type Options struct {
+	// Fix repairs what can be repaired safely: a missing index or settings,
+	// a stale endpoint file, a binary without the execute bit and documents
+	// of files that were deleted
+	Fix bool
+
+	// ConfigPath is the configuration file in use and ConfigErr the error
+	// loading it, if any
+	ConfigPath string
+	ConfigErr  error
+}
+
+// doctor carries what earlier checks learned to later ones
+type doctor struct {
+	opts    Options
+	results []Result
+	healthy bool
+	backend backend.SearchBackend
+}
+
+// Run runs every check in order. Checks that need the search backend are
+// skipped when it cannot be reached.
+func Run(opts Options) []Result {
+	d := &doctor{opts: opts}
+	d.checkConfig()
+	if backend.Embedded() {
+		d.skip("the embedded backend needs no Meilisearch", "binary", "endpoint file")
+		d.checkEmbedded()
+	} else {
+		d.checkBinary()
+		d.checkEndpoint()
+	}
+	d.checkDiskSpace()
+
+	if !d.healthy {
+		d.skip("the search backend is not reachable", "index", "settings", "tasks", "missing files")
+		return d.results
+	}
+
+	d.backend = backend.New()
+	switch d.checkIndex() {
+	case indexExists:
+		d.checkSettings()
+		d.checkTasks()
+		d.checkMissingFiles()
+	case indexCreated:
+		d.add("settings", Fixed, "applied when creating the index", "")
+		d.skip("the index is new", "tasks", "missing files")
+	default:
+		d.skip("the index does not exist", "settings", "tasks", "missing files")
+	}
+	return d.results
+}
+
+func (d *doctor) skip(reason string, names ...string) {
+	for _, name := range names {
+		d.add(name, Skip, reason, "")
+	}
+}
+
+func (d *doctor) add(name string, outcome Outcome, message, fix string) {
+	d.results = append(d.results, Result{Name: name, Outcome: outcome, Message: message, Fix: fix})
+}
+
+func (d *doctor) checkConfig() {
+	if d.opts.ConfigErr != nil {
+		d.add("config", Fail, d.opts.ConfigErr.Error(),
+			"Correct "+d.opts.ConfigPath+"; defaults are used for the other checks")
+		return
+	}
+	if _, err := os.Stat(d.opts.ConfigPath); errors.Is(err, os.ErrNotExist) {
+		d.add("config", Pass, "no configuration file; using defaults", "")
+		return
+	}
+	d.add("config", Pass, d.opts.ConfigPath+" is valid", "")
+}
+
+func (d *doctor) checkBinary() {
+	cfg := config.Current()
+	if cfg.MeilisearchURL != "" {
+		d.add("binary", Skip, "using the server at "+cfg.MeilisearchURL, "")
+		return
+	}
+
+	path := cfg.MeilisearchBinary
+	info, err := os.Stat(path)
+	if err != nil {
+		d.add("binary", Fail, fmt.Sprintf("Meilisearch is not installed at %s", path),
+			"Download Meilisearch from https://github.com/meilisearch/meilisearch/releases and save it as "+path)
+		return
+	}
+
+	if !executable(info) {
+		if !d.opts.Fix {
+			d.add("binary", Fail, path+" is not executable", "Run chmod +x "+path+", or doctor --fix")
+			return
+		}
+		if err := os.Chmod(path, info.Mode()|0o755); err != nil {
+			d.add("binary", Fail, fmt.Sprintf("could not make %s executable: %v", path, err), "Run chmod +x "+path)
+			return
+		}
+		d.add("binary", Fixed, path+" is now executable", "")
+		return
+	}
+
+	version, err := binaryVersion(path)
+	if err != nil {
+		d.add("binary", Fail, fmt.Sprintf("%s does not run: %v", path, err),
+			"Replace it with a Meilisearch release for this platform")
+		return
+	}
+	d.add("binary", Pass, fmt.Sprintf("%s at %s", version, path), "")
+}
+
+// binaryVersion runs the binary with --version, e.g. "meilisearch 1.12.0"
+func binaryVersion(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (d *doctor) checkEndpoint() {
+	endpoint := engine.Endpoint()
+
+	// An endpoint file left by a crashed server points clients at nothing
+	discovery, err := engine.ReadDiscovery()
+	switch {
+	case err != nil:
+		d.add("endpoint file", Warn, err.Error(), "Delete "+engine.DiscoveryPath())
+	case discovery == nil:
+		d.add("endpoint file", Pass, "no server has recorded its endpoint", "")
+	case !discovery.Stale():
+		d.add("endpoint file", Pass, fmt.Sprintf("recorded by running process %d", discovery.PID), "")
+	case !d.opts.Fix:
+		d.add("endpoint file", Warn, fmt.Sprintf("%s was left by exited process %d", engine.DiscoveryPath(), discovery.PID),
+			"Delete it, or run doctor --fix")
+	default:
+		if err := os.Remove(engine.DiscoveryPath()); err != nil {
+			d.add("endpoint file", Warn, fmt.Sprintf("could not remove %s: %v", engine.DiscoveryPath(), err), "Delete it")
+		} else {
+			d.add("endpoint file", Fixed, fmt.Sprintf("removed the endpoint file of exited process %d", discovery.PID), "")
+			endpoint = engine.Endpoint()
+		}
+	}
+
+	if engine.Healthy(endpoint) {
+		d.healthy = true
+		message := "Meilisearch answers at " + endpoint
+		if version, err := client.New().Version(); err == nil {
+			message = fmt.Sprintf("Meilisearch %s answers at %s", version, endpoint)
+		}
+		d.add("engine", Pass, message, "")
+		return
+	}
+
+	if endpoint != defaultMeilisearchURL && engine.Healthy(defaultMeilisearchURL) {
+		d.add("engine", Fail, fmt.Sprintf("nothing answers at %s, but Meilisearch answers at %s", endpoint, defaultMeilisearchURL),
+			fmt.Sprintf("Set url = %q under [meilisearch] in the configuration, or pass --url", defaultMeilisearchURL))
+		return
+	}
+	if listening(endpoint) {
+		d.add("engine", Fail, fmt.Sprintf("something other than Meilisearch listens at %s", endpoint),
+			"Stop the program using the port, or set another port under [meilisearch] in the configuration")
+		return
+	}
+	d.add("engine", Fail, "nothing answers at "+endpoint, "Run serve, or open the desktop app, to start Meilisearch")
+}
+
+// checkEmbedded checks that the directory of the embedded index exists or
+// can be created
+func (d *doctor) checkEmbedded() {
+	b := backend.New()
+	if !b.Healthy() {
+		d.add("engine", Fail, "the embedded index cannot be created at "+b.Location(),
+			"Set path under [embedded] in the configuration to a directory you can write to")
+		return
+	}
+	d.healthy = true
+	version, _ := b.Version()
+	d.add("engine", Pass, fmt.Sprintf("embedded index (%s) at %s", version, b.Location()), "")
+}
+
+// listening reports whether anything accepts connections at the URL's
+// address
+func listening(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), 2*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func (d *doctor) checkDiskSpace() {
+	// The database may not exist yet; measure the nearest existing parent
+	dir := config.Current().MeilisearchDBPath
+	if backend.Embedded() {
+		dir = config.Current().EmbeddedPath
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	free, err := freeSpace(dir)
+	if err != nil {
+		d.add("disk space", Warn, fmt.Sprintf("could not measure free space at %s: %v", dir, err), "")
+		return
+	}
+
+	message := fmt.Sprintf("%.1f GB free at %s", float64(free)/(1<<30), dir)
+	switch {
+	case free < criticalDiskSpace:
+		d.add("disk space", Fail, message, "Free up space; indexing fails when the disk is full")
+	case free < lowDiskSpace:
+		d.add("disk space", Warn, message, "Free up space before indexing more files")
+	default:
+		d.add("disk space", Pass, message, "")
+	}
+}
+
+// indexState is what checkIndex found
+type indexState int
+
+const (
+	indexMissing indexState = iota
+	indexExists
+	indexCreated
+)
+
+// checkIndex checks that the index exists, creating it with --fix
+func (d *doctor) checkIndex() indexState {
+	name := config.Current().IndexName
+	stats, err := d.backend.Stats()
+	if err != nil {
+		d.add("index", Fail, fmt.Sprintf("could not read stats: %v", err), "")
+		return indexMissing
+	}
+	if stats.Exists {
+		d.add("index", Pass, fmt.Sprintf("'%s' holds %d documents", name, stats.Documents), "")
+		return indexExists
+	}
+
+	if !d.opts.Fix {
+		d.add("index", Fail, fmt.Sprintf("'%s' does not exist", name), "Run init, or doctor --fix")
+		return indexMissing
+	}
+	if err := d.backend.Init(); err != nil {
+		d.add("index", Fail, fmt.Sprintf("could not create '%s': %v", name, err), "Run init")
+		return indexMissing
+	}
+	d.add("index", Fixed, fmt.Sprintf("created '%s'", name), "")
+	return indexCreated
+}
+
+func (d *doctor) checkSettings() {
+	problems, err := d.backend.CheckSettings()
+	if err != nil {
+		d.add("settings", Fail, fmt.Sprintf("could not read settings: %v", err), "")
+		return
+	}
+	if len(problems) == 0 {
+		d.add("settings", Pass, "match those applied by init", "")
+		return
+	}
+
+	message := strings.Join(problems, "; ")
+	if !d.opts.Fix {
+		d.add("settings", Fail, message, "Run init, or doctor --fix")
+		return
+	}
+	if err := d.backend.ApplySettings(); err != nil {
+		d.add("settings", Fail, fmt.Sprintf("could not apply settings: %v", err), "Run init")
+		return
+	}
+	d.add("settings", Fixed, "reapplied: "+message, "")
+}
+
+func (d *doctor) checkTasks() {
+	c, ok := d.backend.(*client.Client)
+	if !ok {
+		d.add("tasks", Skip, "the embedded backend applies changes as they are made", "")
+		return
+	}
+	failed, err := c.Tasks(&meilisearch.TasksQuery{
+		Statuses: []meilisearch.TaskStatus{meilisearch.TaskStatusFailed},
+		Limit:    1,
+	})
+	if err != nil {
+		d.add("tasks", Fail, fmt.Sprintf("could not list tasks: %v", err), "")
+		return
+	}
+	if failed.Total == 0 {
+		d.add("tasks", Pass, "no failed tasks", "")
+		return
+	}
+
+	message := fmt.Sprintf("%d failed tasks", failed.Total)
+	if len(failed.Results) > 0 {
+		latest := failed.Results[0]
+		message += fmt.Sprintf("; the latest, #%d %s, failed with: %s", latest.UID, latest.Type, latest.Error.Message)
+	}
+	d.add("tasks", Warn, message, "Files in failed uploads are missing from results; index their directories again")
+}
+
+func (d *doctor) checkMissingFiles() {
+	missing, err := indexer.MissingFiles()
+	if err != nil {
+		d.add("missing files", Fail, fmt.Sprintf("could not list indexed files: %v", err), "")
+		return
+	}
+	if len(missing) == 0 {
+		d.add("missing files", Pass, "every indexed file exists", "")
+		return
+	}
+
+	message := fmt.Sprintf("%d indexed files no longer exist, e.g. %s", len(missing), missing[0])
+	if !d.opts.Fix {
+		d.add("missing files", Warn, message, "Index their directories again, or run doctor --fix")
+		return
+	}
+	if err := indexer.RemoveFiles(missing); err != nil {
+		d.add("missing files", Fail, fmt.Sprintf("could not remove %d deleted files: %v", len(missing), err), "Index their directories again")
+		return
+	}
+	d.add("missing files", Fixed, fmt.Sprintf("removed %d deleted files from the index", len(missing)), "")
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package doctor
+
+import "os"
+
+// executable reports whether the file may be run by someone
+func executable(info os.FileInfo) bool {
+	return info.Mode()&0o111 != 0
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package doctor
+
+import "os"
+
+// executable reports whether the file may be run; Windows has no execute
+// bit, so any regular file qualifies
+func executable(info os.FileInfo) bool {
+	return info.Mode().IsRegular()
+}
@@ -0,0 +1,74 @@
+package embedded
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// document reads the fields of document i
+func (s *liveSegment) document(i int) (map[string]json.RawMessage, error) {
+	return s.readDocument(s.docFile, i)
+}
+
+// project keeps the requested fields of a document. No fields, or "*",
+// keeps them all.
+func project(fields map[string]json.RawMessage, attributes []string) types.Hit {
+	if len(attributes) == 0 || slices.Contains(attributes, "*") {
+		return types.Hit(fields)
+	}
+	hit := make(types.Hit, len(attributes))
+	for _, a := range attributes {
+		if v, ok := fields[a]; ok {
+			hit[a] = v
+		}
+	}
+	return hit
+}
+
+// GetDocument decodes the requested fields of a document into dst. It
+// reports false if no document has the ID.
+func (x *Index) GetDocument(id string, fields []string, dst any) (bool, error) {
+	var found bool
+	err := x.read(func(snap *snapshot) error {
+		s, i, ok := snap.find(id)
+		if !ok {
+			return nil
+		}
+		stored, err := s.document(i)
+		if err != nil {
+			return err
+		}
+		found = true
+		return project(stored, fields).DecodeInto(dst)
+	})
+	return found, err
+}
+
+// EachDocument calls fn with the requested fields of every document
+// matching filter, or of every document if it is empty, oldest segment
+// first
+func (x *Index) EachDocument(filter string, fields []string, fn func(hit types.Hit) error) error {
+	f, err := parseFilter(filter)
+	if err != nil {
+		return err
+	}
+	return x.read(func(snap *snapshot) error {
+		for _, s := range snap.segments {
+			for i := range s.IDs {
+				if s.deleted[i] || (f != nil && !f(s.segment, i)) {
+					continue
+				}
+				stored, err := s.document(i)
+				if err != nil {
+					return err
+				}
+				if err := fn(project(stored, fields)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
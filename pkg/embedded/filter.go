@@ -0,0 +1,350 @@
+package embedded
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// filter reports whether document i of a segment matches a filter. A nil
+// filter matches every document.
+type filter func(s *segment, i int) bool
+
+// parseFilter compiles an expression in the Meilisearch filter syntax:
+// conditions on filterable attributes joined with AND, OR, NOT and
+// parentheses. Conditions are EXISTS, =, !=, >, >=, <, <=, a TO b and
+// [NOT] IN [...]. Strings compare without regard to case.
+func parseFilter(expr string) (filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	return f, nil
+}
+
+// filterToken is a word, quoted string or symbol of a filter
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+// keyword reports whether the token is the unquoted keyword kw
+func (t filterToken) keyword(kw string) bool {
+	return !t.quoted && strings.EqualFold(t.text, kw)
+}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte("()[],", c) >= 0:
+			tokens = append(tokens, filterToken{text: expr[i : i+1]})
+			i++
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			n := 1
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				n = 2
+			}
+			op := expr[i : i+n]
+			if op == "!" {
+				return nil, fmt.Errorf("expected != at %q", expr[i:])
+			}
+			tokens = append(tokens, filterToken{text: op})
+			i += n
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(expr) && expr[j] != c; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				b.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at %q", expr[i:])
+			}
+			tokens = append(tokens, filterToken{text: b.String(), quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(expr) && !unicode.IsSpace(rune(expr[j])) && strings.IndexByte("()[],=!<>\"'", expr[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: expr[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// accept consumes the next token if it is the keyword or symbol text
+func (p *filterParser) accept(text string) bool {
+	if t, ok := p.peek(); ok && t.keyword(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) next(what string) (filterToken, error) {
+	t, ok := p.peek()
+	if !ok {
+		return filterToken{}, fmt.Errorf("expected %s at the end", what)
+	}
+	p.pos++
+	return t, nil
+}
+
+func (p *filterParser) or() (filter, error) {
+	f, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		g, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		f = orFilter(f, g)
+	}
+	return f, nil
+}
+
+func (p *filterParser) and() (filter, error) {
+	f, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		g, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		f = andFilter(f, g)
+	}
+	return f, nil
+}
+
+func (p *filterParser) not() (filter, error) {
+	if p.accept("NOT") {
+		f, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter(f), nil
+	}
+	if p.accept("(") {
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("expected )")
+		}
+		return f, nil
+	}
+	return p.condition()
+}
+
+func (p *filterParser) condition() (filter, error) {
+	t, err := p.next("an attribute")
+	if err != nil {
+		return nil, err
+	}
+	attribute := t.text
+	if !slices.Contains(types.FilterableAttributes, attribute) {
+		return nil, fmt.Errorf("attribute %q is not filterable", attribute)
+	}
+
+	switch {
+	case p.accept("EXISTS"):
+		return existsFilter(attribute), nil
+	case p.accept("IS"):
+		return nil, fmt.Errorf("IS NULL and IS EMPTY are not supported by the embedded backend")
+	case p.accept("IN"):
+		return p.in(attribute)
+	case p.accept("NOT"):
+		switch {
+		case p.accept("EXISTS"):
+			return notFilter(existsFilter(attribute)), nil
+		case p.accept("IN"):
+			f, err := p.in(attribute)
+			if err != nil {
+				return nil, err
+			}
+			return notFilter(f), nil
+		}
+		return nil, fmt.Errorf("expected EXISTS or IN after %s NOT", attribute)
+	}
+
+	op, err := p.next("an operator")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case op.quoted:
+		// A quoted "=" is a value, not an operator
+	case op.text == "=":
+		value, err := p.next("a value")
+		if err != nil {
+			return nil, err
+		}
+		return equalFilter(attribute, value.text), nil
+	case op.text == "!=":
+		value, err := p.next("a value")
+		if err != nil {
+			return nil, err
+		}
+		return notFilter(equalFilter(attribute, value.text)), nil
+	case op.text == ">", op.text == ">=", op.text == "<", op.text == "<=":
+		n, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		return compareFilter(attribute, op.text, n), nil
+	}
+
+	// attribute from TO to
+	from, err := strconv.ParseFloat(op.text, 64)
+	if err != nil || !p.accept("TO") {
+		return nil, fmt.Errorf("expected an operator after %s, got %q", attribute, op.text)
+	}
+	to, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	return andFilter(compareFilter(attribute, ">=", from), compareFilter(attribute, "<=", to)), nil
+}
+
+func (p *filterParser) number() (float64, error) {
+	t, err := p.next("a number")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number, got %q", t.text)
+	}
+	return n, nil
+}
+
+// in parses the list of an IN condition
+func (p *filterParser) in(attribute string) (filter, error) {
+	if !p.accept("[") {
+		return nil, fmt.Errorf("expected [ after IN")
+	}
+	var values []string
+	for !p.accept("]") {
+		if len(values) > 0 && !p.accept(",") {
+			return nil, fmt.Errorf("expected , or ] in the list of %s", attribute)
+		}
+		// A trailing comma is allowed
+		if p.accept("]") {
+			break
+		}
+		t, err := p.next("a value")
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, t.text)
+	}
+
+	var f filter = func(*segment, int) bool { return false }
+	for _, v := range values {
+		f = orFilter(f, equalFilter(attribute, v))
+	}
+	return f, nil
+}
+
+func orFilter(f, g filter) filter {
+	return func(s *segment, i int) bool { return f(s, i) || g(s, i) }
+}
+
+func andFilter(f, g filter) filter {
+	return func(s *segment, i int) bool { return f(s, i) && g(s, i) }
+}
+
+func notFilter(f filter) filter {
+	return func(s *segment, i int) bool { return !f(s, i) }
+}
+
+func existsFilter(attribute string) filter {
+	return func(s *segment, i int) bool {
+		c := s.Columns[attribute]
+		return c != nil && c.Present[i]
+	}
+}
+
+// equalFilter matches documents whose attribute, or one of its elements,
+// is value. Numbers compare by value, so 1.0 equals 1.
+func equalFilter(attribute, value string) filter {
+	n, numeric := strconv.ParseFloat(value, 64)
+	isNumber := numeric == nil
+	return func(s *segment, i int) bool {
+		c := s.Columns[attribute]
+		if c == nil {
+			return false
+		}
+		if isNumber && c.IsNumber[i] {
+			return c.Numbers[i] == n
+		}
+		for _, v := range c.Strings[i] {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// compareFilter matches documents whose attribute is a number that
+// compares to n with op
+func compareFilter(attribute, op string, n float64) filter {
+	return func(s *segment, i int) bool {
+		c := s.Columns[attribute]
+		if c == nil || !c.IsNumber[i] {
+			return false
+		}
+		v := c.Numbers[i]
+		switch op {
+		case ">":
+			return v > n
+		case ">=":
+			return v >= n
+		case "<":
+			return v < n
+		default:
+			return v <= n
+		}
+	}
+}
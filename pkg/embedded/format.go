@@ -0,0 +1,146 @@
+package embedded
+
+import (
+	"strings"
+)
+
+// Defaults of the formatting options, as in Meilisearch
+const (
+	defaultCropLength       = 10
+	defaultCropMarker       = "…"
+	defaultHighlightPreTag  = "<em>"
+	defaultHighlightPostTag = "</em>"
+)
+
+// matcher recognises the words of a query in a text. Words matched by
+// prefix are marked whole.
+type matcher struct {
+	words  map[string]bool
+	prefix string
+}
+
+func newMatcher(terms []queryTerm) *matcher {
+	m := &matcher{words: make(map[string]bool)}
+	for _, t := range terms {
+		if t.prefix {
+			m.prefix = t.words[0]
+			continue
+		}
+		for _, w := range t.words {
+			m.words[w] = true
+		}
+	}
+	return m
+}
+
+func (m *matcher) match(word string) bool {
+	return m.words[word] || (m.prefix != "" && strings.HasPrefix(word, m.prefix))
+}
+
+// matches returns the words of text the matcher recognises
+func (m *matcher) matches(text string) []token {
+	var matched []token
+	for _, t := range tokenize(text) {
+		if m.match(t.text) {
+			matched = append(matched, t)
+		}
+	}
+	return matched
+}
+
+// formatOptions says how formatText crops and highlights an attribute
+type formatOptions struct {
+	crop       bool
+	cropLength int
+	cropMarker string
+
+	highlight bool
+	preTag    string
+	postTag   string
+}
+
+// formatText crops text to the window of cropLength words holding the most
+// distinct matched words, centred on them, and wraps matched words in the
+// highlight tags
+func formatText(text string, m *matcher, opts formatOptions) string {
+	tokens := tokenize(text)
+	matched := make([]bool, len(tokens))
+	for i, t := range tokens {
+		matched[i] = m.match(t.text)
+	}
+
+	from, to := 0, len(text)
+	first, last := 0, len(tokens)
+	if opts.crop && len(tokens) > opts.cropLength {
+		first = cropWindow(tokens, matched, opts.cropLength)
+		last = first + opts.cropLength
+		from, to = tokens[first].start, tokens[last-1].end
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString(opts.cropMarker)
+	}
+	pos := from
+	if opts.highlight {
+		for i := first; i < last; i++ {
+			if !matched[i] {
+				continue
+			}
+			t := tokens[i]
+			b.WriteString(text[pos:t.start])
+			b.WriteString(opts.preTag)
+			b.WriteString(text[t.start:t.end])
+			b.WriteString(opts.postTag)
+			pos = t.end
+		}
+	}
+	b.WriteString(text[pos:to])
+	if to < len(text) {
+		b.WriteString(opts.cropMarker)
+	}
+	return b.String()
+}
+
+// cropWindow returns the first word of the window of length words that
+// holds the most distinct matched words. The window is then moved so the
+// matches in it are centred.
+func cropWindow(tokens []token, matched []bool, length int) int {
+	// Slide the window one word at a time, counting its matched words
+	counts := make(map[string]int)
+	add := func(i, delta int) {
+		if !matched[i] {
+			return
+		}
+		counts[tokens[i].text] += delta
+		if counts[tokens[i].text] == 0 {
+			delete(counts, tokens[i].text)
+		}
+	}
+	for i := 0; i < length; i++ {
+		add(i, 1)
+	}
+	best, bestCount := 0, len(counts)
+	for start := 1; start+length <= len(tokens); start++ {
+		add(start-1, -1)
+		add(start+length-1, 1)
+		if len(counts) > bestCount {
+			best, bestCount = start, len(counts)
+		}
+	}
+	if bestCount == 0 {
+		return 0
+	}
+
+	first, last := -1, -1
+	for i := best; i < best+length; i++ {
+		if matched[i] {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	slack := length - (last - first + 1)
+	return min(max(first-slack/2, 0), len(tokens)-length)
+}
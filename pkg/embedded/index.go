@@ -0,0 +1,320 @@
+package embedded
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// Index is a search index kept in files in a directory, for use where no
+// Meilisearch server can run. Several processes may search and write the
+// same index at once: writers take turns through a lock file, and readers
+// see the segments listed by the manifest when they start.
+type Index struct {
+	dir string
+
+	// writeMu serialises writes within the process; the lock file does so
+	// between processes
+	writeMu sync.Mutex
+
+	// Loaded segments, which never change once written
+	mu       sync.Mutex
+	segments map[string]*segment
+}
+
+var (
+	indexes   = make(map[string]*Index)
+	indexesMu sync.Mutex
+)
+
+// Open returns the shared index stored in dir. Nothing is read until the
+// index is used, and the directory is created by the first write.
+func Open(dir string) *Index {
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+
+	if x, ok := indexes[dir]; ok {
+		return x
+	}
+	x := &Index{dir: dir, segments: make(map[string]*segment)}
+	indexes[dir] = x
+	return x
+}
+
+// Name identifies the backend
+func (x *Index) Name() string {
+	return config.BackendEmbedded
+}
+
+// Location returns the directory of the index
+func (x *Index) Location() string {
+	return x.dir
+}
+
+// Healthy reports whether the index directory exists or can be created
+func (x *Index) Healthy() bool {
+	for dir := x.dir; ; dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err == nil {
+			return info.IsDir()
+		}
+		if !errors.Is(err, os.ErrNotExist) || filepath.Dir(dir) == dir {
+			return false
+		}
+	}
+}
+
+// Version describes the on-disk format
+func (x *Index) Version() (string, error) {
+	return fmt.Sprintf("format %d", formatVersion), nil
+}
+
+// Init creates the index if it does not exist and applies its settings
+func (x *Index) Init() error {
+	return x.ApplySettings()
+}
+
+// ApplySettings rewrites the segments written by a version of memex that
+// searched, filtered or sorted on other attributes
+func (x *Index) ApplySettings() error {
+	return x.update(func(t *txn) error {
+		t.rebuild = true
+		return nil
+	})
+}
+
+// CheckSettings reports segments that index other attributes than this
+// version of memex uses
+func (x *Index) CheckSettings() ([]string, error) {
+	var problems []string
+	err := x.read(func(snap *snapshot) error {
+		outdated := 0
+		for _, s := range snap.segments {
+			if s.outdated() {
+				outdated++
+			}
+		}
+		if outdated > 0 {
+			problems = append(problems, fmt.Sprintf("%d of %d segments index other attributes than this version of memex",
+				outdated, len(snap.segments)))
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// Stats counts the documents of the index and their fields, and measures
+// its files
+func (x *Index) Stats() (*types.IndexStats, error) {
+	stats := &types.IndexStats{}
+	err := x.read(func(snap *snapshot) error {
+		if snap.manifest == nil {
+			return nil
+		}
+		stats.Exists = true
+		stats.FieldDistribution = make(map[string]int64)
+		for _, s := range snap.segments {
+			for i := range s.IDs {
+				if s.deleted[i] {
+					continue
+				}
+				stats.Documents++
+				stats.DocumentsSize += s.size(i)
+				for bit, field := range s.Fields[:min(len(s.Fields), 64)] {
+					if s.FieldMasks[i]&(1<<bit) != 0 {
+						stats.FieldDistribution[field]++
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, _ := os.ReadDir(x.dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && !info.IsDir() {
+			stats.DatabaseSize += info.Size()
+		}
+	}
+	return stats, nil
+}
+
+// snapshot is a consistent view of the index: the segments listed by one
+// manifest, with their files held open so a concurrent merge cannot remove
+// them while they are read
+type snapshot struct {
+	manifest *manifest
+	segments []*liveSegment
+}
+
+// liveSegment is a segment as of a snapshot, with the documents since
+// replaced or deleted masked out
+type liveSegment struct {
+	*segment
+	deleted []bool
+
+	// The segment's .docs and .terms files
+	docFile  *os.File
+	termFile *os.File
+}
+
+func (s *liveSegment) live() int {
+	n := 0
+	for _, d := range s.deleted {
+		if !d {
+			n++
+		}
+	}
+	return n
+}
+
+// read runs fn on a snapshot of the index. A write may remove the files of
+// the manifest just read before they are opened, so that is retried.
+func (x *Index) read(fn func(snap *snapshot) error) error {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		var (
+			m    *manifest
+			snap *snapshot
+		)
+		if m, err = readManifest(x.dir); err != nil {
+			return err
+		}
+		snap, err = x.load(m)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = fn(snap)
+		snap.close()
+		return err
+	}
+	return err
+}
+
+// load opens the segments listed by m, which may be nil for an index that
+// does not exist yet
+func (x *Index) load(m *manifest) (*snapshot, error) {
+	snap := &snapshot{manifest: m}
+	if m == nil {
+		return snap, nil
+	}
+
+	for _, info := range m.Segments {
+		s, err := x.segment(info.Name)
+		if err != nil {
+			snap.close()
+			return nil, err
+		}
+		if s.docs() != info.Docs {
+			snap.close()
+			return nil, fmt.Errorf("%s: %w", s.path(metaExt), errCorrupt)
+		}
+
+		deleted := make([]bool, info.Docs)
+		for _, i := range info.Deleted {
+			if i >= 0 && i < len(deleted) {
+				deleted[i] = true
+			}
+		}
+		ls, err := openLive(s, deleted)
+		if err != nil {
+			snap.close()
+			return nil, err
+		}
+		snap.segments = append(snap.segments, ls)
+	}
+	return snap, nil
+}
+
+func openLive(s *segment, deleted []bool) (*liveSegment, error) {
+	docFile, err := os.Open(s.path(docsExt))
+	if err != nil {
+		return nil, err
+	}
+	termFile, err := os.Open(s.path(termsExt))
+	if err != nil {
+		docFile.Close()
+		return nil, err
+	}
+	return &liveSegment{segment: s, deleted: deleted, docFile: docFile, termFile: termFile}, nil
+}
+
+// close closes the segment's files. Closing again does nothing.
+func (s *liveSegment) close() {
+	if s.docFile != nil {
+		s.docFile.Close()
+		s.docFile = nil
+	}
+	if s.termFile != nil {
+		s.termFile.Close()
+		s.termFile = nil
+	}
+}
+
+func (snap *snapshot) close() {
+	for _, s := range snap.segments {
+		s.close()
+	}
+}
+
+// segment returns a loaded segment, reading it on first use
+func (x *Index) segment(name string) (*segment, error) {
+	x.mu.Lock()
+	s, ok := x.segments[name]
+	x.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	s, err := loadSegment(x.dir, name)
+	if err != nil {
+		return nil, err
+	}
+	x.cache(s)
+	return s, nil
+}
+
+func (x *Index) cache(s *segment) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.segments[s.name] = s
+}
+
+// forget drops loaded segments that m no longer lists
+func (x *Index) forget(m *manifest) {
+	used := make(map[string]bool, len(m.Segments))
+	for _, s := range m.Segments {
+		used[s.Name] = true
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for name := range x.segments {
+		if !used[name] {
+			delete(x.segments, name)
+		}
+	}
+}
+
+// find returns the segment and number of the live document with id
+func (snap *snapshot) find(id string) (*liveSegment, int, bool) {
+	for j := len(snap.segments) - 1; j >= 0; j-- {
+		s := snap.segments[j]
+		if i, ok := s.ids[id]; ok && !s.deleted[i] {
+			return s, i, true
+		}
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,247 @@
+package embedded
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+type doc = map[string]any
+
+// ids returns the IDs of hits, in order
+func ids(t *testing.T, hits []types.Hit) []string {
+	t.Helper()
+	var out []string
+	for _, hit := range hits {
+		var d struct{ ID string }
+		if err := hit.DecodeInto(&d); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, d.ID)
+	}
+	return out
+}
+
+// allIDs returns the IDs of every stored document, sorted
+func allIDs(t *testing.T, x *Index) []string {
+	t.Helper()
+	var hits []types.Hit
+	err := x.EachDocument("", []string{"id"}, func(hit types.Hit) error {
+		hits = append(hits, hit)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := ids(t, hits)
+	slices.Sort(out)
+	return out
+}
+
+func search(t *testing.T, x *Index, r types.SearchRequest) *types.SearchResponse {
+	t.Helper()
+	resp, err := x.Search(&r)
+	if err != nil {
+		t.Fatalf("Search(%+v): %v", r, err)
+	}
+	return resp
+}
+
+func TestDocuments(t *testing.T) {
+	x := Open(t.TempDir())
+	if err := x.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := x.AddDocuments([]doc{
+		{"id": "a", "name": "a.txt", "content": "first"},
+		{"id": "b", "name": "b.txt", "content": "second"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.UpdateDocuments([]doc{{"id": "a", "content": "changed"}, {"id": "c", "name": "c.txt"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var a struct{ Name, Content string }
+	ok, err := x.GetDocument("a", nil, &a)
+	if err != nil || !ok {
+		t.Fatalf("GetDocument(a) = %v, %v", ok, err)
+	}
+	if a.Name != "a.txt" || a.Content != "changed" {
+		t.Errorf("updating merged the fields into %+v", a)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(allIDs(t, x), want) {
+		t.Errorf("stored %v, want %v", allIDs(t, x), want)
+	}
+
+	if err := x.AddDocuments([]doc{{"name": "no id"}}); err == nil {
+		t.Error("adding a document without an ID succeeded")
+	}
+
+	if err := x.DeleteDocuments([]string{"b", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := x.GetDocument("b", nil, &a); ok || err != nil {
+		t.Errorf("GetDocument of a deleted document = %v, %v", ok, err)
+	}
+
+	if err := x.DeleteAllDocuments(); err != nil {
+		t.Fatal(err)
+	}
+	if got := allIDs(t, x); len(got) != 0 {
+		t.Errorf("stored %v after deleting all", got)
+	}
+}
+
+// Deleting every document of a segment drops it, which must leave the
+// segments of the transaction's snapshot intact
+func TestDeleteEmptiesSegment(t *testing.T) {
+	dir := t.TempDir()
+	x := Open(dir)
+
+	for _, batch := range [][]doc{
+		{{"id": "a", "content": "alpha"}, {"id": "b", "content": "beta"}},
+		{{"id": "c", "content": "gamma"}},
+	} {
+		if err := x.AddDocuments(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := x.DeleteDocuments([]string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.DeleteDocuments([]string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Segments) != 0 {
+		t.Errorf("manifest keeps %d empty segments", len(m.Segments))
+	}
+
+	if err := x.AddDocuments([]doc{{"id": "d", "content": "delta"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, search(t, x, types.SearchRequest{Query: "delta"}).Hits); !slices.Equal(got, []string{"d"}) {
+		t.Errorf("search after the deletes found %v", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	x := Open(t.TempDir())
+	err := x.AddDocuments([]doc{
+		{"id": "1", "name": "budget.xlsx", "ext": ".xlsx", "size": 300, "content": "quarterly budget report"},
+		{"id": "2", "name": "notes.md", "ext": ".md", "size": 100, "content": "budget meeting notes"},
+		{"id": "3", "name": "draft.md", "ext": ".md", "size": 200, "content": "budget draft"},
+		{"id": "4", "name": "other.txt", "ext": ".txt", "size": 50, "content": "unrelated"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		r    types.SearchRequest
+		want []string
+	}{
+		{"prefix", types.SearchRequest{Query: "budg", Sort: []string{"size:asc"}}, []string{"2", "3", "1"}},
+		{"whole word", types.SearchRequest{Query: "budg "}, nil},
+		{"exclude", types.SearchRequest{Query: "budget -draft", Sort: []string{"size:asc"}}, []string{"2", "1"}},
+		{"filter", types.SearchRequest{Query: "budget", Filter: `ext = ".md" AND size > 150`}, []string{"3"}},
+		{"no query", types.SearchRequest{Filter: `ext IN [".txt"]`}, []string{"4"}},
+		{"limit", types.SearchRequest{Query: "budget", Sort: []string{"size:desc"}, Limit: 1}, []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(t, search(t, x, tt.r).Hits); !slices.Equal(got, tt.want) {
+				t.Errorf("found %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	resp := search(t, x, types.SearchRequest{Query: "budget", Facets: []string{"ext"}})
+	if resp.EstimatedTotalHits != 3 {
+		t.Errorf("EstimatedTotalHits = %d, want 3", resp.EstimatedTotalHits)
+	}
+	if got := resp.FacetDistribution["ext"]; got[".md"] != 2 || got[".xlsx"] != 1 || len(got) != 2 {
+		t.Errorf("ext facet = %v", got)
+	}
+
+	var hits []types.Hit
+	err = x.EachDocument(`ext = ".md"`, []string{"id"}, func(hit types.Hit) error {
+		hits = append(hits, hit)
+		return nil
+	})
+	if got := ids(t, hits); err != nil || !slices.Equal(got, []string{"2", "3"}) {
+		t.Errorf("documents matching a filter = %v, %v, want [2 3]", got, err)
+	}
+
+	for _, r := range []types.SearchRequest{
+		{Query: "budget", Sort: []string{"content:asc"}},
+		{Query: "budget", Facets: []string{"content"}},
+		{Query: "budget", Filter: "ext ="},
+	} {
+		if _, err := x.Search(&r); err == nil {
+			t.Errorf("Search(%+v) succeeded", r)
+		}
+	}
+}
+
+// Many small writes are merged into few segments without losing documents
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	x := Open(dir)
+
+	var want []string
+	for i := range 100 {
+		id := fmt.Sprintf("doc%03d", i)
+		if err := x.AddDocuments([]doc{{"id": id, "content": fmt.Sprintf("word%d", i)}}); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, id)
+	}
+	// Replace and delete across segments
+	if err := x.UpdateDocuments([]doc{{"id": "doc000", "content": "replaced"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.DeleteDocuments([]string{"doc050"}); err != nil {
+		t.Fatal(err)
+	}
+	want = slices.DeleteFunc(want, func(id string) bool { return id == "doc050" })
+
+	if got := allIDs(t, x); !slices.Equal(got, want) {
+		t.Errorf("stored %d documents, want %d", len(got), len(want))
+	}
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Segments) > maxSegments {
+		t.Errorf("%d segments, want at most %d", len(m.Segments), maxSegments)
+	}
+	if got := ids(t, search(t, x, types.SearchRequest{Query: "replaced"}).Hits); !slices.Equal(got, []string{"doc000"}) {
+		t.Errorf("search for the replaced document found %v", got)
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"ext",
+		`ext = ".md" AND`,
+		`(ext = ".md"`,
+		`ext IN [".md"`,
+		"size > big",
+		`ext = ".md" OR OR size > 1`,
+	} {
+		if _, err := parseFilter(expr); err == nil {
+			t.Errorf("parseFilter(%q) succeeded", expr)
+		}
+	}
+}
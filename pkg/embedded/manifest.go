@@ -0,0 +1,132 @@
+package embedded
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formatVersion is the version of the on-disk layout
+const formatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	lockName     = "lock"
+)
+
+// manifest lists the segments of an index, oldest first, and which of their
+// documents were replaced or deleted since. Writers replace it atomically,
+// so a reader always sees a consistent set of segments.
+type manifest struct {
+	Format   int           `json:"format"`
+	Next     int           `json:"next"`
+	Segments []segmentInfo `json:"segments"`
+}
+
+type segmentInfo struct {
+	Name    string `json:"name"`
+	Docs    int    `json:"docs"`
+	Deleted []int  `json:"deleted,omitempty"`
+}
+
+func (s segmentInfo) live() int {
+	return s.Docs - len(s.Deleted)
+}
+
+// readManifest reads the manifest of the index in dir, returning nil if the
+// index does not exist
+func readManifest(dir string) (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, manifestName), errCorrupt)
+	}
+	if m.Format != formatVersion {
+		return nil, fmt.Errorf("%s is in index format %d, but this version of memex reads format %d; delete it and index again",
+			dir, m.Format, formatVersion)
+	}
+	return &m, nil
+}
+
+// writeManifest replaces the manifest of the index in dir
+func writeManifest(dir string, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, manifestName)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeUnused deletes the segment files the manifest no longer lists. Files
+// still open elsewhere may fail to delete on Windows; they are removed by a
+// later write.
+func removeUnused(dir string, m *manifest) {
+	used := make(map[string]bool, len(m.Segments))
+	for _, s := range m.Segments {
+		used[s.Name] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if ext != docsExt && ext != metaExt && ext != termsExt {
+			continue
+		}
+		if !used[strings.TrimSuffix(e.Name(), ext)] {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+// lockIndex takes the write lock of the index in dir, which serialises
+// writers across memex processes
+func lockIndex(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", dir, err)
+	}
+	return f, nil
+}
+
+func unlockIndex(f *os.File) {
+	unlockFile(f)
+	f.Close()
+}
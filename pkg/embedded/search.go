@@ -0,0 +1,696 @@
+package embedded
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+const (
+	// defaultLimit is the number of hits returned when a request sets none
+	defaultLimit = 20
+
+	// maxTotalHits bounds how far hits can be paged, as in Meilisearch
+	maxTotalHits = 1000
+
+	// maxQueryTerms is how many words of a query are searched
+	maxQueryTerms = 10
+
+	// maxPrefixWords is how many words the last, unfinished word of a query
+	// may expand to in each segment
+	maxPrefixWords = 100
+
+	// prefixPenalty scales the score of a word matched by prefix only
+	prefixPenalty = 0.8
+
+	// BM25 parameters
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// queryTerm is a word of a query, or the words of a quoted phrase. The last
+// word of a query matches by prefix unless the query ends with a space.
+type queryTerm struct {
+	words  []string
+	phrase bool
+	prefix bool
+}
+
+// parseQuery splits a query into the terms to match and those excluded by a
+// leading -
+func parseQuery(q string) (terms, excluded []queryTerm) {
+	prefix := false
+	for i := 0; i < len(q); {
+		if unicode.IsSpace(rune(q[i])) {
+			i++
+			continue
+		}
+
+		negated := q[i] == '-' && i+1 < len(q) && !unicode.IsSpace(rune(q[i+1]))
+		if negated {
+			i++
+		}
+
+		var text string
+		phrase := q[i] == '"'
+		if phrase {
+			end := strings.IndexByte(q[i+1:], '"')
+			if end < 0 {
+				text, i = q[i+1:], len(q)
+			} else {
+				text, i = q[i+1:i+1+end], i+end+2
+			}
+		} else {
+			end := strings.IndexFunc(q[i:], unicode.IsSpace)
+			if end < 0 {
+				end = len(q) - i
+			}
+			text, i = q[i:i+end], i+end
+		}
+
+		var words []string
+		for _, t := range tokenize(text) {
+			words = append(words, t.text)
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		switch {
+		case negated:
+			excluded = append(excluded, queryTerm{words: words, phrase: len(words) > 1})
+			prefix = false
+		case phrase && len(words) > 1:
+			terms = append(terms, queryTerm{words: words, phrase: true})
+			prefix = false
+		default:
+			for _, w := range words {
+				terms = append(terms, queryTerm{words: []string{w}})
+			}
+			prefix = !phrase
+		}
+	}
+
+	if len(terms) > maxQueryTerms {
+		terms, prefix = terms[:maxQueryTerms], false
+	}
+	if prefix && !unicode.IsSpace(rune(q[len(q)-1])) {
+		terms[len(terms)-1].prefix = true
+	}
+	return terms, excluded
+}
+
+// Search runs a single search against the index
+func (x *Index) Search(request *types.SearchRequest) (*types.SearchResponse, error) {
+	responses, err := x.MultiSearch(request)
+	if err != nil {
+		return nil, err
+	}
+	return &responses[0], nil
+}
+
+// MultiSearch runs several searches against one snapshot of the index
+func (x *Index) MultiSearch(requests ...*types.SearchRequest) ([]types.SearchResponse, error) {
+	responses := make([]types.SearchResponse, len(requests))
+	err := x.read(func(snap *snapshot) error {
+		for i, r := range requests {
+			response, err := snap.search(r)
+			if err != nil {
+				return err
+			}
+			responses[i] = *response
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+// candidate is a document matching a search. Like Meilisearch's "last"
+// matching strategy, a document must match the first term of the query,
+// and documents matching more of the leading terms rank first.
+type candidate struct {
+	seg, doc int
+	matched  int
+	score    float64
+}
+
+// rankingScore maps the candidate's terms matched and its relevance relative
+// to the best of the search to a score between 0 and 1. Matching one more
+// term always outweighs relevance.
+func (c candidate) rankingScore(terms int, best float64) float64 {
+	if terms == 0 {
+		return 1
+	}
+	relevance := 1.0
+	if best > 0 {
+		relevance = c.score / best
+	}
+	return (float64(c.matched-1) + (1+relevance)/2) / float64(terms)
+}
+
+// sortKey is an attribute from the request's sort, e.g. "mod_time:desc"
+type sortKey struct {
+	attribute  string
+	descending bool
+}
+
+func parseSortKeys(keys []string) ([]sortKey, error) {
+	parsed := make([]sortKey, len(keys))
+	for i, key := range keys {
+		attribute, direction, _ := strings.Cut(key, ":")
+		if !slices.Contains(types.SortableAttributes, attribute) {
+			return nil, fmt.Errorf("attribute %q is not sortable", attribute)
+		}
+		switch direction {
+		case "asc":
+		case "desc":
+			parsed[i].descending = true
+		default:
+			return nil, fmt.Errorf("invalid sort %q, use attribute:asc or attribute:desc", key)
+		}
+		parsed[i].attribute = attribute
+	}
+	return parsed, nil
+}
+
+func (snap *snapshot) search(r *types.SearchRequest) (*types.SearchResponse, error) {
+	start := time.Now()
+
+	f, err := parseFilter(r.Filter)
+	if err != nil {
+		return nil, err
+	}
+	sortKeys, err := parseSortKeys(r.Sort)
+	if err != nil {
+		return nil, err
+	}
+	for _, facet := range r.Facets {
+		if !slices.Contains(types.FilterableAttributes, facet) {
+			return nil, fmt.Errorf("attribute %q is not filterable, so it cannot be a facet", facet)
+		}
+	}
+	terms, excluded := parseQuery(r.Query)
+
+	q := &query{snap: snap, df: make(map[string]uint64)}
+	for _, s := range snap.segments {
+		q.docs += s.live()
+	}
+	lookups := make([][][]termEntry, len(snap.segments))
+	for j, s := range snap.segments {
+		if lookups[j], err = q.lookup(s, terms); err != nil {
+			return nil, err
+		}
+	}
+
+	var candidates []candidate
+	for j, s := range snap.segments {
+		scores := make([]map[int]float64, len(terms))
+		for k, t := range terms {
+			if scores[k], err = q.score(s, t, lookups[j][k]); err != nil {
+				return nil, err
+			}
+			// Later terms only rank documents matching the first
+			if k == 0 && len(scores[0]) == 0 {
+				break
+			}
+		}
+		exclude, err := q.exclude(s, excluded)
+		if err != nil {
+			return nil, err
+		}
+
+		visit := func(i int) {
+			if s.deleted[i] || exclude[i] || (f != nil && !f(s.segment, i)) {
+				return
+			}
+			c := candidate{seg: j, doc: i}
+			for k := range terms {
+				score, ok := scores[k][i]
+				if !ok {
+					break
+				}
+				c.matched++
+				c.score += score
+			}
+			candidates = append(candidates, c)
+		}
+		if len(terms) == 0 {
+			for i := range s.IDs {
+				visit(i)
+			}
+		} else {
+			for i := range scores[0] {
+				visit(i)
+			}
+		}
+	}
+
+	var best float64
+	for _, c := range candidates {
+		best = max(best, c.score)
+	}
+	snap.rank(candidates, sortKeys)
+
+	response := &types.SearchResponse{
+		Query:              r.Query,
+		Hits:               []types.Hit{},
+		EstimatedTotalHits: int64(len(candidates)),
+	}
+	if len(r.Facets) > 0 {
+		response.FacetDistribution = snap.facets(candidates, r.Facets)
+	}
+
+	limit := r.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	from := min(max(r.Offset, 0), int64(len(candidates)), maxTotalHits)
+	to := min(from+limit, int64(len(candidates)), maxTotalHits)
+	m := newMatcher(terms)
+	for _, c := range candidates[from:to] {
+		hit, err := snap.hit(c, r, m, c.rankingScore(len(terms), best))
+		if err != nil {
+			return nil, err
+		}
+		response.Hits = append(response.Hits, hit)
+	}
+
+	response.ProcessingTimeMs = time.Since(start).Milliseconds()
+	return response, nil
+}
+
+// query holds what scoring needs across the segments of a snapshot: the
+// number of live documents and of documents containing each word
+type query struct {
+	snap *snapshot
+	docs int
+	df   map[string]uint64
+}
+
+// lookup finds the dictionary entries of each term in a segment, adding
+// their document counts to the query's
+func (q *query) lookup(s *liveSegment, terms []queryTerm) ([][]termEntry, error) {
+	entries := make([][]termEntry, len(terms))
+	for k, t := range terms {
+		for _, w := range t.words {
+			limit := 1
+			if t.prefix {
+				limit = maxPrefixWords
+			}
+			found, err := s.terms.lookup(s.termFile, w, t.prefix, limit)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range found {
+				q.df[e.term] += e.docs
+			}
+			entries[k] = append(entries[k], found...)
+		}
+	}
+	return entries, nil
+}
+
+// idf weighs a word by how few documents contain it
+func (q *query) idf(word string) float64 {
+	n := float64(max(q.docs, 1))
+	df := min(float64(q.df[word]), n)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// score returns the BM25F score of each document of a segment matching a
+// term. Attributes weigh more the earlier they are searched.
+func (q *query) score(s *liveSegment, t queryTerm, entries []termEntry) (map[int]float64, error) {
+	if t.phrase {
+		return q.scorePhrase(s, t, entries)
+	}
+
+	scores := make(map[int]float64)
+	for _, e := range entries {
+		postings, err := readPostings(s.termFile, e)
+		if err != nil {
+			return nil, err
+		}
+		weight := q.idf(e.term)
+		if e.term != t.words[0] {
+			weight *= prefixPenalty
+		}
+		for doc, tf := range s.weightedFrequencies(postings) {
+			// A term matched by several words scores its best
+			scores[doc] = max(scores[doc], weight*tf/(bm25K1+tf))
+		}
+	}
+	return scores, nil
+}
+
+// scorePhrase scores the documents containing every word of a phrase, then
+// keeps those where the words are next to each other
+func (q *query) scorePhrase(s *liveSegment, t queryTerm, entries []termEntry) (map[int]float64, error) {
+	var scores map[int]float64
+	for _, w := range t.words {
+		i := slices.IndexFunc(entries, func(e termEntry) bool { return e.term == w })
+		if i < 0 {
+			return nil, nil
+		}
+		postings, err := readPostings(s.termFile, entries[i])
+		if err != nil {
+			return nil, err
+		}
+		next := make(map[int]float64)
+		idf := q.idf(w)
+		for doc, tf := range s.weightedFrequencies(postings) {
+			if _, ok := scores[doc]; ok || scores == nil {
+				next[doc] = scores[doc] + idf*tf/(bm25K1+tf)
+			}
+		}
+		scores = next
+	}
+
+	for doc := range scores {
+		ok, err := s.containsPhrase(doc, t.words)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			delete(scores, doc)
+		}
+	}
+	return scores, nil
+}
+
+// weightedFrequencies sums a word's frequency in each document over its
+// attributes, weighted by attribute and normalised by attribute length
+func (s *segment) weightedFrequencies(postings []posting) map[int]float64 {
+	averages := s.averageLengths()
+	frequencies := make(map[int]float64)
+	for _, p := range postings {
+		a := int(p.attr)
+		if a >= len(s.Searchable) {
+			continue
+		}
+		norm := 1.0
+		if averages[a] > 0 {
+			norm = 1 - bm25B + bm25B*float64(s.Lengths[a][p.doc])/averages[a]
+		}
+		frequencies[int(p.doc)] += attributeWeight(s.Searchable[a]) * float64(p.tf) / norm
+	}
+	return frequencies
+}
+
+// attributeWeight is higher for attributes searched first
+func attributeWeight(attribute string) float64 {
+	i := slices.Index(types.SearchableAttributes, attribute)
+	if i < 0 {
+		return 1
+	}
+	return float64(len(types.SearchableAttributes) - i)
+}
+
+// averageLengths returns the average number of words in each searchable
+// attribute of the segment's documents
+func (s *segment) averageLengths() []float64 {
+	s.averagesOnce.Do(func() {
+		s.averages = make([]float64, len(s.Lengths))
+		for a, lengths := range s.Lengths {
+			var total int64
+			for _, n := range lengths {
+				total += int64(n)
+			}
+			if len(lengths) > 0 {
+				s.averages[a] = float64(total) / float64(len(lengths))
+			}
+		}
+	})
+	return s.averages
+}
+
+// containsPhrase reports whether a searchable attribute of a document has
+// the words next to each other
+func (s *liveSegment) containsPhrase(doc int, words []string) (bool, error) {
+	fields, err := s.document(doc)
+	if err != nil {
+		return false, err
+	}
+	for _, attribute := range s.Searchable {
+		raw, ok := fields[attribute]
+		if !ok {
+			continue
+		}
+		tokens := tokenize(attributeText(raw))
+		for i := 0; i+len(words) <= len(tokens); i++ {
+			match := true
+			for k, w := range words {
+				if tokens[i+k].text != w {
+					match = false
+					break
+				}
+			}
+			if match {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// exclude returns the documents of a segment containing an excluded term
+func (q *query) exclude(s *liveSegment, excluded []queryTerm) (map[int]bool, error) {
+	if len(excluded) == 0 {
+		return nil, nil
+	}
+	// Excluded words do not count towards the document frequencies
+	excludes := &query{snap: q.snap, docs: q.docs, df: make(map[string]uint64)}
+	entries, err := excludes.lookup(s, excluded)
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[int]bool)
+	for k, t := range excluded {
+		scores, err := excludes.score(s, t, entries[k])
+		if err != nil {
+			return nil, err
+		}
+		for doc := range scores {
+			docs[doc] = true
+		}
+	}
+	return docs, nil
+}
+
+// rank orders candidates by the number of query terms they match, then by
+// the sort keys, then by relevance
+func (snap *snapshot) rank(candidates []candidate, keys []sortKey) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.matched != b.matched {
+			return a.matched > b.matched
+		}
+		for _, key := range keys {
+			if c := snap.compare(key.attribute, a, b); c != 0 {
+				if key.descending {
+					// Documents without the attribute stay last
+					if snap.has(key.attribute, a) && snap.has(key.attribute, b) {
+						c = -c
+					}
+				}
+				return c < 0
+			}
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.seg != b.seg {
+			return a.seg < b.seg
+		}
+		return a.doc < b.doc
+	})
+}
+
+func (snap *snapshot) has(attribute string, c candidate) bool {
+	col := snap.segments[c.seg].Columns[attribute]
+	return col != nil && col.Present[c.doc]
+}
+
+// compare orders two candidates by an attribute ascending, numbers before
+// strings and documents without the attribute last
+func (snap *snapshot) compare(attribute string, a, b candidate) int {
+	ca, cb := snap.segments[a.seg].Columns[attribute], snap.segments[b.seg].Columns[attribute]
+	hasA, hasB := ca != nil && ca.Present[a.doc], cb != nil && cb.Present[b.doc]
+	switch {
+	case !hasA && !hasB:
+		return 0
+	case !hasA:
+		return 1
+	case !hasB:
+		return -1
+	}
+
+	numA, numB := ca.IsNumber[a.doc], cb.IsNumber[b.doc]
+	switch {
+	case numA && numB:
+		if ca.Numbers[a.doc] < cb.Numbers[b.doc] {
+			return -1
+		}
+		if ca.Numbers[a.doc] > cb.Numbers[b.doc] {
+			return 1
+		}
+		return 0
+	case numA:
+		return -1
+	case numB:
+		return 1
+	}
+
+	var sa, sb string
+	if len(ca.Strings[a.doc]) > 0 {
+		sa = strings.ToLower(ca.Strings[a.doc][0])
+	}
+	if len(cb.Strings[b.doc]) > 0 {
+		sb = strings.ToLower(cb.Strings[b.doc][0])
+	}
+	return strings.Compare(sa, sb)
+}
+
+// facets counts the candidates with each value of the facets, keeping the
+// MaxValuesPerFacet most common values
+func (snap *snapshot) facets(candidates []candidate, facets []string) map[string]map[string]int64 {
+	distribution := make(map[string]map[string]int64, len(facets))
+	for _, facet := range facets {
+		counts := make(map[string]int64)
+		for _, c := range candidates {
+			col := snap.segments[c.seg].Columns[facet]
+			if col == nil {
+				continue
+			}
+			values := col.Strings[c.doc]
+			for i, v := range values {
+				// Count each value once per document
+				if !slices.Contains(values[:i], v) {
+					counts[v]++
+				}
+			}
+		}
+
+		if len(counts) > types.MaxValuesPerFacet {
+			values := make([]string, 0, len(counts))
+			for v := range counts {
+				values = append(values, v)
+			}
+			sort.Slice(values, func(i, j int) bool {
+				if counts[values[i]] != counts[values[j]] {
+					return counts[values[i]] > counts[values[j]]
+				}
+				return values[i] < values[j]
+			})
+			for _, v := range values[types.MaxValuesPerFacet:] {
+				delete(counts, v)
+			}
+		}
+		distribution[facet] = counts
+	}
+	return distribution
+}
+
+// hit reads a candidate and formats it as the request asks
+func (snap *snapshot) hit(c candidate, r *types.SearchRequest, m *matcher, rankingScore float64) (types.Hit, error) {
+	s := snap.segments[c.seg]
+	stored, err := s.document(c.doc)
+	if err != nil {
+		return nil, err
+	}
+	displayed := project(stored, types.DisplayedAttributes())
+	hit := project(displayed, r.AttributesToRetrieve)
+
+	if len(r.AttributesToCrop) > 0 || len(r.AttributesToHighlight) > 0 {
+		formatted, err := format(displayed, r, m)
+		if err != nil {
+			return nil, err
+		}
+		hit["_formatted"] = formatted
+	}
+
+	if r.ShowMatchesPosition {
+		positions, err := matchesPosition(displayed, m)
+		if err != nil {
+			return nil, err
+		}
+		hit["_matchesPosition"] = positions
+	}
+
+	if r.ShowRankingScore {
+		score, err := json.Marshal(rankingScore)
+		if err != nil {
+			return nil, err
+		}
+		hit["_rankingScore"] = score
+	}
+	return hit, nil
+}
+
+// format crops and highlights the requested string attributes of a hit
+func format(fields types.Hit, r *types.SearchRequest, m *matcher) (json.RawMessage, error) {
+	opts := formatOptions{
+		cropLength: int(r.CropLength),
+		cropMarker: r.CropMarker,
+		preTag:     r.HighlightPreTag,
+		postTag:    r.HighlightPostTag,
+	}
+	if opts.cropLength <= 0 {
+		opts.cropLength = defaultCropLength
+	}
+	if opts.cropMarker == "" {
+		opts.cropMarker = defaultCropMarker
+	}
+	if opts.preTag == "" {
+		opts.preTag = defaultHighlightPreTag
+	}
+	if opts.postTag == "" {
+		opts.postTag = defaultHighlightPostTag
+	}
+
+	formatted := make(map[string]string)
+	for attribute, raw := range fields {
+		opts.crop = slices.Contains(r.AttributesToCrop, attribute) || slices.Contains(r.AttributesToCrop, "*")
+		opts.highlight = slices.Contains(r.AttributesToHighlight, attribute) || slices.Contains(r.AttributesToHighlight, "*")
+		if !opts.crop && !opts.highlight {
+			continue
+		}
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			continue
+		}
+		formatted[attribute] = formatText(text, m, opts)
+	}
+	return json.Marshal(formatted)
+}
+
+// matchPosition is where a matched word is in an attribute, in bytes
+type matchPosition struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// matchesPosition locates the matched words of each searchable string
+// attribute of a hit
+func matchesPosition(fields types.Hit, m *matcher) (json.RawMessage, error) {
+	positions := make(map[string][]matchPosition)
+	for _, attribute := range types.SearchableAttributes {
+		var text string
+		if err := json.Unmarshal(fields[attribute], &text); err != nil {
+			continue
+		}
+		for _, t := range m.matches(text) {
+			positions[attribute] = append(positions[attribute], matchPosition{Start: t.start, Length: t.end - t.start})
+		}
+	}
+	return json.Marshal(positions)
+}
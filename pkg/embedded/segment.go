@@ -0,0 +1,445 @@
+package embedded
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// A segment is an immutable batch of documents stored in three files named
+// after it: the documents as JSON lines (.docs), a header with their IDs and
+// the attributes filters, facets and sorting read (.meta), and the inverted
+// index of their searchable attributes (.terms). Writes add segments, and
+// documents replaced or deleted later are masked out by the manifest until
+// segments are merged.
+const (
+	docsExt  = ".docs"
+	metaExt  = ".meta"
+	termsExt = ".terms"
+)
+
+// document is a stored document, field by field
+type document struct {
+	id     string
+	fields map[string]json.RawMessage
+}
+
+// column holds one filterable or sortable attribute of every document in a
+// segment. Values are kept as strings, numbers as written; Numbers holds the
+// value of documents whose attribute is a number.
+type column struct {
+	Present  []bool
+	IsNumber []bool
+	Numbers  []float64
+	Strings  [][]string
+}
+
+// segmentHeader is the content of a .meta file
+type segmentHeader struct {
+	IDs []string
+
+	// The JSON of document i is bytes Offsets[i] to Offsets[i+1] of .docs
+	Offsets []int64
+
+	// Fields are the top-level fields seen in the segment; bit i of a
+	// document's FieldMasks entry is set if it has Fields[i]
+	Fields     []string
+	FieldMasks []uint64
+
+	// Searchable lists the attributes the terms file indexes, in the order
+	// of their attribute numbers. Lengths[a][i] is the number of words in
+	// attribute a of document i.
+	Searchable []string
+	Lengths    [][]int32
+
+	Columns map[string]*column
+}
+
+// segment is a loaded segment: its header and the block index of its terms
+type segment struct {
+	name string
+	dir  string
+	segmentHeader
+	terms *termsIndex
+	ids   map[string]int
+
+	// The average length of each searchable attribute, computed on first
+	// search
+	averagesOnce sync.Once
+	averages     []float64
+}
+
+func (s *segment) path(ext string) string {
+	return filepath.Join(s.dir, s.name+ext)
+}
+
+func (s *segment) docs() int {
+	return len(s.IDs)
+}
+
+// columnAttributes are the attributes stored in columns
+func columnAttributes() []string {
+	attributes := slices.Clone(types.FilterableAttributes)
+	for _, a := range types.SortableAttributes {
+		if !slices.Contains(attributes, a) {
+			attributes = append(attributes, a)
+		}
+	}
+	return attributes
+}
+
+// outdated reports whether the segment indexes other attributes than this
+// version of memex searches, filters and sorts on
+func (s *segment) outdated() bool {
+	if !slices.Equal(s.Searchable, types.SearchableAttributes) {
+		return true
+	}
+	for _, a := range columnAttributes() {
+		if s.Columns[a] == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// newSegment allocates the header of a segment of n documents
+func newSegment(dir, name string, n int) *segment {
+	s := &segment{name: name, dir: dir, ids: make(map[string]int, n)}
+	s.IDs = make([]string, n)
+	s.Offsets = make([]int64, 0, n+1)
+	s.FieldMasks = make([]uint64, n)
+	s.Searchable = slices.Clone(types.SearchableAttributes)
+	s.Lengths = make([][]int32, len(s.Searchable))
+	for a := range s.Lengths {
+		s.Lengths[a] = make([]int32, n)
+	}
+	s.Columns = make(map[string]*column)
+	for _, a := range columnAttributes() {
+		s.Columns[a] = &column{
+			Present:  make([]bool, n),
+			IsNumber: make([]bool, n),
+			Numbers:  make([]float64, n),
+			Strings:  make([][]string, n),
+		}
+	}
+	return s
+}
+
+// fieldBit returns the bit of field in FieldMasks, adding the field to the
+// segment on first use. Documents have far fewer than 64 fields; more are
+// not counted.
+func (s *segment) fieldBit(bits map[string]int, field string) (uint64, bool) {
+	bit, ok := bits[field]
+	if !ok {
+		bit = len(s.Fields)
+		bits[field] = bit
+		s.Fields = append(s.Fields, field)
+	}
+	return 1 << bit, bit < 64
+}
+
+// writeSegment stores docs as a new segment called name in dir
+func writeSegment(dir, name string, docs []document) (*segment, error) {
+	s := newSegment(dir, name, len(docs))
+
+	f, err := os.Create(s.path(docsExt))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	fieldBits := make(map[string]int)
+	postings := make(map[string][]posting)
+	var offset int64
+	for i, doc := range docs {
+		s.IDs[i] = doc.id
+		s.ids[doc.id] = i
+
+		data, err := json.Marshal(doc.fields)
+		if err != nil {
+			return nil, err
+		}
+		s.Offsets = append(s.Offsets, offset)
+		w.Write(data)
+		w.WriteByte('\n')
+		offset += int64(len(data)) + 1
+
+		for field := range doc.fields {
+			if bit, ok := s.fieldBit(fieldBits, field); ok {
+				s.FieldMasks[i] |= bit
+			}
+		}
+
+		for attribute, c := range s.Columns {
+			if raw, ok := doc.fields[attribute]; ok {
+				c.set(i, raw)
+			}
+		}
+
+		for a, attribute := range s.Searchable {
+			raw, ok := doc.fields[attribute]
+			if !ok {
+				continue
+			}
+			tokens := tokenize(attributeText(raw))
+			s.Lengths[a][i] = int32(len(tokens))
+
+			counts := make(map[string]uint32)
+			for _, t := range tokens {
+				if len(t.text) <= maxTermLength {
+					counts[t.text]++
+				}
+			}
+			for word, tf := range counts {
+				postings[word] = append(postings[word], posting{doc: uint32(i), attr: uint8(a), tf: tf})
+			}
+		}
+	}
+	s.Offsets = append(s.Offsets, offset)
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+
+	// Attributes were added in order for each document, so postings are
+	// already ordered by document
+	if err := s.save(postings); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// mergeSegments writes the live documents of segments as one new segment
+// called name in dir. Documents are copied as they are stored and their
+// postings renumbered, so nothing is tokenized again; the segments must
+// not be outdated.
+func mergeSegments(dir, name string, segments []*liveSegment) (*segment, error) {
+	n := 0
+	for _, src := range segments {
+		n += src.live()
+	}
+	s := newSegment(dir, name, n)
+
+	f, err := os.Create(s.path(docsExt))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	fieldBits := make(map[string]int)
+	postings := make(map[string][]posting)
+	var offset int64
+	i := 0
+	for _, src := range segments {
+		// remap holds the new number of each live document, or -1
+		remap := make([]int, src.docs())
+		for j := range src.IDs {
+			if src.deleted[j] {
+				remap[j] = -1
+				continue
+			}
+			remap[j] = i
+
+			data, err := src.rawDocument(src.docFile, j)
+			if err != nil {
+				return nil, err
+			}
+			s.IDs[i] = src.IDs[j]
+			s.ids[src.IDs[j]] = i
+			s.Offsets = append(s.Offsets, offset)
+			w.Write(data)
+			offset += int64(len(data))
+
+			for b, field := range src.Fields[:min(len(src.Fields), 64)] {
+				if src.FieldMasks[j]&(1<<b) == 0 {
+					continue
+				}
+				if bit, ok := s.fieldBit(fieldBits, field); ok {
+					s.FieldMasks[i] |= bit
+				}
+			}
+			for a := range s.Lengths {
+				s.Lengths[a][i] = src.Lengths[a][j]
+			}
+			for attribute, c := range s.Columns {
+				c.copy(i, src.Columns[attribute], j)
+			}
+			i++
+		}
+
+		// Segments are copied in order, so postings stay ordered by document
+		err := src.terms.each(src.termFile, func(e termEntry) error {
+			found, err := readPostings(src.termFile, e)
+			if err != nil {
+				return err
+			}
+			for _, p := range found {
+				if int(p.doc) >= len(remap) || remap[p.doc] < 0 {
+					continue
+				}
+				p.doc = uint32(remap[p.doc])
+				postings[e.term] = append(postings[e.term], p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.Offsets = append(s.Offsets, offset)
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	if err := s.save(postings); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// save writes the terms and header files of a segment whose documents are
+// written
+func (s *segment) save(postings map[string][]posting) error {
+	var err error
+	if err = writeTerms(s.path(termsExt), postings); err != nil {
+		return err
+	}
+	if s.terms, err = loadTermsIndex(s.path(termsExt)); err != nil {
+		return err
+	}
+	return writeHeader(s.path(metaExt), &s.segmentHeader)
+}
+
+// set records a document's value of the column's attribute
+func (c *column) set(doc int, raw json.RawMessage) {
+	c.Present[doc] = true
+
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return
+	}
+	switch v := v.(type) {
+	case string:
+		c.Strings[doc] = []string{v}
+	case json.Number:
+		c.Strings[doc] = []string{v.String()}
+		if n, err := v.Float64(); err == nil {
+			c.IsNumber[doc] = true
+			c.Numbers[doc] = n
+		}
+	case bool:
+		c.Strings[doc] = []string{strconv.FormatBool(v)}
+	case []any:
+		for _, e := range v {
+			switch e := e.(type) {
+			case string:
+				c.Strings[doc] = append(c.Strings[doc], e)
+			case json.Number:
+				c.Strings[doc] = append(c.Strings[doc], e.String())
+			}
+		}
+	}
+}
+
+// copy sets a document's value to that of document j of another column
+func (c *column) copy(doc int, src *column, j int) {
+	if src == nil || !src.Present[j] {
+		return
+	}
+	c.Present[doc] = true
+	c.IsNumber[doc] = src.IsNumber[j]
+	c.Numbers[doc] = src.Numbers[j]
+	c.Strings[doc] = src.Strings[j]
+}
+
+func writeHeader(path string, h *segmentHeader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err := gob.NewEncoder(w).Encode(h); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// loadSegment reads the header and terms index of a segment
+func loadSegment(dir, name string) (*segment, error) {
+	s := &segment{name: name, dir: dir}
+
+	f, err := os.Open(s.path(metaExt))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&s.segmentHeader); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path(metaExt), errCorrupt)
+	}
+	if len(s.Offsets) != len(s.IDs)+1 || len(s.FieldMasks) != len(s.IDs) {
+		return nil, fmt.Errorf("%s: %w", s.path(metaExt), errCorrupt)
+	}
+
+	if s.terms, err = loadTermsIndex(s.path(termsExt)); err != nil {
+		return nil, err
+	}
+
+	s.ids = make(map[string]int, len(s.IDs))
+	for i, id := range s.IDs {
+		s.ids[id] = i
+	}
+	return s, nil
+}
+
+// rawDocument reads the line of document i from the segment's open .docs
+// file
+func (s *segment) rawDocument(f *os.File, i int) ([]byte, error) {
+	data := make([]byte, s.Offsets[i+1]-s.Offsets[i])
+	if _, err := f.ReadAt(data, s.Offsets[i]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readDocument reads the JSON of document i from the segment's open .docs
+// file
+func (s *segment) readDocument(f *os.File, i int) (map[string]json.RawMessage, error) {
+	data, err := s.rawDocument(f, i)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path(docsExt), errCorrupt)
+	}
+	return fields, nil
+}
+
+// size returns the size of document i's JSON
+func (s *segment) size(i int) int64 {
+	return s.Offsets[i+1] - s.Offsets[i]
+}
@@ -0,0 +1,338 @@
+package embedded
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A terms file maps each word of a segment to its postings, the documents
+// and attributes it occurs in. It holds the postings lists, then the sorted
+// dictionary in blocks of termsBlockSize entries, then an index of the first
+// word of each block, and ends with a footer locating the index:
+//
+//	postings | dictionary blocks | block index | index offset, index length, magic
+//
+// Only the block index is kept in memory; a lookup reads one block and the
+// postings of the words it matches.
+const (
+	termsMagic      = "MXT1"
+	termsFooterSize = 8 + 8 + len(termsMagic)
+	termsBlockSize  = 64
+)
+
+// posting records that a word occurs tf times in an attribute of a document
+type posting struct {
+	doc  uint32
+	attr uint8
+	tf   uint32
+}
+
+// termEntry is a dictionary entry: a word, where its postings are and how
+// many documents contain it
+type termEntry struct {
+	term   string
+	offset uint64
+	length uint64
+	docs   uint64
+}
+
+// blockRef locates a dictionary block and gives its first word
+type blockRef struct {
+	first  string
+	offset uint64
+	length uint64
+}
+
+// termsIndex is the block index of a terms file
+type termsIndex struct {
+	blocks []blockRef
+}
+
+// writeTerms writes the postings of every word to path. Each word's
+// postings must be ordered by document.
+func writeTerms(path string, postings map[string][]posting) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	words := make([]string, 0, len(postings))
+	for word := range postings {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	var (
+		offset  uint64
+		entries = make([]termEntry, 0, len(words))
+		buf     []byte
+	)
+	for _, word := range words {
+		var docs uint64
+		buf, docs = encodePostings(buf[:0], postings[word])
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		entries = append(entries, termEntry{term: word, offset: offset, length: uint64(len(buf)), docs: docs})
+		offset += uint64(len(buf))
+	}
+
+	var blocks []blockRef
+	for start := 0; start < len(entries); start += termsBlockSize {
+		buf = buf[:0]
+		for _, e := range entries[start:min(start+termsBlockSize, len(entries))] {
+			buf = appendString(buf, e.term)
+			buf = binary.AppendUvarint(buf, e.offset)
+			buf = binary.AppendUvarint(buf, e.length)
+			buf = binary.AppendUvarint(buf, e.docs)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		blocks = append(blocks, blockRef{first: entries[start].term, offset: offset, length: uint64(len(buf))})
+		offset += uint64(len(buf))
+	}
+
+	buf = binary.AppendUvarint(buf[:0], uint64(len(blocks)))
+	for _, b := range blocks {
+		buf = appendString(buf, b.first)
+		buf = binary.AppendUvarint(buf, b.offset)
+		buf = binary.AppendUvarint(buf, b.length)
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, offset)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(buf)-8))
+	buf = append(buf, termsMagic...)
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// encodePostings appends postings grouped by document: the gap from the
+// previous document, the number of attributes, then each attribute and
+// its frequency. It also returns the number of documents.
+func encodePostings(buf []byte, postings []posting) ([]byte, uint64) {
+	var (
+		docs uint64
+		prev uint32
+	)
+	for i := 0; i < len(postings); {
+		j := i
+		for j < len(postings) && postings[j].doc == postings[i].doc {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(postings[i].doc-prev))
+		buf = binary.AppendUvarint(buf, uint64(j-i))
+		for _, p := range postings[i:j] {
+			buf = append(buf, p.attr)
+			buf = binary.AppendUvarint(buf, uint64(p.tf))
+		}
+		prev = postings[i].doc
+		docs++
+		i = j
+	}
+	return buf, docs
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// errCorrupt reports a segment file that cannot be decoded
+var errCorrupt = errors.New("corrupt index file")
+
+// loadTermsIndex reads the block index of the terms file at path
+func loadTermsIndex(path string) (*termsIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(termsFooterSize) {
+		return nil, fmt.Errorf("%s: %w", path, errCorrupt)
+	}
+	footer := make([]byte, termsFooterSize)
+	if _, err := f.ReadAt(footer, info.Size()-int64(termsFooterSize)); err != nil {
+		return nil, err
+	}
+	if string(footer[16:]) != termsMagic {
+		return nil, fmt.Errorf("%s: %w", path, errCorrupt)
+	}
+	offset := binary.LittleEndian.Uint64(footer)
+	length := binary.LittleEndian.Uint64(footer[8:])
+	if offset+length > uint64(info.Size()) {
+		return nil, fmt.Errorf("%s: %w", path, errCorrupt)
+	}
+
+	data := make([]byte, length)
+	if _, err := f.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, errCorrupt)
+	}
+	index := &termsIndex{blocks: make([]blockRef, 0, n)}
+	for i := uint64(0); i < n; i++ {
+		var b blockRef
+		if b.first, err = readString(r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, errCorrupt)
+		}
+		if b.offset, err = binary.ReadUvarint(r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, errCorrupt)
+		}
+		if b.length, err = binary.ReadUvarint(r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, errCorrupt)
+		}
+		index.blocks = append(index.blocks, b)
+	}
+	return index, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(r.Len()) {
+		return "", errCorrupt
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// lookup returns the entry of word, or with prefix set the entries of every
+// word starting with it, at most limit of them
+func (t *termsIndex) lookup(f *os.File, word string, prefix bool, limit int) ([]termEntry, error) {
+	// The first block that may hold word is the last starting at or before it
+	i := sort.Search(len(t.blocks), func(i int) bool { return t.blocks[i].first > word })
+	i = max(i-1, 0)
+
+	var entries []termEntry
+	for ; i < len(t.blocks); i++ {
+		block, err := t.readBlock(f, t.blocks[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range block {
+			switch {
+			case e.term < word:
+				continue
+			case e.term == word, prefix && strings.HasPrefix(e.term, word):
+				entries = append(entries, e)
+				if len(entries) >= limit {
+					return entries, nil
+				}
+			default:
+				return entries, nil
+			}
+		}
+		if !prefix {
+			return entries, nil
+		}
+	}
+	return entries, nil
+}
+
+// each calls fn with every dictionary entry of the terms file, in order
+func (t *termsIndex) each(f *os.File, fn func(e termEntry) error) error {
+	for _, b := range t.blocks {
+		block, err := t.readBlock(f, b)
+		if err != nil {
+			return err
+		}
+		for _, e := range block {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *termsIndex) readBlock(f *os.File, b blockRef) ([]termEntry, error) {
+	data := make([]byte, b.length)
+	if _, err := f.ReadAt(data, int64(b.offset)); err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	entries := make([]termEntry, 0, termsBlockSize)
+	for r.Len() > 0 {
+		var (
+			e   termEntry
+			err error
+		)
+		if e.term, err = readString(r); err != nil {
+			return nil, errCorrupt
+		}
+		if e.offset, err = binary.ReadUvarint(r); err != nil {
+			return nil, errCorrupt
+		}
+		if e.length, err = binary.ReadUvarint(r); err != nil {
+			return nil, errCorrupt
+		}
+		if e.docs, err = binary.ReadUvarint(r); err != nil {
+			return nil, errCorrupt
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// readPostings reads and decodes the postings of a dictionary entry
+func readPostings(f *os.File, e termEntry) ([]posting, error) {
+	data := make([]byte, e.length)
+	if _, err := f.ReadAt(data, int64(e.offset)); err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(data)
+	postings := make([]posting, 0, e.docs)
+	var doc uint32
+	for r.Len() > 0 {
+		gap, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errCorrupt
+		}
+		attrs, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errCorrupt
+		}
+		doc += uint32(gap)
+		for ; attrs > 0; attrs-- {
+			attr, err := r.ReadByte()
+			if err != nil {
+				return nil, errCorrupt
+			}
+			tf, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errCorrupt
+			}
+			postings = append(postings, posting{doc: doc, attr: attr, tf: uint32(tf)})
+		}
+	}
+	return postings, nil
+}
@@ -0,0 +1,120 @@
+package embedded
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTermLength is the longest word that is indexed, in bytes. Longer runs
+// of letters are usually encoded data rather than words.
+const maxTermLength = 64
+
+// token is a word of a text and where it is, in bytes
+type token struct {
+	text  string
+	start int
+	end   int
+}
+
+// tokenize splits text into lower-cased words: runs of letters and digits,
+// with each Chinese, Japanese and Korean character a word of its own
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	ascii := true
+	flush := func(end int) {
+		if start >= 0 {
+			word := text[start:end]
+			if !ascii || hasUpper(word) {
+				word = strings.ToLower(word)
+			}
+			tokens = append(tokens, token{text: word, start: start, end: end})
+			start, ascii = -1, true
+		}
+	}
+
+	for i := 0; i < len(text); {
+		// Most text is ASCII, which needs no Unicode tables
+		if c := text[i]; c < utf8.RuneSelf {
+			if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+				if start < 0 {
+					start = i
+				}
+			} else {
+				flush(i)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case ideographic(r):
+			flush(i)
+			tokens = append(tokens, token{text: text[i : i+size], start: i, end: i + size})
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			if start < 0 {
+				start = i
+			}
+			ascii = false
+		default:
+			flush(i)
+		}
+		i += size
+	}
+	flush(len(text))
+	return tokens
+}
+
+func hasUpper(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if 'A' <= word[i] && word[i] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+func ideographic(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// attributeText returns the words of a field's JSON value: a string as it
+// is, and the elements of arrays and values of objects one per line
+func attributeText(raw json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	appendText(&b, v)
+	return b.String()
+}
+
+func appendText(b *strings.Builder, v any) {
+	switch v := v.(type) {
+	case string:
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(v)
+	case json.Number, float64, bool:
+		// Numbers are not searched
+	case []any:
+		for _, e := range v {
+			appendText(b, e)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			appendText(b, v[k])
+		}
+	}
+}
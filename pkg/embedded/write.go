@@ -0,0 +1,364 @@
+package embedded
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+)
+
+const (
+	// mergeFactor bounds how much larger a segment may be than the one
+	// written after it before the two are merged. Merging like a counter
+	// keeps the number of segments logarithmic in the number of documents.
+	mergeFactor = 4
+
+	// maxSegments is how many segments an index may have before the newest
+	// are merged regardless of their sizes
+	maxSegments = 20
+)
+
+// AddDocuments stores documents, replacing any with the same ID
+func (x *Index) AddDocuments(docs any) error {
+	parsed, err := decodeDocuments(docs)
+	if err != nil {
+		return err
+	}
+	return x.update(func(t *txn) error {
+		for _, doc := range parsed {
+			t.put(doc)
+		}
+		return nil
+	})
+}
+
+// UpdateDocuments merges the fields of partial documents into the stored
+// ones. A document that is not stored is added as it is.
+func (x *Index) UpdateDocuments(docs any) error {
+	parsed, err := decodeDocuments(docs)
+	if err != nil {
+		return err
+	}
+	return x.update(func(t *txn) error {
+		for _, doc := range parsed {
+			stored, ok, err := t.get(doc.id)
+			if err != nil {
+				return err
+			}
+			if ok {
+				fields := maps.Clone(stored)
+				maps.Copy(fields, doc.fields)
+				doc.fields = fields
+			}
+			t.put(doc)
+		}
+		return nil
+	})
+}
+
+// DeleteDocuments removes documents by ID. IDs that are not stored are
+// ignored.
+func (x *Index) DeleteDocuments(ids []string) error {
+	return x.update(func(t *txn) error {
+		for _, id := range ids {
+			t.remove(id)
+		}
+		return nil
+	})
+}
+
+// DeleteAllDocuments empties the index
+func (x *Index) DeleteAllDocuments() error {
+	return x.update(func(t *txn) error {
+		t.clear = true
+		return nil
+	})
+}
+
+// decodeDocuments converts a slice of documents to their JSON fields
+func decodeDocuments(docs any) ([]document, error) {
+	data, err := json.Marshal(docs)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, fmt.Errorf("documents must be a list of objects: %w", err)
+	}
+
+	parsed := make([]document, len(objects))
+	for i, fields := range objects {
+		var id string
+		if err := json.Unmarshal(fields["id"], &id); err != nil || id == "" {
+			return nil, fmt.Errorf("document %d has no string id", i)
+		}
+		parsed[i] = document{id: id, fields: fields}
+	}
+	return parsed, nil
+}
+
+// txn collects the changes of one write, which commit applies by adding a
+// segment and masking out the documents it replaces
+type txn struct {
+	x    *Index
+	snap *snapshot
+
+	docs    []document
+	byID    map[string]int
+	deleted map[string]bool
+
+	// clear drops every stored document, and rebuild rewrites outdated
+	// segments
+	clear   bool
+	rebuild bool
+
+	// opened holds segments written during the commit, closed with it
+	opened []*liveSegment
+}
+
+// update runs fn on a transaction holding the index's write lock, then
+// commits it. The index is created if it does not exist.
+func (x *Index) update(fn func(t *txn) error) error {
+	x.writeMu.Lock()
+	defer x.writeMu.Unlock()
+
+	if err := os.MkdirAll(x.dir, 0o755); err != nil {
+		return err
+	}
+	lock, err := lockIndex(x.dir)
+	if err != nil {
+		return err
+	}
+	defer unlockIndex(lock)
+
+	m, err := readManifest(x.dir)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = &manifest{Format: formatVersion, Next: 1}
+	}
+	snap, err := x.load(m)
+	if err != nil {
+		return err
+	}
+
+	t := &txn{x: x, snap: snap, byID: make(map[string]int), deleted: make(map[string]bool)}
+	err = fn(t)
+	if err == nil {
+		m, err = t.commit()
+	}
+	t.close()
+	if err != nil {
+		return err
+	}
+
+	// Files are removed once closed, since Windows cannot delete open files
+	x.forget(m)
+	removeUnused(x.dir, m)
+	return nil
+}
+
+func (t *txn) close() {
+	t.snap.close()
+	for _, s := range t.opened {
+		s.close()
+	}
+}
+
+func (t *txn) put(doc document) {
+	if i, ok := t.byID[doc.id]; ok {
+		t.docs[i] = doc
+	} else {
+		t.byID[doc.id] = len(t.docs)
+		t.docs = append(t.docs, doc)
+	}
+	delete(t.deleted, doc.id)
+}
+
+func (t *txn) remove(id string) {
+	if i, ok := t.byID[id]; ok {
+		t.docs[i].fields = nil
+		delete(t.byID, id)
+	}
+	t.deleted[id] = true
+}
+
+// get returns a document as of the changes made so far
+func (t *txn) get(id string) (map[string]json.RawMessage, bool, error) {
+	if i, ok := t.byID[id]; ok {
+		return t.docs[i].fields, true, nil
+	}
+	if t.clear || t.deleted[id] {
+		return nil, false, nil
+	}
+	s, i, ok := t.snap.find(id)
+	if !ok {
+		return nil, false, nil
+	}
+	fields, err := s.document(i)
+	return fields, err == nil, err
+}
+
+// commit writes the new segment, merges segments as needed and replaces the
+// manifest, returning the new one
+func (t *txn) commit() (*manifest, error) {
+	m := &manifest{Format: formatVersion, Next: t.snap.manifest.Next}
+
+	// A copy, since dropping and merging segments below must not disturb
+	// the snapshot, which closes its segments with the txn
+	var segments []*liveSegment
+	if !t.clear {
+		segments = slices.Clone(t.snap.segments)
+	}
+
+	// Mask out the stored versions of replaced and deleted documents
+	for _, s := range segments {
+		for id := range t.byID {
+			if i, ok := s.ids[id]; ok {
+				s.deleted[i] = true
+			}
+		}
+		for id := range t.deleted {
+			if i, ok := s.ids[id]; ok {
+				s.deleted[i] = true
+			}
+		}
+	}
+
+	var docs []document
+	for _, doc := range t.docs {
+		if doc.fields != nil {
+			docs = append(docs, doc)
+		}
+	}
+	if len(docs) > 0 {
+		s, err := t.write(m, docs)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, s)
+	}
+
+	// Segments left without live documents are dropped rather than merged,
+	// and their files closed now
+	segments = slices.DeleteFunc(segments, func(s *liveSegment) bool {
+		if s.live() > 0 {
+			return false
+		}
+		s.close()
+		return true
+	})
+
+	if t.rebuild {
+		var outdated, current []*liveSegment
+		for _, s := range segments {
+			if s.outdated() {
+				outdated = append(outdated, s)
+			} else {
+				current = append(current, s)
+			}
+		}
+		if len(outdated) > 0 {
+			s, err := t.merge(m, outdated)
+			if err != nil {
+				return nil, err
+			}
+			segments = append([]*liveSegment{s}, current...)
+		}
+	}
+
+	segments, err := t.mergeTail(m, segments)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range segments {
+		info := segmentInfo{Name: s.name, Docs: s.docs()}
+		for i, d := range s.deleted {
+			if d {
+				info.Deleted = append(info.Deleted, i)
+			}
+		}
+		m.Segments = append(m.Segments, info)
+	}
+	if err := writeManifest(t.x.dir, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// mergeTail merges the newest segments while the one before the newest is
+// not much larger, or while there are too many
+func (t *txn) mergeTail(m *manifest, segments []*liveSegment) ([]*liveSegment, error) {
+	for len(segments) >= 2 {
+		n := len(segments)
+		older, newer := segments[n-2], segments[n-1]
+		if older.live() > mergeFactor*newer.live() && n <= maxSegments {
+			break
+		}
+		merged, err := t.merge(m, segments[n-2:])
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments[:n-2], merged)
+	}
+	return segments, nil
+}
+
+// merge writes the live documents of segments as one new segment. Outdated
+// segments are indexed again from their documents.
+func (t *txn) merge(m *manifest, segments []*liveSegment) (*liveSegment, error) {
+	if !slices.ContainsFunc(segments, func(s *liveSegment) bool { return s.outdated() }) {
+		return t.open(m, func(name string) (*segment, error) {
+			return mergeSegments(t.x.dir, name, segments)
+		})
+	}
+
+	var docs []document
+	for _, s := range segments {
+		for i, id := range s.IDs {
+			if s.deleted[i] {
+				continue
+			}
+			fields, err := s.document(i)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, document{id: id, fields: fields})
+		}
+	}
+	return t.write(m, docs)
+}
+
+// write stores docs as a new segment
+func (t *txn) write(m *manifest, docs []document) (*liveSegment, error) {
+	return t.open(m, func(name string) (*segment, error) {
+		return writeSegment(t.x.dir, name, docs)
+	})
+}
+
+// open creates a segment named after the manifest's counter and opens it.
+// The random suffix keeps the name unique if the index is deleted and
+// created again while another process has the old segments loaded.
+func (t *txn) open(m *manifest, create func(name string) (*segment, error)) (*liveSegment, error) {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%08d-%x", m.Next, suffix)
+	m.Next++
+
+	s, err := create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write segment: %w", err)
+	}
+	t.x.cache(s)
+
+	ls, err := openLive(s, make([]bool, s.docs()))
+	if err != nil {
+		return nil, err
+	}
+	t.opened = append(t.opened, ls)
+	return ls, nil
+}
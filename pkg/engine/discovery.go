@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sahil485/memex/pkg/config"
+)
+
+// Discovery is the endpoint record a running server leaves in
+// ~/.memex/endpoint.json so other processes can find it
+type Discovery struct {
+	URL       string `json:"url"`
+	PID       int    `json:"pid"`
+	StartedAt int64  `json:"started_at"`
+}
+
+// Stale reports whether the process that recorded the endpoint has exited
+func (d *Discovery) Stale() bool {
+	return !processAlive(d.PID)
+}
+
+// DiscoveryPath returns the location of the endpoint file
+func DiscoveryPath() string {
+	return filepath.Join(config.Dir(), "endpoint.json")
+}
+
+// ReadDiscovery returns the recorded endpoint, or nil if there is none
+func ReadDiscovery() (*Discovery, error) {
+	data, err := os.ReadFile(DiscoveryPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var d Discovery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("invalid endpoint file %s: %w", DiscoveryPath(), err)
+	}
+	return &d, nil
+}
+
+// writeDiscovery records the endpoint of a server we started
+func writeDiscovery(d Discovery) error {
+	if err := os.MkdirAll(config.Dir(), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so readers never see a partial file
+	tmp := DiscoveryPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, DiscoveryPath())
+}
+
+// removeDiscovery deletes the endpoint file if it still belongs to pid
+func removeDiscovery(pid int) {
+	d, err := ReadDiscovery()
+	if err == nil && d != nil && d.PID == pid {
+		os.Remove(DiscoveryPath())
+	}
+}
+
+// Endpoint returns the URL clients should connect to: the configured URL if
+// one is set, otherwise the one recorded by the running server, otherwise
+// the configured host and port
+func Endpoint() string {
+	cfg := config.Current()
+	if cfg.MeilisearchURL != "" {
+		return cfg.MeilisearchURL
+	}
+
+	if d, err := ReadDiscovery(); err == nil && d != nil && d.URL != "" {
+		return d.URL
+	}
+
+	return DefaultSettings().URL()
+}
+
+// Healthy reports whether a Meilisearch server answers at url
+func Healthy(url string) bool {
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(url + "/health")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
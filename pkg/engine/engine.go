@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/sahil485/memex/pkg/config"
+)
+
+// Settings describe how the managed Meilisearch server is run
+type Settings struct {
+	BinaryPath string
+	DBPath     string
+	Host       string
+	Port       int
+}
+
+// DefaultSettings returns the settings from the current configuration
+func DefaultSettings() Settings {
+	cfg := config.Current()
+	return Settings{
+		BinaryPath: cfg.MeilisearchBinary,
+		DBPath:     cfg.MeilisearchDBPath,
+		Host:       cfg.MeilisearchHost,
+		Port:       cfg.MeilisearchPort,
+	}
+}
+
+// Address returns the host:port the server binds to
+func (s Settings) Address() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// URL returns the base URL of the server
+func (s Settings) URL() string {
+	return "http://" + s.Address()
+}
+
+// stopTimeout is how long Stop waits after SIGTERM before killing the server
+const stopTimeout = 10 * time.Second
+
+// Process is a Meilisearch server started by this package
+type Process struct {
+	Settings Settings
+	cmd      *exec.Cmd
+	exited   chan struct{}
+	log      *rotatingLog
+}
+
+// Start launches Meilisearch and waits until it is healthy. If the
+// configured port is taken, a free port is chosen instead. The endpoint is
+// written to the discovery file so that client.New can find it, and the
+// server's output is appended to LogPath.
+//
+// Most callers should use a Supervisor, which also restarts the server and
+// stops two processes from running it at once.
+func Start(s Settings) (*Process, error) {
+	if _, err := os.Stat(s.BinaryPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("meilisearch binary not found at %s", s.BinaryPath)
+	}
+
+	port, err := choosePort(s.Host, s.Port)
+	if err != nil {
+		return nil, err
+	}
+	s.Port = port
+
+	cmd := exec.Command(
+		s.BinaryPath,
+		"--db-path", s.DBPath,
+		"--http-addr", s.Address(),
+		"--no-analytics",
+	)
+
+	log, err := openRotatingLog(LogPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	fmt.Fprintf(log, "--- starting meilisearch on %s at %s ---\n", s.Address(), time.Now().Format(time.RFC3339))
+	cmd.Stdout = log
+	cmd.Stderr = log
+
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return nil, fmt.Errorf("failed to start meilisearch: %w", err)
+	}
+
+	p := &Process{Settings: s, cmd: cmd, exited: make(chan struct{}), log: log}
+	go func() {
+		err := cmd.Wait()
+		fmt.Fprintf(log, "--- meilisearch exited: %v ---\n", err)
+		log.Close()
+		close(p.exited)
+	}()
+
+	if err := p.waitReady(15 * time.Second); err != nil {
+		p.Stop()
+		return nil, err
+	}
+
+	err = writeDiscovery(Discovery{
+		URL:       s.URL(),
+		PID:       cmd.Process.Pid,
+		StartedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		p.Stop()
+		return nil, fmt.Errorf("failed to write endpoint file: %w", err)
+	}
+
+	return p, nil
+}
+
+// URL returns the base URL the process is serving on
+func (p *Process) URL() string {
+	return p.Settings.URL()
+}
+
+// Exited returns a channel that is closed when the process exits
+func (p *Process) Exited() <-chan struct{} {
+	return p.exited
+}
+
+// Wait blocks until the process exits
+func (p *Process) Wait() {
+	<-p.exited
+}
+
+// Stop asks the server to shut down with SIGTERM, killing it if it has not
+// exited within stopTimeout, and removes its discovery record
+func (p *Process) Stop() error {
+	removeDiscovery(p.cmd.Process.Pid)
+
+	select {
+	case <-p.exited:
+		return nil
+	default:
+	}
+
+	if err := terminate(p.cmd.Process); err == nil {
+		select {
+		case <-p.exited:
+			return nil
+		case <-time.After(stopTimeout):
+		}
+	}
+
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-p.exited
+	return nil
+}
+
+func (p *Process) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-p.exited:
+			return fmt.Errorf("meilisearch exited during startup")
+		case <-time.After(250 * time.Millisecond):
+		}
+		if Healthy(p.URL()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("meilisearch failed to start within %s", timeout)
+}
+
+// choosePort returns port if it is free on host, otherwise any free port
+func choosePort(host string, port int) (int, error) {
+	if l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port))); err == nil {
+		l.Close()
+		return port, nil
+	}
+
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, fmt.Errorf("no free port on %s: %w", host, err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
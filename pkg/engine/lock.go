@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sahil485/memex/pkg/config"
+)
+
+// ErrAlreadyRunning is returned when another memex process already
+// supervises a Meilisearch server
+var ErrAlreadyRunning = errors.New("meilisearch is already supervised by another memex process")
+
+// LockPath returns the location of the supervisor lockfile
+func LockPath() string {
+	return filepath.Join(config.Dir(), "meilisearch.lock")
+}
+
+// lock is a pidfile that marks this process as the one running Meilisearch
+type lock struct {
+	path string
+}
+
+// acquireLock creates the lockfile with our PID. A lockfile left behind by
+// a process that no longer exists is replaced.
+func acquireLock() (*lock, error) {
+	path := LockPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return &lock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if pid, ok := LockOwner(); ok && processAlive(pid) {
+			return nil, ErrAlreadyRunning
+		}
+		// Stale lock from a crashed process
+		os.Remove(path)
+	}
+
+	return nil, ErrAlreadyRunning
+}
+
+// release removes the lockfile
+func (l *lock) release() {
+	os.Remove(l.path)
+}
+
+// LockOwner returns the PID recorded in the lockfile, if any
+func LockOwner() (int, bool) {
+	data, err := os.ReadFile(LockPath())
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return pid, true
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sahil485/memex/pkg/config"
+)
+
+const (
+	// logMaxBytes is the size at which the server log is rotated
+	logMaxBytes = 10 << 20
+
+	// logBackups is how many rotated logs are kept
+	logBackups = 3
+)
+
+// LogPath returns the location of the Meilisearch server log
+func LogPath() string {
+	return filepath.Join(config.Dir(), "logs", "meilisearch.log")
+}
+
+// rotatingLog is an append-only log file that is renamed to .1, .2, ...
+// once it grows past logMaxBytes
+type rotatingLog struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openRotatingLog(path string) (*rotatingLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	l := &rotatingLog{path: path}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *rotatingLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size+int64(len(p)) > logMaxBytes {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate shifts meilisearch.log to .1, .1 to .2 and so on, dropping the oldest
+func (l *rotatingLog) rotate() error {
+	l.file.Close()
+
+	for i := logBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	os.Rename(l.path, l.path+".1")
+
+	return l.open()
+}
+
+func (l *rotatingLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
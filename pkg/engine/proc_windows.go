@@ -0,0 +1,29 @@
+//go:build windows
+
+package engine
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == 259 // STILL_ACTIVE
+}
+
+// terminate stops the process. Windows has no SIGTERM, so this is a kill.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
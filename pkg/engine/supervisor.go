@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle state of a supervised server
+type State string
+
+const (
+	StateStarting State = "starting"
+	StateReady    State = "ready"
+	StateCrashed  State = "crashed"
+	StateStopped  State = "stopped"
+)
+
+const (
+	// restartBackoffMin and restartBackoffMax bound the delay between restarts
+	restartBackoffMin = time.Second
+	restartBackoffMax = time.Minute
+
+	// stableAfter is how long the server must stay up before the backoff resets
+	stableAfter = time.Minute
+)
+
+// StateChange describes a transition of the supervised server
+type StateChange struct {
+	State State  `json:"state"`
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Supervisor runs Meilisearch, restarting it with exponential backoff when
+// it crashes. A lockfile in ~/.memex ensures only one memex process (the CLI
+// or the desktop app) supervises a server at a time.
+type Supervisor struct {
+	settings Settings
+
+	// OnStateChange, if set, is called on every state transition. It is
+	// called from the supervisor's goroutine and must not block.
+	OnStateChange func(StateChange)
+
+	mu    sync.Mutex
+	state StateChange
+	lock  *lock
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func NewSupervisor(s Settings) *Supervisor {
+	return &Supervisor{
+		settings: s,
+		state:    StateChange{State: StateStopped},
+	}
+}
+
+// Start takes the lock and launches the server in the background. It
+// returns ErrAlreadyRunning if another process holds the lock; in that case
+// clients should simply use Endpoint.
+func (s *Supervisor) Start() error {
+	l, err := acquireLock()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.lock = l
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.mu.Unlock()
+
+	go s.run()
+	return nil
+}
+
+// State returns the current state
+func (s *Supervisor) State() StateChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Stop shuts the server down gracefully and releases the lock
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-done
+}
+
+// Done returns a channel that is closed once the supervisor has stopped
+func (s *Supervisor) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+func (s *Supervisor) run() {
+	defer func() {
+		s.lock.release()
+		s.setState(StateChange{State: StateStopped})
+		close(s.done)
+	}()
+
+	backoff := restartBackoffMin
+	for {
+		s.setState(StateChange{State: StateStarting})
+
+		process, err := Start(s.settings)
+		if err != nil {
+			s.setState(StateChange{State: StateCrashed, Error: err.Error()})
+		} else {
+			startedAt := time.Now()
+			s.setState(StateChange{State: StateReady, URL: process.URL()})
+
+			select {
+			case <-s.stop:
+				process.Stop()
+				return
+			case <-process.Exited():
+				process.Stop()
+			}
+
+			if time.Since(startedAt) > stableAfter {
+				backoff = restartBackoffMin
+			}
+			s.setState(StateChange{
+				State: StateCrashed,
+				Error: fmt.Sprintf("meilisearch exited unexpectedly, see %s", LogPath()),
+			})
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, restartBackoffMax)
+	}
+}
+
+func (s *Supervisor) setState(change StateChange) {
+	s.mu.Lock()
+	s.state = change
+	notify := s.OnStateChange
+	s.mu.Unlock()
+
+	if notify != nil {
+		notify(change)
+	}
+}
@@ -0,0 +1,148 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// batcher accumulates documents and uploads them in batches bounded by
+// document count and approximate payload size. Uploads run in the
+// background with at most maxInFlight uploads running at once, so memory use
+// stays bounded however large the walk is.
+type batcher[T any] struct {
+	backend  backend.SearchBackend
+	send     func(backend.SearchBackend, []T) error
+	size     func(T) int
+	maxDocs  int
+	maxBytes int
+
+	// uploaded, if set, is called with the size of each stored batch
+	uploaded func(n int)
+
+	pending []T
+	bytes   int
+
+	sem  chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+func newBatcher[T any](b backend.SearchBackend, opts Options, size func(T) int,
+	send func(backend.SearchBackend, []T) error) *batcher[T] {
+	return &batcher[T]{
+		backend:  b,
+		send:     send,
+		size:     size,
+		maxDocs:  max(opts.BatchSize, 1),
+		maxBytes: max(opts.BatchBytes, 1),
+		sem:      make(chan struct{}, max(opts.MaxInFlight, 1)),
+	}
+}
+
+// newDocumentBatcher uploads full documents, replacing any stored version
+func newDocumentBatcher(b backend.SearchBackend, opts Options) *batcher[types.Document] {
+	return newBatcher(b, opts, documentSize,
+		func(b backend.SearchBackend, docs []types.Document) error {
+			return b.AddDocuments(docs)
+		})
+}
+
+// newMetadataBatcher uploads partial documents, merging them into stored ones
+func newMetadataBatcher(b backend.SearchBackend, opts Options) *batcher[metadataUpdate] {
+	return newBatcher(b, opts, func(metadataUpdate) int { return metadataUpdateSize },
+		func(b backend.SearchBackend, docs []metadataUpdate) error {
+			return b.UpdateDocuments(docs)
+		})
+}
+
+// add queues a document, starting an upload once the batch is full
+func (b *batcher[T]) add(doc T) {
+	size := b.size(doc)
+
+	// Send what we have first if this document would push the batch over
+	// the byte limit. A single oversized document still goes out alone.
+	if len(b.pending) > 0 && b.bytes+size > b.maxBytes {
+		b.flush()
+	}
+
+	b.pending = append(b.pending, doc)
+	b.bytes += size
+
+	if len(b.pending) >= b.maxDocs || b.bytes >= b.maxBytes {
+		b.flush()
+	}
+}
+
+// flush starts uploading the pending batch. It blocks while maxInFlight
+// uploads are already running.
+func (b *batcher[T]) flush() {
+	if len(b.pending) == 0 {
+		return
+	}
+
+	docs := b.pending
+	b.pending = nil
+	b.bytes = 0
+
+	b.sem <- struct{}{}
+	b.wg.Add(1)
+	go func() {
+		defer func() {
+			<-b.sem
+			b.wg.Done()
+		}()
+
+		if err := b.upload(docs); err != nil {
+			b.mu.Lock()
+			b.errs = append(b.errs, err)
+			b.mu.Unlock()
+			return
+		}
+		if b.uploaded != nil {
+			b.uploaded(len(docs))
+		}
+	}()
+}
+
+func (b *batcher[T]) upload(docs []T) error {
+	if err := b.send(b.backend, docs); err != nil {
+		return fmt.Errorf("failed to add documents to index: %w", err)
+	}
+	return nil
+}
+
+// wait uploads anything still pending and blocks until every upload has
+// finished, returning the combined errors of the failed batches
+func (b *batcher[T]) wait() error {
+	b.flush()
+	b.wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return errors.Join(b.errs...)
+}
+
+// abort drops anything still pending and waits for the uploads already
+// started, which cannot be recalled
+func (b *batcher[T]) abort() {
+	b.pending = nil
+	b.bytes = 0
+	b.wg.Wait()
+}
+
+// documentOverhead approximates the JSON encoding cost of a document's
+// fixed-size fields (ID, hashes, numbers and keys)
+const documentOverhead = 512
+
+// metadataUpdateSize approximates the JSON size of a metadataUpdate
+const metadataUpdateSize = 160
+
+// documentSize estimates the size of doc in an upload payload
+func documentSize(doc types.Document) int {
+	return documentOverhead + len(doc.Content) + len(doc.Path) + len(doc.Name) + len(doc.Dir) + len(doc.Ext)
+}
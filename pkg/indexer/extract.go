@@ -0,0 +1,103 @@
+package indexer
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// sniffLen is how many leading bytes are used to detect a file's MIME type
+const sniffLen = 512
+
+// Extraction is the searchable content pulled out of a file
+type Extraction struct {
+	Text  string
+	Title string
+
+	// Pages holds the byte offset in Text where each page starts, for
+	// formats that have pages
+	Pages []int
+
+	// Metadata holds format-specific fields such as an author, which are
+	// stored on the document as-is
+	Metadata map[string]string
+}
+
+// Extractor turns a file into searchable text. r is positioned at the start
+// of the file; extractors that need random access may reopen path instead.
+type Extractor interface {
+	Extract(path string, r io.Reader, info os.FileInfo) (*Extraction, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface
+type ExtractorFunc func(path string, r io.Reader, info os.FileInfo) (*Extraction, error)
+
+func (f ExtractorFunc) Extract(path string, r io.Reader, info os.FileInfo) (*Extraction, error) {
+	return f(path, r, info)
+}
+
+// extractors maps lowercase extensions and MIME types to extractors.
+// Registration normally happens from init functions.
+var extractors = struct {
+	sync.RWMutex
+	byExt  map[string]Extractor
+	byMIME map[string]Extractor
+}{
+	byExt:  make(map[string]Extractor),
+	byMIME: make(map[string]Extractor),
+}
+
+// RegisterExtractor makes e handle files with any of the given extensions
+// (".pdf") or MIME types ("application/pdf", or "text/*" for a whole
+// family). Later registrations replace earlier ones.
+func RegisterExtractor(e Extractor, extensions, mimeTypes []string) {
+	extractors.Lock()
+	defer extractors.Unlock()
+
+	for _, ext := range extensions {
+		extractors.byExt[strings.ToLower(ext)] = e
+	}
+	for _, mimeType := range mimeTypes {
+		extractors.byMIME[strings.ToLower(mimeType)] = e
+	}
+}
+
+// extractorFor picks the extractor for a file: by extension first, then by
+// the MIME type sniffed from head, then the raw text extractor
+func extractorFor(path string, head []byte) Extractor {
+	extractors.RLock()
+	defer extractors.RUnlock()
+
+	if e, ok := extractors.byExt[strings.ToLower(filepath.Ext(path))]; ok {
+		return e
+	}
+
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err == nil {
+		if e, ok := extractors.byMIME[mimeType]; ok {
+			return e
+		}
+		family, _, _ := strings.Cut(mimeType, "/")
+		if e, ok := extractors.byMIME[family+"/*"]; ok {
+			return e
+		}
+	}
+
+	return rawTextExtractor
+}
+
+// extract runs the matching extractor over the file
+func extract(path string, file io.Reader, info os.FileInfo) (*Extraction, error) {
+	r := bufio.NewReaderSize(file, sniffLen)
+	head, err := r.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	return extractorFor(path, head).Extract(path, r, info)
+}
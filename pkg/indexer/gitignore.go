@@ -0,0 +1,174 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileNames are the per-directory ignore files honoured while walking,
+// lowest precedence first. .memexignore holds search-specific exclusions and
+// can re-include anything the others exclude.
+var ignoreFileNames = []string{".gitignore", ".ignore", ".memexignore"}
+
+// isIgnoreFile reports whether name is one of the ignore files
+func isIgnoreFile(name string) bool {
+	for _, n := range ignoreFileNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ignorePattern is one compiled line of an ignore file
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreFile holds the patterns of every ignore file in one directory, in
+// precedence order
+type ignoreFile struct {
+	patterns []ignorePattern
+}
+
+// loadIgnoreFile reads the ignore files in dir. It returns nil if there are none.
+func loadIgnoreFile(dir string) *ignoreFile {
+	var f ignoreFile
+
+	for _, name := range ignoreFileNames {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if p, ok := parseIgnorePattern(scanner.Text()); ok {
+				f.patterns = append(f.patterns, p)
+			}
+		}
+		file.Close()
+	}
+
+	if len(f.patterns) == 0 {
+		return nil
+	}
+	return &f
+}
+
+// match checks a slash-separated path relative to the ignore file's
+// directory. The last matching pattern decides; decided is false when no
+// pattern matches.
+func (f *ignoreFile) match(rel string, isDir bool) (decided, ignored bool) {
+	for i := len(f.patterns) - 1; i >= 0; i-- {
+		p := f.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			return true, !p.negate
+		}
+	}
+	return false, false
+}
+
+// parseIgnorePattern compiles a single gitignore line. ok is false for
+// blank lines, comments and patterns that cannot be compiled.
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	var p ignorePattern
+
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+
+	// A slash at the start or in the middle anchors the pattern to the
+	// ignore file's directory; otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return p, false
+	}
+	p.re = re
+	return p, true
+}
+
+// trimTrailingSpaces removes unescaped trailing spaces
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// globToRegexp translates gitignore glob syntax to a regular expression.
+// "*" and "?" never match a slash, "**" segments match any number of
+// directories and bracket expressions are passed through.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			// Leading "**/" or "/**/": zero or more directories
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && (i == 0 || glob[i-1] == '/') && i+2 == len(glob):
+			// Trailing "/**": everything inside
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return b.String()
+}
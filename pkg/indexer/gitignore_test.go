@@ -0,0 +1,46 @@
+package indexer
+
+import "testing"
+
+func TestIgnoreFileMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		ignored  bool
+	}{
+		{"unanchored matches at any depth", []string{"*.log"}, "a/b/debug.log", false, true},
+		{"unanchored matches the base name only", []string{"*.log"}, "logs.txt", false, false},
+		{"leading slash anchors", []string{"/build"}, "sub/build", true, false},
+		{"anchored at the root", []string{"/build"}, "build", true, true},
+		{"middle slash anchors", []string{"docs/*.md"}, "docs/a.md", false, true},
+		{"star does not cross directories", []string{"docs/*.md"}, "docs/sub/a.md", false, false},
+		{"double star crosses directories", []string{"docs/**/*.md"}, "docs/sub/deep/a.md", false, true},
+		{"leading double star", []string{"**/fixtures"}, "a/b/fixtures", true, true},
+		{"directory only skips files", []string{"cache/"}, "cache", false, false},
+		{"directory only matches directories", []string{"cache/"}, "cache", true, true},
+		{"question mark is one character", []string{"?.txt"}, "ab.txt", false, false},
+		{"bracket expression", []string{"[ab].txt"}, "b.txt", false, true},
+		{"negation re-includes", []string{"*.md", "!README.md"}, "README.md", false, false},
+		{"later pattern wins", []string{"!README.md", "*.md"}, "README.md", false, true},
+		{"comments and blank lines", []string{"# *.txt", "", "   "}, "a.txt", false, false},
+		{"escaped hash", []string{`\#notes.txt`}, "#notes.txt", false, true},
+		{"escaped bang", []string{`\!important.txt`}, "!important.txt", false, true},
+		{"trailing spaces are trimmed", []string{"a.txt   "}, "a.txt", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f ignoreFile
+			for _, line := range tt.patterns {
+				if p, ok := parseIgnorePattern(line); ok {
+					f.patterns = append(f.patterns, p)
+				}
+			}
+			if _, ignored := f.match(tt.path, tt.isDir); ignored != tt.ignored {
+				t.Errorf("%q with %q: ignored = %v, want %v", tt.path, tt.patterns, ignored, tt.ignored)
+			}
+		})
+	}
+}
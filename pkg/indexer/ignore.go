@@ -0,0 +1,226 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sahil485/memex/pkg/config"
+)
+
+// ignoreRules decides which paths are left out of the index. It combines the
+// user's --ignore patterns, the built-in directory and extension lists, and
+// any .gitignore, .ignore and .memexignore files found along the way.
+type ignoreRules struct {
+	root     string
+	patterns []string
+
+	// extensions replaces the configured extensions when set
+	extensions map[string]bool
+	excluded   map[string]bool
+	maxDepth   int
+
+	// parents are the directories above root whose ignore files also apply,
+	// outermost first. They are set when root is inside a git repository.
+	parents []string
+
+	mu    sync.Mutex
+	files map[string]*ignoreFile
+}
+
+func newIgnoreRules(root string, opts Options) *ignoreRules {
+	expandedIgnorePatterns := make([]string, 0, len(opts.IgnorePatterns))
+	for _, pattern := range opts.IgnorePatterns {
+		if strings.HasPrefix(pattern, "~/") {
+			home, err := os.UserHomeDir()
+			if err == nil {
+				pattern = filepath.Join(home, pattern[2:])
+			}
+		}
+		pattern = filepath.Clean(pattern)
+		expandedIgnorePatterns = append(expandedIgnorePatterns, pattern)
+	}
+
+	var extensions map[string]bool
+	if opts.Extensions != nil {
+		extensions = extensionSet(opts.Extensions)
+	}
+
+	return &ignoreRules{
+		root:       root,
+		patterns:   expandedIgnorePatterns,
+		extensions: extensions,
+		excluded:   extensionSet(opts.ExcludeExtensions),
+		maxDepth:   opts.MaxDepth,
+		parents:    repositoryParents(root),
+		files:      make(map[string]*ignoreFile),
+	}
+}
+
+// extensionSet returns the extensions as lower case with a leading dot
+func extensionSet(extensions []string) map[string]bool {
+	set := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		set[NormalizeExtension(ext)] = true
+	}
+	return set
+}
+
+// NormalizeExtension returns ext in lower case with a leading dot, e.g. .md
+// for MD
+func NormalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// depth returns how many levels below the root path is; files directly in
+// the root are at depth 1
+func (r *ignoreRules) depth(path string) int {
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// allowedExtension reports whether files with ext are indexed
+func (r *ignoreRules) allowedExtension(ext string) bool {
+	if r.excluded[strings.ToLower(ext)] {
+		return false
+	}
+	if r.extensions != nil {
+		return r.extensions[strings.ToLower(ext)]
+	}
+	return config.IsAllowedExtension(ext)
+}
+
+// repositoryParents returns the directories from the enclosing git
+// repository's top level down to, but not including, root. It returns nil
+// when root is not inside a repository or is the top level itself.
+func repositoryParents(root string) []string {
+	var parents []string
+	for dir := filepath.Dir(root); ; dir = filepath.Dir(dir) {
+		parents = append([]string{dir}, parents...)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return parents
+		}
+		if dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+// ignoreFileFor returns the cached ignore file of dir, loading it on first use
+func (r *ignoreRules) ignoreFileFor(dir string) *ignoreFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.files[dir]
+	if !ok {
+		f = loadIgnoreFile(dir)
+		r.files[dir] = f
+	}
+	return f
+}
+
+// invalidate drops the cached ignore file of dir so it is re-read on next use
+func (r *ignoreRules) invalidate(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.files, dir)
+}
+
+// matchesIgnoreFiles applies the ignore files of every directory from the
+// repository top level down to path's parent. Deeper files take precedence
+// over shallower ones, and later lines over earlier ones.
+func (r *ignoreRules) matchesIgnoreFiles(path string, isDir bool) bool {
+	dirs := append([]string(nil), r.parents...)
+	if rel, err := filepath.Rel(r.root, filepath.Dir(path)); err == nil && !strings.HasPrefix(rel, "..") {
+		dir := r.root
+		dirs = append(dirs, dir)
+		if rel != "." {
+			for _, part := range strings.Split(rel, string(filepath.Separator)) {
+				dir = filepath.Join(dir, part)
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	ignored := false
+	for _, dir := range dirs {
+		f := r.ignoreFileFor(dir)
+		if f == nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			continue
+		}
+		if decided, ign := f.match(filepath.ToSlash(rel), isDir); decided {
+			ignored = ign
+		}
+	}
+	return ignored
+}
+
+// matchesPattern reports whether path matches any of the user's patterns.
+// Absolute patterns exclude a whole subtree, others are globs matched
+// against the base name.
+func (r *ignoreRules) matchesPattern(path string, info os.FileInfo) bool {
+	for _, pattern := range r.patterns {
+		if filepath.IsAbs(pattern) {
+			if path == pattern || strings.HasPrefix(path, pattern+string(filepath.Separator)) {
+				return true
+			}
+		} else {
+			matched, err := filepath.Match(pattern, info.Name())
+			if err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipDir reports whether a directory and everything below it should be skipped
+func (r *ignoreRules) skipDir(path string, info os.FileInfo) bool {
+	if r.matchesPattern(path, info) {
+		return true
+	}
+
+	// The files of a directory are one level deeper than it
+	if r.maxDepth > 0 && r.depth(path) >= r.maxDepth {
+		return true
+	}
+
+	if config.ShouldIgnoreDirectory(info.Name()) {
+		return true
+	}
+
+	if strings.HasPrefix(info.Name(), ".") {
+		return true
+	}
+
+	return r.matchesIgnoreFiles(path, true)
+}
+
+// skipFile reports whether a regular file should be left out of the index
+func (r *ignoreRules) skipFile(path string, info os.FileInfo) bool {
+	if r.matchesPattern(path, info) {
+		return true
+	}
+
+	if r.maxDepth > 0 && r.depth(path) > r.maxDepth {
+		return true
+	}
+
+	if !r.allowedExtension(filepath.Ext(path)) {
+		return true
+	}
+
+	return r.matchesIgnoreFiles(path, false)
+}
@@ -1,13 +1,14 @@
 package indexer
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
-	"github.com/sahil485/memex/pkg/client"
+	"github.com/sahil485/memex/pkg/backend"
 	"github.com/sahil485/memex/pkg/config"
 	"github.com/sahil485/memex/pkg/types"
 )
@@ -17,52 +18,24 @@ func IndexFile(filePath string) error {
 		return fmt.Errorf("file extension not allowed: %s", filepath.Ext(filePath))
 	}
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	fileInfo, err := file.Stat()
+	doc, err := createDocumentForFile(filePath)
 	if err != nil {
 		return err
 	}
-
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return err
+	if doc.ContentError != "" {
+		fmt.Printf("Indexing %s without content: %s\n", filePath, doc.ContentError)
 	}
 
-	doc := types.NewDocument(
-		filePath,
-		fileInfo.Name(),
-		filepath.Dir(filePath),
-		filepath.Ext(filePath),
-		fileInfo.Size(),
-		fileInfo.ModTime().Unix(),
-		string(content),
-	)
-
-	c := client.New()
+	b := backend.New()
+	existing, _ := lookupIndexedFile(b, filePath)
 
-	// Add document to Meilisearch index
-	idx := c.GetIndex()
-	task, err := idx.AddDocuments([]types.Document{*doc}, nil)
-	if err != nil {
+	// Add the document, and its passages if the file is large
+	parent, passages := splitPassages(doc)
+	if err := b.AddDocuments(append([]types.Document{parent}, passages...)); err != nil {
 		return fmt.Errorf("failed to index document: %w", err)
 	}
 
-	taskInfo, err := c.WaitForTask(task.TaskUID)
-	if err != nil {
-		return fmt.Errorf("failed to wait for indexing task: %w", err)
-	}
-
-	// Check if the task failed
-	if taskInfo.Status == "failed" {
-		return fmt.Errorf("indexing task failed: %s", taskInfo.Error.Message)
-	}
-
-	return nil
+	return deleteDocuments(b, existing.passageIDsFrom(len(passages)))
 }
 
 func createDocumentForFile(filePath string) (*types.Document, error) {
@@ -78,16 +51,16 @@ func createDocumentForFile(filePath string) (*types.Document, error) {
 	}
 
 	ext := filepath.Ext(filePath)
-	var content string
-
-	if config.ShouldIgnoreContent(ext) {
-		content = ""
-	} else {
-		contentBytes, err := io.ReadAll(file)
-		if err != nil {
-			return nil, err
+	extraction := &Extraction{}
+	var extractErr error
+
+	// Content is left out for extensions configured as metadata only
+	if !config.ShouldIgnoreContent(ext) {
+		extraction, extractErr = extract(filePath, file, fileInfo)
+		if extractErr != nil {
+			// Keep the file findable by name even if its content is unreadable
+			extraction = &Extraction{}
 		}
-		content = string(contentBytes)
 	}
 
 	doc := types.NewDocument(
@@ -97,106 +70,210 @@ func createDocumentForFile(filePath string) (*types.Document, error) {
 		ext,
 		fileInfo.Size(),
 		fileInfo.ModTime().Unix(),
-		content,
+		extraction.Text,
 	)
+	doc.Title = extraction.Title
+	doc.Metadata = extraction.Metadata
+	doc.PageOffsets = extraction.Pages
+	if extractErr != nil {
+		doc.ContentError = extractErr.Error()
+	}
 
 	return doc, nil
 }
 
-func IndexDirectory(directory string, ignorePatterns []string) error {
-	ms_client := client.New()
-	documents := make([]types.Document, 0)
-	fileCount := 0
-
-	expandedIgnorePatterns := make([]string, 0, len(ignorePatterns))
-	for _, pattern := range ignorePatterns {
-		if strings.HasPrefix(pattern, "~/") {
-			home, err := os.UserHomeDir()
-			if err == nil {
-				pattern = filepath.Join(home, pattern[2:])
-			}
-		}
-		pattern = filepath.Clean(pattern)
-		expandedIgnorePatterns = append(expandedIgnorePatterns, pattern)
+// IndexStats summarises the outcome of a directory index run
+type IndexStats struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Removed   int `json:"removed"`
+
+	// Errors lists the files that were skipped because they could not be read
+	Errors []FileError `json:"errors"`
+}
+
+// IndexDirectory indexes the files below directory, reporting each step to
+// opts.Progress. Cancelling ctx stops the walk, waits for the uploads already
+// started and returns ctx.Err(); deleted files are then left in the index
+// until the next complete run.
+func IndexDirectory(ctx context.Context, directory string, opts Options) (*IndexStats, error) {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, err
 	}
 
-	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Printf("Skipping %s: %v\n", path, err)
-			return nil
+	p := newProgress(opts.Progress, directory)
+	stats, err := indexDirectory(ctx, directory, opts, p)
+	p.done(stats, err)
+	return stats, err
+}
+
+func indexDirectory(ctx context.Context, directory string, opts Options, p *progress) (*IndexStats, error) {
+	started := time.Now()
+	b := opts.searchBackend()
+	documents := newDocumentBatcher(b, opts)
+	metadata := newMetadataBatcher(b, opts)
+	stats := &IndexStats{}
+	seen := make(map[string]bool)
+	unchanged := 0
+	var (
+		walkErrors []FileError
+		staleIDs   []string
+	)
+
+	uploaded := func(n int) {
+		p.report(Progress{Kind: ProgressUploaded, Documents: n})
+	}
+	documents.uploaded = uploaded
+	metadata.uploaded = uploaded
+
+	if err := ensureSettings(b); err != nil {
+		return nil, fmt.Errorf("failed to apply index settings: %w", err)
+	}
+	indexed, err := loadIndexedFiles(b, directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load indexed files: %w", err)
+	}
+
+	rules := newIgnoreRules(directory, opts)
+
+	// Reading happens on the pool; results are handled here in walk order
+	pool := newReadPool(opts.Workers, func(r fileResult) {
+		// Files still queued when the run is cancelled are dropped
+		if ctx.Err() != nil {
+			return
 		}
 
-		// Check if path matches any ignore patterns
-		for _, pattern := range expandedIgnorePatterns {
-			if filepath.IsAbs(pattern) {
-				if strings.HasPrefix(path, pattern) {
-					if info.IsDir() && path == pattern {
-						return filepath.SkipDir
-					}
-					if strings.HasPrefix(path, pattern+string(filepath.Separator)) {
-						if info.IsDir() {
-							return filepath.SkipDir
-						}
-						return nil
-					}
-				}
-			} else {
-				// Pattern is a glob pattern, match against filename
-				matched, err := filepath.Match(pattern, info.Name())
-				if err == nil && matched {
-					if info.IsDir() {
-						return filepath.SkipDir
-					}
-					return nil
-				}
+		if r.err != nil {
+			opts.logf("Skipping %s: %v\n", r.path, r.err)
+			stats.Errors = append(stats.Errors, FileError{Path: r.path, Err: r.err})
+			p.skipped(r.path, SkipUnreadable, r.err)
+			return
+		}
+
+		// Touched but not modified: refresh the stat fields only
+		if r.found && r.existing.ContentHash == r.doc.ContentHash {
+			stats.Unchanged++
+			for _, id := range r.existing.documentIDs() {
+				metadata.add(newMetadataUpdate(id, r.path, r.info))
 			}
+			p.skipped(r.path, SkipUnchanged, nil)
+			return
+		}
+
+		if r.found {
+			stats.Updated++
+		} else {
+			stats.Added++
+		}
+		opts.logf("[%d] %s\n", stats.Added+stats.Updated, r.path)
+		if r.doc.ContentError != "" {
+			opts.logf("Indexing %s without content: %s\n", r.path, r.doc.ContentError)
 		}
+		p.report(Progress{Kind: ProgressExtracted, Path: r.path, Error: r.doc.ContentError})
+		staleIDs = append(staleIDs, addDocument(documents, r.doc, r.existing)...)
+	})
 
-		if info.IsDir() && config.ShouldIgnoreDirectory(info.Name()) {
-			return filepath.SkipDir
+	walkErr := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
 		}
 
-		if info.IsDir() && strings.HasPrefix(info.Name(), ".") {
-			return filepath.SkipDir
+		if err != nil {
+			opts.logf("Skipping %s: %v\n", path, err)
+			walkErrors = append(walkErrors, FileError{Path: path, Err: err})
+			p.report(Progress{Kind: ProgressDiscovered, Path: path})
+			p.skipped(path, SkipUnreadable, err)
+			return nil
 		}
 
-		if !config.IsAllowedExtension(filepath.Ext(path)) {
+		// The root itself is always walked, even if its name would be ignored
+		if path == directory && info.IsDir() {
 			return nil
 		}
 
-		if !info.IsDir() {
-			fileCount++
-			fmt.Printf("[%d] %s\n", fileCount, path)
-			doc, err := createDocumentForFile(path)
-			if err != nil {
-				fmt.Printf("Skipping %s: %v\n", path, err)
-				return nil
+		if info.IsDir() {
+			if rules.skipDir(path, info) {
+				return filepath.SkipDir
 			}
+			return nil
+		}
 
-			documents = append(documents, *doc)
+		if rules.skipFile(path, info) {
+			p.skipped(path, SkipIgnored, nil)
+			return nil
 		}
+
+		existing, found := indexed[path]
+		seen[path] = true
+		p.report(Progress{Kind: ProgressDiscovered, Path: path})
+
+		// Same size and mtime as the stored document: skip without reading
+		if found && existing.unchanged(info) {
+			unchanged++
+			p.skipped(path, SkipUnchanged, nil)
+			return nil
+		}
+
+		pool.submit(fileJob{path: path, info: info, existing: existing, found: found})
 		return nil
 	})
+	p.walkDone()
 
-	if err != nil {
-		return err
+	// Always drain the pool and uploaders so nothing outlives this call
+	pool.wait()
+	if err := ctx.Err(); err != nil {
+		documents.abort()
+		metadata.abort()
+		return nil, err
 	}
 
-	fmt.Printf("\nIndexing %d files to Meilisearch...\n", len(documents))
+	stats.Unchanged += unchanged
+	stats.Errors = append(stats.Errors, walkErrors...)
 
-	task, err := ms_client.GetIndex().AddDocuments(documents, nil)
-	if err != nil {
-		return fmt.Errorf("failed to add documents to index: %w", err)
+	if stats.Added+stats.Updated > 0 {
+		opts.logf("\nWaiting for %d files to finish indexing...\n", stats.Added+stats.Updated)
 	}
+	uploadErr := errors.Join(documents.wait(), metadata.wait())
 
-	taskInfo, err := ms_client.WaitForTask(task.TaskUID)
-	if err != nil {
-		return fmt.Errorf("failed to wait for indexing task: %w", err)
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	if uploadErr != nil {
+		return nil, uploadErr
 	}
 
-	if taskInfo.Status == "failed" {
-		return fmt.Errorf("indexing task failed: %s", taskInfo.Error.Message)
+	// Leave deleted files and the run record for a run that completes
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stale := staleFiles(indexed, seen, walkErrors, opts.Keep)
+	if len(stale) > 0 {
+		opts.logf("Removing %d deleted or excluded files from the index...\n", len(stale))
+		stats.Removed = len(stale)
+	}
+	for _, f := range stale {
+		staleIDs = append(staleIDs, f.documentIDs()...)
+	}
+	if err := deleteDocuments(b, staleIDs); err != nil {
+		return nil, err
+	}
+
+	err = recordRun(Run{
+		Root:       directory,
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+		Added:      stats.Added,
+		Updated:    stats.Updated,
+		Unchanged:  stats.Unchanged,
+		Removed:    stats.Removed,
+		Errors:     len(stats.Errors),
+	})
+	if err != nil {
+		opts.logf("Could not record the index run: %v\n", err)
 	}
 
-	return nil
+	return stats, nil
 }
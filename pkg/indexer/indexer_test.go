@@ -0,0 +1,431 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sahil485/memex/internal/meilitest"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// writeFiles creates files below root from relative paths to contents
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestIndex starts a fake Meilisearch with an empty index and returns
+// options that index into it. The run record goes to a temporary home
+// directory.
+func newTestIndex(t *testing.T) (*meilitest.Server, Options) {
+	t.Setenv("HOME", t.TempDir())
+	server := meilitest.NewServer(t)
+	if err := server.Client().Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Log = nil
+	opts.Backend = server.Client()
+	return server, opts
+}
+
+// storedFiles returns the stored file documents by path relative to root,
+// leaving out passages
+func storedFiles(t *testing.T, server *meilitest.Server, root string) map[string]types.Document {
+	t.Helper()
+	files := make(map[string]types.Document)
+	for _, hit := range server.Documents() {
+		var doc types.Document
+		if err := hit.DecodeInto(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc.ParentID != "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, doc.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[filepath.ToSlash(rel)] = doc
+	}
+	return files
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestIndexDirectory(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+
+		// ignore lists --ignore patterns; a leading / is relative to the root
+		ignore []string
+
+		// rules sets the extension and depth options
+		rules Options
+		want  []string
+	}{
+		{
+			name: "allowed extensions",
+			files: map[string]string{
+				"a.txt":        "alpha",
+				"notes/b.md":   "bravo",
+				"src/main.go":  "package main",
+				"photo.xyzzy":  "binary",
+				"noextension":  "plain",
+				"deep/er/c.md": "charlie",
+			},
+			want: []string{"a.txt", "deep/er/c.md", "notes/b.md", "src/main.go"},
+		},
+		{
+			name: "ignored and hidden directories",
+			files: map[string]string{
+				"node_modules/pkg/index.js": "module.exports = {}",
+				".cache/a.txt":              "hidden",
+				"keep/a.txt":                "kept",
+			},
+			want: []string{"keep/a.txt"},
+		},
+		{
+			name: "gitignore",
+			files: map[string]string{
+				".gitignore":     "drafts/\n*.tmp.md\n",
+				"drafts/a.md":    "draft",
+				"notes.md":       "notes",
+				"scratch.tmp.md": "scratch",
+				"sub/.gitignore": "secret.md\n",
+				"sub/secret.md":  "secret",
+				"sub/public.md":  "public",
+				"secret.md":      "not under sub",
+			},
+			want: []string{"notes.md", "secret.md", "sub/public.md"},
+		},
+		{
+			name: "memexignore re-includes",
+			files: map[string]string{
+				".gitignore":     "*.md\n",
+				".memexignore":   "!README.md\nfixtures/\n",
+				"README.md":      "readme",
+				"other.md":       "other",
+				"a.txt":          "alpha",
+				"fixtures/b.txt": "fixture",
+			},
+			want: []string{"README.md", "a.txt"},
+		},
+		{
+			name: "ignore patterns",
+			files: map[string]string{
+				"a.txt":         "alpha",
+				"b.secret.txt":  "secret",
+				"private/c.txt": "private",
+				"public/d.txt":  "public",
+			},
+			ignore: []string{"*.secret.txt", "/private"},
+			want:   []string{"a.txt", "public/d.txt"},
+		},
+		{
+			name: "extensions replace the configured ones",
+			files: map[string]string{
+				"a.md":       "alpha",
+				"b.txt":      "bravo",
+				"c.org":      "charlie",
+				"sub/d.ORG":  "delta",
+				"sub/e.json": "echo",
+			},
+			rules: Options{Extensions: []string{"ORG", ".md"}},
+			want:  []string{"a.md", "c.org", "sub/d.ORG"},
+		},
+		{
+			name: "excluded extensions",
+			files: map[string]string{
+				"a.md":   "alpha",
+				"b.json": "bravo",
+				"c.txt":  "charlie",
+			},
+			rules: Options{ExcludeExtensions: []string{"json", "txt"}},
+			want:  []string{"a.md"},
+		},
+		{
+			name: "max depth",
+			files: map[string]string{
+				"a.txt":         "alpha",
+				"one/b.txt":     "bravo",
+				"one/two/c.txt": "charlie",
+			},
+			rules: Options{MaxDepth: 2},
+			want:  []string{"a.txt", "one/b.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, opts := newTestIndex(t)
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+			for _, pattern := range tt.ignore {
+				if strings.HasPrefix(pattern, "/") {
+					pattern = filepath.Join(root, pattern)
+				}
+				opts.IgnorePatterns = append(opts.IgnorePatterns, pattern)
+			}
+			opts.Extensions = tt.rules.Extensions
+			opts.ExcludeExtensions = tt.rules.ExcludeExtensions
+			opts.MaxDepth = tt.rules.MaxDepth
+
+			stats, err := IndexDirectory(context.Background(), root, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortedKeys(storedFiles(t, server, root)); !slices.Equal(got, tt.want) {
+				t.Errorf("indexed %v, want %v", got, tt.want)
+			}
+			if stats.Added != len(tt.want) || stats.Updated != 0 || stats.Removed != 0 {
+				t.Errorf("stats = %+v, want %d added", stats, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestIndexDirectoryReindex(t *testing.T) {
+	server, opts := newTestIndex(t)
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"touched.txt":  "alpha",
+		"modified.txt": "bravo",
+		"deleted.txt":  "charlie",
+		"same.txt":     "delta",
+	})
+	if _, err := IndexDirectory(context.Background(), root, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	writeFiles(t, root, map[string]string{
+		"modified.txt": "bravo two",
+		"added.txt":    "echo",
+	})
+	for _, name := range []string{"touched.txt", "modified.txt"} {
+		if err := os.Chtimes(filepath.Join(root, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(filepath.Join(root, "deleted.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := IndexDirectory(context.Background(), root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := IndexStats{Added: 1, Updated: 1, Unchanged: 2, Removed: 1}
+	if stats.Added != want.Added || stats.Updated != want.Updated ||
+		stats.Unchanged != want.Unchanged || stats.Removed != want.Removed {
+		t.Errorf("stats = %+v, want %+v", *stats, want)
+	}
+
+	files := storedFiles(t, server, root)
+	if got, want := sortedKeys(files), []string{"added.txt", "modified.txt", "same.txt", "touched.txt"}; !slices.Equal(got, want) {
+		t.Errorf("indexed %v, want %v", got, want)
+	}
+	if got := files["modified.txt"].Content; got != "bravo two" {
+		t.Errorf("modified.txt content = %q, want the new content", got)
+	}
+	if got := files["touched.txt"].ModTime; got != later.Unix() {
+		t.Errorf("touched.txt mod_time = %d, want %d", got, later.Unix())
+	}
+
+	// Only the documents under the root, or without dirs, are fetched to
+	// compare against
+	filters := server.DocumentFilters()
+	wantFilter := fmt.Sprintf(`dirs = %q OR path = %q OR NOT dirs EXISTS`, root, root)
+	if len(filters) == 0 || slices.ContainsFunc(filters, func(f string) bool { return f != wantFilter }) {
+		t.Errorf("fetched documents with filters %q, want %q", filters, wantFilter)
+	}
+}
+
+// An index written before dirs was added gets the current settings, and its
+// documents without dirs are compared against like any other
+func TestIndexDirectoryLegacyIndex(t *testing.T) {
+	server, opts := newTestIndex(t)
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"kept.txt": "alpha"})
+
+	c := server.Client()
+	legacy := []any{"ext", "path", "dir", "mod_time", "size", "tags"}
+	if _, err := c.GetIndex().UpdateFilterableAttributes(&legacy); err != nil {
+		t.Fatal(err)
+	}
+	var docs []map[string]any
+	for _, name := range []string{"kept.txt", "gone.txt"} {
+		path := filepath.Join(root, name)
+		docs = append(docs, map[string]any{"id": types.DocumentID(path), "path": path, "name": name, "content": "old"})
+	}
+	if err := c.AddDocuments(docs); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := IndexDirectory(context.Background(), root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Updated != 1 || stats.Removed != 1 {
+		t.Errorf("stats = %+v, want kept.txt updated and gone.txt removed", *stats)
+	}
+	if problems, err := c.CheckSettings(); err != nil || len(problems) > 0 {
+		t.Errorf("settings after indexing: %v, %v", problems, err)
+	}
+
+	files := storedFiles(t, server, root)
+	if got := sortedKeys(files); !slices.Equal(got, []string{"kept.txt"}) {
+		t.Errorf("indexed %v, want [kept.txt]", got)
+	}
+	if got := files["kept.txt"].Dirs; !slices.Contains(got, root) {
+		t.Errorf("kept.txt dirs = %v, want them to hold %s", got, root)
+	}
+}
+
+func TestIndexDirectoryPassages(t *testing.T) {
+	server, opts := newTestIndex(t)
+	root := t.TempDir()
+
+	var large strings.Builder
+	for large.Len() <= passageThreshold {
+		large.WriteString("a line of a large file that is split into passages\n")
+	}
+	writeFiles(t, root, map[string]string{"large.txt": large.String()})
+	if _, err := IndexDirectory(context.Background(), root, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	passages := func() int {
+		n := 0
+		for _, hit := range server.Documents() {
+			if _, ok := hit["parent_id"]; ok {
+				n++
+			}
+		}
+		return n
+	}
+	file := storedFiles(t, server, root)["large.txt"]
+	if file.Content != "" || file.Passages == 0 || passages() != file.Passages {
+		t.Fatalf("large.txt has content %d bytes and %d of %d passages stored",
+			len(file.Content), passages(), file.Passages)
+	}
+
+	// Shrinking the file below the threshold drops its passages
+	writeFiles(t, root, map[string]string{"large.txt": "now small"})
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "large.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IndexDirectory(context.Background(), root, opts); err != nil {
+		t.Fatal(err)
+	}
+	if n := passages(); n != 0 {
+		t.Errorf("%d passages left after the file shrank", n)
+	}
+	if got := storedFiles(t, server, root)["large.txt"].Content; got != "now small" {
+		t.Errorf("large.txt content = %q", got)
+	}
+}
+
+func TestIndexDirectoryProgress(t *testing.T) {
+	_, opts := newTestIndex(t)
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.txt":       "alpha",
+		"b.md":        "bravo",
+		"photo.xyzzy": "binary",
+	})
+
+	var events []Progress
+	opts.Progress = func(e Progress) { events = append(events, e) }
+	if _, err := IndexDirectory(context.Background(), root, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := make(map[ProgressKind]int)
+	for _, e := range events {
+		kinds[e.Kind]++
+	}
+	if kinds[ProgressDiscovered] != 2 || kinds[ProgressExtracted] != 2 || kinds[ProgressSkipped] != 1 {
+		t.Errorf("events = %v, want 2 discovered, 2 extracted and 1 skipped", kinds)
+	}
+
+	last := events[len(events)-1]
+	if last.Kind != ProgressDone || last.Stats == nil || last.Error != "" {
+		t.Fatalf("last event = %+v, want done with stats", last)
+	}
+	if last.Discovered != 2 || last.Processed != 2 || last.Uploaded != 2 || !last.Walked {
+		t.Errorf("final totals = %+v, want 2 discovered, processed and uploaded", last)
+	}
+
+	// A second run reads nothing and uploads nothing
+	events = nil
+	if _, err := IndexDirectory(context.Background(), root, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		if e.Kind == ProgressSkipped && e.Reason == SkipUnchanged {
+			continue
+		}
+		if e.Kind == ProgressExtracted || e.Kind == ProgressUploaded {
+			t.Errorf("unchanged run reported %s %s", e.Kind, e.Path)
+		}
+	}
+}
+
+func TestIndexDirectoryCancel(t *testing.T) {
+	server, opts := newTestIndex(t)
+	root := t.TempDir()
+	files := make(map[string]string)
+	for i := range 50 {
+		files[fmt.Sprintf("f%02d.txt", i)] = "content"
+	}
+	writeFiles(t, root, files)
+
+	// Cancel once the first file is found
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var last Progress
+	opts.Progress = func(e Progress) {
+		if e.Kind == ProgressDiscovered {
+			cancel()
+		}
+		last = e
+	}
+
+	stats, err := IndexDirectory(ctx, root, opts)
+	if !errors.Is(err, context.Canceled) || stats != nil {
+		t.Fatalf("IndexDirectory = %v, %v, want context.Canceled", stats, err)
+	}
+	if last.Kind != ProgressDone || last.Error == "" || last.Discovered != 1 {
+		t.Errorf("last event = %+v, want done with an error after 1 file", last)
+	}
+	if n := len(server.Documents()); n > 1 {
+		t.Errorf("%d documents stored after cancelling at the first file", n)
+	}
+}
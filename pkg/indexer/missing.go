@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// MissingFiles returns the indexed files that no longer exist on disk.
+// Files that cannot be checked, e.g. on an unmounted drive, are not counted.
+func MissingFiles() ([]string, error) {
+	var missing []string
+	err := backend.New().EachDocument("", indexedFileFields, func(hit types.Hit) error {
+		var f indexedFile
+		if err := hit.DecodeInto(&f); err != nil {
+			return err
+		}
+		if f.ParentID != "" {
+			return nil
+		}
+		if _, err := os.Stat(f.Path); errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, f.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// RemoveFiles deletes the documents of the given indexed files and their
+// passages
+func RemoveFiles(paths []string) error {
+	b := backend.New()
+
+	var ids []string
+	for _, path := range paths {
+		if f, ok := lookupIndexedFile(b, path); ok {
+			ids = append(ids, f.documentIDs()...)
+		}
+	}
+	return deleteDocuments(b, ids)
+}
+
+// RemoveDirectory deletes the documents of every indexed file under
+// directory, except those under one of keep, returning the number of files
+// removed
+func RemoveDirectory(directory string, keep []string) (int, error) {
+	b := backend.New()
+	indexed, err := loadIndexedFiles(b, directory)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	removed := 0
+	for path, f := range indexed {
+		if underAnyDir(path, keep) {
+			continue
+		}
+		ids = append(ids, f.documentIDs()...)
+		removed++
+	}
+	if err := deleteDocuments(b, ids); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// underAnyDir reports whether path is one of dirs or below one of them
+func underAnyDir(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
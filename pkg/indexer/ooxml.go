@@ -0,0 +1,373 @@
+package indexer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ooxmlMaxPartSize caps the decompressed size of a single XML part
+	ooxmlMaxPartSize = 64 << 20
+
+	// ooxmlMaxTotalSize caps the decompressed bytes read from one file, so a
+	// zip bomb cannot exhaust memory
+	ooxmlMaxTotalSize = 256 << 20
+)
+
+var errOOXMLTooLarge = errors.New("decompressed content exceeds size limit")
+
+func init() {
+	e := ExtractorFunc(extractOOXML)
+	RegisterExtractor(e, []string{".docx", ".xlsx", ".pptx"}, []string{
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	})
+}
+
+// extractOOXML pulls the text out of Word, Excel and PowerPoint files. These
+// are zip archives of XML parts, so the file is reopened for random access.
+func extractOOXML(filePath string, _ io.Reader, _ os.FileInfo) (*Extraction, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	a := &ooxmlArchive{files: make(map[string]*zip.File), remaining: ooxmlMaxTotalSize}
+	for _, f := range zr.File {
+		a.files[f.Name] = f
+	}
+
+	var text strings.Builder
+	switch {
+	case a.has("word/document.xml"):
+		err = a.paragraphText(&text, "word/document.xml")
+	case a.has("xl/workbook.xml"):
+		err = a.sheetText(&text)
+	case a.has("ppt/presentation.xml"):
+		for i, part := range a.numbered("ppt/slides/slide") {
+			if i > 0 {
+				text.WriteString("\n")
+			}
+			fmt.Fprintf(&text, "Slide %d\n", i+1)
+			if err = a.paragraphText(&text, part); err != nil {
+				break
+			}
+		}
+	default:
+		err = errors.New("not a Word, Excel or PowerPoint document")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	extraction := &Extraction{Text: text.String()}
+	if a.has("docProps/core.xml") {
+		if err := a.coreProperties(extraction); err != nil {
+			return nil, err
+		}
+	}
+	return extraction, nil
+}
+
+// ooxmlArchive reads parts of an OOXML package within the size limits
+type ooxmlArchive struct {
+	files     map[string]*zip.File
+	remaining int64
+}
+
+func (a *ooxmlArchive) has(name string) bool {
+	_, ok := a.files[name]
+	return ok
+}
+
+// numbered returns the parts named prefix<N>.xml ordered by N, so that
+// slide10 comes after slide9
+func (a *ooxmlArchive) numbered(prefix string) []string {
+	type part struct {
+		name string
+		n    int
+	}
+	var parts []part
+	for name := range a.files {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(rest, ".xml"))
+		if err != nil || !strings.HasSuffix(rest, ".xml") {
+			continue
+		}
+		parts = append(parts, part{name, n})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].n < parts[j].n })
+
+	names := make([]string, len(parts))
+	for i, p := range parts {
+		names[i] = p.name
+	}
+	return names
+}
+
+// decoder opens a part for streaming XML decoding
+func (a *ooxmlArchive) decoder(name string) (*xml.Decoder, io.Closer, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("missing part %s", name)
+	}
+	if f.UncompressedSize64 > ooxmlMaxPartSize || int64(f.UncompressedSize64) > a.remaining {
+		return nil, nil, fmt.Errorf("%s: %w", name, errOOXMLTooLarge)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The sizes in the zip header are not trusted; count what is inflated
+	limit := min(int64(ooxmlMaxPartSize), a.remaining)
+	r := &limitedReader{r: rc, n: limit, budget: &a.remaining}
+	return xml.NewDecoder(r), rc, nil
+}
+
+// limitedReader fails once more than n bytes are read, charging everything
+// it reads to a shared budget
+type limitedReader struct {
+	r      io.Reader
+	n      int64
+	budget *int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errOOXMLTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	*l.budget -= int64(n)
+	return n, err
+}
+
+// paragraphText appends the text runs of a Word body or PowerPoint slide,
+// one paragraph per line
+func (a *ooxmlArchive) paragraphText(text *strings.Builder, name string) error {
+	d, closer, err := a.decoder(name)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	inText := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+}
+
+// sheetText appends every worksheet's cell values, one row per line with
+// cells separated by tabs
+func (a *ooxmlArchive) sheetText(text *strings.Builder) error {
+	var shared []string
+	if a.has("xl/sharedStrings.xml") {
+		var err error
+		if shared, err = a.sharedStrings(); err != nil {
+			return err
+		}
+	}
+
+	for i, part := range a.numbered("xl/worksheets/sheet") {
+		if i > 0 {
+			text.WriteString("\n")
+		}
+		if err := a.worksheet(text, part, shared); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharedStrings reads the workbook's string table. Rich text entries are
+// joined from their runs; phonetic hints are left out.
+func (a *ooxmlArchive) sharedStrings() ([]string, error) {
+	d, closer, err := a.decoder("xl/sharedStrings.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var (
+		strs     []string
+		current  strings.Builder
+		inText   bool
+		phonetic int
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xl/sharedStrings.xml: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				phonetic++
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, current.String())
+			case "t":
+				inText = false
+			case "rPh":
+				phonetic--
+			}
+		case xml.CharData:
+			if inText && phonetic == 0 {
+				current.Write(t)
+			}
+		}
+	}
+}
+
+// worksheet appends the cell values of one sheet
+func (a *ooxmlArchive) worksheet(text *strings.Builder, name string, shared []string) error {
+	d, closer, err := a.decoder(name)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	var (
+		cellType string
+		value    strings.Builder
+		inValue  bool
+		cells    int
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				cells = 0
+			case "c":
+				cellType = ""
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "t" {
+						cellType = attr.Value
+					}
+				}
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				v := value.String()
+				if cellType == "s" {
+					n, err := strconv.Atoi(v)
+					if err != nil || n < 0 || n >= len(shared) {
+						continue
+					}
+					v = shared[n]
+				}
+				if v == "" {
+					continue
+				}
+				if cells > 0 {
+					text.WriteString("\t")
+				}
+				text.WriteString(v)
+				cells++
+			case "row":
+				if cells > 0 {
+					text.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	}
+}
+
+// coreProperties fills the title and author from docProps/core.xml
+func (a *ooxmlArchive) coreProperties(extraction *Extraction) error {
+	d, closer, err := a.decoder("docProps/core.xml")
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	var props struct {
+		Title   string `xml:"title"`
+		Creator string `xml:"creator"`
+	}
+	if err := d.Decode(&props); err != nil {
+		return fmt.Errorf("docProps/core.xml: %w", err)
+	}
+
+	extraction.Title = strings.TrimSpace(props.Title)
+	if author := strings.TrimSpace(props.Creator); author != "" {
+		extraction.Metadata = map[string]string{"author": author}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package indexer
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	wordNS  = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	drawNS  = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"`
+	sheetNS = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"`
+)
+
+// writeZip writes an archive of parts to a file, adding raw entries built
+// by extra, and returns its path
+func writeZip(t *testing.T, parts map[string]string, extra func(w *zip.Writer) error) string {
+	t.Helper()
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, content := range parts {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if extra != nil {
+		if err := extra(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "doc.zip")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rawPart adds a deflated part whose header claims size bytes, whatever
+// the data inflates to
+func rawPart(name string, data []byte, size uint64) func(w *zip.Writer) error {
+	return func(w *zip.Writer) error {
+		var compressed bytes.Buffer
+		fw, err := flate.NewWriter(&compressed, flate.BestSpeed)
+		if err != nil {
+			return err
+		}
+		fw.Write(data)
+		fw.Close()
+
+		f, err := w.CreateRaw(&zip.FileHeader{
+			Name:               name,
+			Method:             zip.Deflate,
+			CRC32:              crc32.ChecksumIEEE(data),
+			CompressedSize64:   uint64(compressed.Len()),
+			UncompressedSize64: size,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(compressed.Bytes())
+		return err
+	}
+}
+
+func TestExtractOOXML(t *testing.T) {
+	// A body that inflates past the part limit from a few kilobytes
+	bomb := []byte(`<w:document ` + wordNS + `><w:body><w:p><w:r><w:t>` +
+		strings.Repeat(" ", ooxmlMaxPartSize) + `</w:t></w:r></w:p></w:body></w:document>`)
+
+	tests := []struct {
+		name   string
+		parts  map[string]string
+		extra  func(w *zip.Writer) error
+		text   string
+		title  string
+		author string
+		err    error // the error wanted; fails accepts any
+		fails  bool
+	}{
+		{
+			name: "docx",
+			parts: map[string]string{
+				"word/document.xml": `<w:document ` + wordNS + `><w:body>
+					<w:p><w:r><w:t>Quarterly</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">report </w:t></w:r></w:p>
+					<w:p><w:r><w:t>line one</w:t><w:br/><w:t>line two</w:t></w:r></w:p>
+				</w:body></w:document>`,
+				"docProps/core.xml": `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">
+					<dc:title> Budget </dc:title><dc:creator>Ada</dc:creator>
+				</cp:coreProperties>`,
+			},
+			text:   "Quarterly\treport \nline one\nline two\n",
+			title:  "Budget",
+			author: "Ada",
+		},
+		{
+			name: "pptx slides in numeric order",
+			parts: map[string]string{
+				"ppt/presentation.xml":    `<p:presentation/>`,
+				"ppt/slides/slide1.xml":   `<p:sld ` + drawNS + `><a:p><a:r><a:t>Intro</a:t></a:r></a:p></p:sld>`,
+				"ppt/slides/slide2.xml":   `<p:sld ` + drawNS + `><a:p><a:r><a:t>Plan</a:t></a:r></a:p></p:sld>`,
+				"ppt/slides/slide10.xml":  `<p:sld ` + drawNS + `><a:p><a:r><a:t>End</a:t></a:r></a:p></p:sld>`,
+				"ppt/slides/_rels/x.xml":  `<Relationships/>`,
+				"ppt/slides/slide3.xml.1": `not a slide`,
+			},
+			text: "Slide 1\nIntro\n\nSlide 2\nPlan\n\nSlide 3\nEnd\n",
+		},
+		{
+			name: "xlsx with shared strings",
+			parts: map[string]string{
+				"xl/workbook.xml": `<workbook ` + sheetNS + `/>`,
+				"xl/sharedStrings.xml": `<sst ` + sheetNS + `>
+					<si><t>Name</t></si>
+					<si><r><t>Tot</t></r><r><t>al</t></r><rPh><t>phonetic</t></rPh></si>
+					<si><t>Widgets</t></si>
+				</sst>`,
+				"xl/worksheets/sheet1.xml": `<worksheet ` + sheetNS + `><sheetData>
+					<row><c t="s"><v>0</v></c><c t="s"><v>1</v></c></row>
+					<row><c t="s"><v>2</v></c><c><v>42</v></c><c t="s"><v>99</v></c></row>
+					<row><c/></row>
+				</sheetData></worksheet>`,
+				"xl/worksheets/sheet2.xml": `<worksheet ` + sheetNS + `><sheetData>
+					<row><c t="inlineStr"><is><t>inline</t></is></c></row>
+				</sheetData></worksheet>`,
+			},
+			text: "Name\tTotal\nWidgets\t42\n\ninline\n",
+		},
+		{
+			name:  "part over the size limit",
+			parts: map[string]string{"word/styles.xml": `<w:styles/>`},
+			extra: rawPart("word/document.xml", []byte(`<w:document/>`), ooxmlMaxPartSize+1),
+			err:   errOOXMLTooLarge,
+		},
+		{
+			// archive/zip stops at the declared size, before the limit does
+			name:  "zip bomb understating its size",
+			extra: rawPart("word/document.xml", bomb, 1024),
+			err:   zip.ErrFormat,
+		},
+		{
+			name:  "zip bomb",
+			extra: rawPart("word/document.xml", bomb, uint64(len(bomb))),
+			err:   errOOXMLTooLarge,
+		},
+		{
+			name:  "not an office document",
+			parts: map[string]string{"readme.txt": "hello"},
+			fails: true,
+		},
+		{
+			name:  "malformed XML",
+			parts: map[string]string{"word/document.xml": `<w:document><w:body><w:p>`},
+			fails: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeZip(t, tt.parts, tt.extra)
+			e, err := extractOOXML(path, nil, nil)
+			if tt.err != nil || tt.fails {
+				if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+					t.Fatalf("extracted %+v, %v, want error %v", e, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Text != tt.text {
+				t.Errorf("text = %q, want %q", e.Text, tt.text)
+			}
+			if e.Title != tt.title || e.Metadata["author"] != tt.author {
+				t.Errorf("title %q, author %q, want %q and %q", e.Title, e.Metadata["author"], tt.title, tt.author)
+			}
+		})
+	}
+}
+
+func TestExtractOOXMLCorrupt(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"not a zip": []byte("PK\x03\x04 this is not really an archive"),
+		"truncated": func() []byte {
+			data, err := os.ReadFile(writeZip(t, map[string]string{"word/document.xml": "<w:document/>"}, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data[:len(data)-10]
+		}(),
+	} {
+		path := filepath.Join(t.TempDir(), "corrupt.docx")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if e, err := extractOOXML(path, nil, nil); err == nil {
+			t.Errorf("%s: extracted %+v", name, e)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package indexer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/config"
+)
+
+// Options controls what IndexDirectory indexes and how it uploads documents
+type Options struct {
+	// IgnorePatterns are absolute paths or base-name globs to skip
+	IgnorePatterns []string
+
+	// Extensions, if set, are the only extensions indexed in place of the
+	// configured ones; ExcludeExtensions are left out either way
+	Extensions        []string
+	ExcludeExtensions []string
+
+	// MaxDepth limits how many directory levels are walked: 1 indexes the
+	// files directly in the root only. Zero walks the whole tree.
+	MaxDepth int
+
+	// Keep lists directories below the indexed one, such as other roots
+	// nested in it, whose indexed files stay in the index even when the
+	// walk does not visit them
+	Keep []string
+
+	// BatchSize is the maximum number of documents sent per request
+	BatchSize int
+
+	// BatchBytes is the approximate maximum payload size per request
+	BatchBytes int
+
+	// MaxInFlight is how many upload tasks may be pending at once
+	MaxInFlight int
+
+	// Workers is how many files are read and hashed concurrently
+	Workers int
+
+	// Log receives a line per indexed or skipped file; nil discards them
+	Log io.Writer
+
+	// Backend receives the documents; nil uses the configured backend
+	Backend backend.SearchBackend
+
+	// Progress, if set, receives an event for each file and upload. It is
+	// never called concurrently, but should return quickly.
+	Progress func(Progress)
+}
+
+// DefaultOptions returns the options from the current configuration
+func DefaultOptions() Options {
+	cfg := config.Current()
+
+	workers := cfg.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+
+	return Options{
+		BatchSize:   cfg.BatchSize,
+		BatchBytes:  cfg.BatchBytes,
+		MaxInFlight: cfg.MaxInFlight,
+		Workers:     workers,
+		Log:         os.Stdout,
+	}
+}
+
+// searchBackend returns the backend to index into
+func (o Options) searchBackend() backend.SearchBackend {
+	if o.Backend != nil {
+		return o.Backend
+	}
+	return backend.New()
+}
+
+func (o Options) logf(format string, args ...any) {
+	if o.Log != nil {
+		fmt.Fprintf(o.Log, format, args...)
+	}
+}
@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+const (
+	// passageThreshold is the content size above which a file is split into
+	// passages instead of being stored as a single document
+	passageThreshold = 64 << 10
+
+	// passageBytes and passageMaxLines bound the size of each passage
+	passageBytes    = 4 << 10
+	passageMaxLines = 80
+
+	// passageOverlap is how many lines consecutive passages share, so a
+	// phrase spanning a boundary is still found in one of them
+	passageOverlap = 3
+)
+
+// segment is a line, or a slice of a line too long to fit in one passage
+type segment struct {
+	start, end int // byte offsets in the content
+	line       int // 1-based
+}
+
+// splitPassages returns the document to store for a file and, when its
+// content is large, the passages to store alongside it. The file's own
+// document then keeps its metadata and content hash but no content.
+func splitPassages(doc *types.Document) (types.Document, []types.Document) {
+	if len(doc.Content) <= passageThreshold {
+		return *doc, nil
+	}
+
+	segments := splitSegments(doc.Content)
+
+	var passages []types.Document
+	for first := 0; first < len(segments); {
+		last, size := first, 0
+		for last < len(segments) {
+			n := segments[last].end - segments[last].start
+			if last > first && (size+n > passageBytes || segments[last].line-segments[first].line >= passageMaxLines) {
+				break
+			}
+			size += n
+			last++
+		}
+
+		start, end := segments[first].start, segments[last-1].end
+		passages = append(passages, newPassage(doc, len(passages), start, end,
+			segments[first].line, segments[last-1].line))
+
+		if last == len(segments) {
+			break
+		}
+		first = max(last-passageOverlap, first+1)
+	}
+
+	parent := *doc
+	parent.Content = ""
+	parent.PageOffsets = nil
+	parent.Passages = len(passages)
+	return parent, passages
+}
+
+func newPassage(doc *types.Document, n, start, end, startLine, endLine int) types.Document {
+	content := doc.Content[start:end]
+	hash := sha256.Sum256([]byte(content))
+
+	p := types.Document{
+		ID:          types.PassageID(doc.ID, n),
+		ParentID:    doc.ID,
+		StartLine:   startLine,
+		EndLine:     endLine,
+		Path:        doc.Path,
+		Name:        doc.Name,
+		Dir:         doc.Dir,
+		Dirs:        doc.Dirs,
+		Ext:         doc.Ext,
+		Size:        doc.Size,
+		ModTime:     doc.ModTime,
+		Title:       doc.Title,
+		Content:     content,
+		ContentHash: hex.EncodeToString(hash[:]),
+		IndexedAt:   doc.IndexedAt,
+	}
+
+	// Carry the page layout over, relative to the passage
+	for _, offset := range doc.PageOffsets {
+		switch {
+		case offset <= start:
+			p.PageBase++
+		case offset < end:
+			p.PageOffsets = append(p.PageOffsets, offset-start)
+		}
+	}
+	return p
+}
+
+// splitSegments splits content into lines, breaking lines longer than
+// passageBytes at rune boundaries
+func splitSegments(content string) []segment {
+	var segments []segment
+	line := 1
+	for offset := 0; offset < len(content); line++ {
+		end := len(content)
+		if i := strings.IndexByte(content[offset:], '\n'); i >= 0 {
+			end = offset + i + 1
+		}
+
+		for start := offset; start < end; {
+			stop := min(start+passageBytes, end)
+			for stop < end && !utf8.RuneStart(content[stop]) {
+				stop--
+			}
+			if stop <= start {
+				stop = end
+			}
+			segments = append(segments, segment{start: start, end: stop, line: line})
+			start = stop
+		}
+		offset = end
+	}
+	return segments
+}
+
+// addDocument queues a file's document and passages for upload. It returns
+// the IDs of passages left over from a longer, previously indexed version.
+func addDocument(documents *batcher[types.Document], doc *types.Document, existing indexedFile) []string {
+	parent, passages := splitPassages(doc)
+	documents.add(parent)
+	for _, p := range passages {
+		documents.add(p)
+	}
+	return existing.passageIDsFrom(len(passages))
+}
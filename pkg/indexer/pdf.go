@@ -0,0 +1,336 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pdfMaxFileSize is the largest PDF whose text is extracted; larger files
+// are indexed by name only
+const pdfMaxFileSize = 256 << 20
+
+// pdfWordGap is the TJ adjustment, in thousandths of an em, that is wide
+// enough to count as a space between words
+const pdfWordGap = 200
+
+func init() {
+	RegisterExtractor(ExtractorFunc(extractPDF), []string{".pdf"}, []string{"application/pdf"})
+}
+
+// extractPDF pulls the text of every page out of a PDF. Pages are separated
+// by form feeds and their offsets recorded, so hits can name their page.
+func extractPDF(_ string, r io.Reader, info os.FileInfo) (*Extraction, error) {
+	if info.Size() > pdfMaxFileSize {
+		return nil, fmt.Errorf("%w: file is larger than %d MB", errPDFTooLarge, pdfMaxFileSize>>20)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := openPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	return f.extract()
+}
+
+// extract pulls the text, pages and document information out of an opened
+// PDF. Running out of decoding budget fails the extraction, rather than
+// passing off part of the text as all of it.
+func (f *pdfFile) extract() (*Extraction, error) {
+	catalog := f.dict(f.trailer["Root"])
+	if catalog == nil {
+		return nil, fmt.Errorf("%w: missing document catalog", errPDFMalformed)
+	}
+
+	var (
+		text  strings.Builder
+		pages []int
+	)
+	f.walkPages(catalog["Pages"], nil, 0, func(page pdfDict, resources pdfDict) {
+		if len(pages) > 0 {
+			text.WriteString("\f")
+		}
+		pages = append(pages, text.Len())
+
+		w := &pdfTextWriter{text: &text, start: text.Len()}
+		for _, content := range f.pageContents(page) {
+			f.showContent(w, content, resources, 0)
+		}
+	})
+	if f.exhausted {
+		return nil, fmt.Errorf("%w: more than %d MB of streams", errPDFTooLarge, pdfMaxDecodedSize>>20)
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%w: no pages", errPDFMalformed)
+	}
+
+	extraction := &Extraction{
+		Text:     text.String(),
+		Pages:    pages,
+		Metadata: map[string]string{"pages": strconv.Itoa(len(pages))},
+	}
+	if docInfo := f.dict(f.trailer["Info"]); docInfo != nil {
+		if title, ok := f.resolve(docInfo["Title"]).(pdfString); ok {
+			extraction.Title = strings.TrimSpace(pdfTextString(title))
+		}
+		if author, ok := f.resolve(docInfo["Author"]).(pdfString); ok {
+			if a := strings.TrimSpace(pdfTextString(author)); a != "" {
+				extraction.Metadata["author"] = a
+			}
+		}
+	}
+	return extraction, nil
+}
+
+// walkPages visits the leaves of the page tree in order, passing each page
+// the resources it inherits
+func (f *pdfFile) walkPages(node any, inherited pdfDict, depth int, visit func(page, resources pdfDict)) {
+	d := f.dict(node)
+	if d == nil || depth > pdfMaxDepth {
+		return
+	}
+
+	resources := inherited
+	if r := f.dict(d["Resources"]); r != nil {
+		resources = r
+	}
+
+	kids, ok := f.resolve(d["Kids"]).(pdfArray)
+	if typ, _ := f.resolve(d["Type"]).(pdfName); typ == "Page" || !ok {
+		visit(d, resources)
+		return
+	}
+	for _, kid := range kids {
+		f.walkPages(kid, resources, depth+1, visit)
+	}
+}
+
+// pageContents returns the decoded content streams of a page
+func (f *pdfFile) pageContents(page pdfDict) [][]byte {
+	var streams []any
+	switch c := f.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		streams = []any{c}
+	case pdfArray:
+		streams = c
+	}
+
+	var contents [][]byte
+	for _, s := range streams {
+		stream, ok := f.resolve(s).(*pdfStream)
+		if !ok {
+			continue
+		}
+		if data, err := f.decode(stream); err == nil {
+			contents = append(contents, data)
+		}
+	}
+	return contents
+}
+
+// pdfTextWriter lays out shown text, turning line changes into newlines and
+// wide gaps into spaces. Breaks are held back until more text follows, so
+// lines and pages never end in whitespace.
+type pdfTextWriter struct {
+	text  *strings.Builder
+	start int
+	brk   string
+
+	font  *pdfFont
+	y     float64
+	haveY bool
+}
+
+func (w *pdfTextWriter) write(s string) {
+	if s == "" {
+		return
+	}
+	if w.text.Len() > w.start {
+		w.text.WriteString(w.brk)
+	}
+	w.brk = ""
+	w.text.WriteString(s)
+}
+
+func (w *pdfTextWriter) newline() {
+	w.brk = "\n"
+}
+
+func (w *pdfTextWriter) space() {
+	if w.brk == "" {
+		w.brk = " "
+	}
+}
+
+// moveTo records the baseline of the next text, starting a new line when it
+// differs from the current one
+func (w *pdfTextWriter) moveTo(y float64) {
+	if w.haveY && math.Abs(y-w.y) > 0.5 {
+		w.newline()
+	} else {
+		w.space()
+	}
+	w.y, w.haveY = y, true
+}
+
+func (w *pdfTextWriter) show(s pdfString) {
+	if w.font == nil {
+		w.write(pdfTextString(s))
+		return
+	}
+	w.write(w.font.decode(s))
+}
+
+// showContent interprets a content stream, writing the text it shows. Form
+// XObjects are followed so text placed inside them is found too.
+func (f *pdfFile) showContent(w *pdfTextWriter, content []byte, resources pdfDict, depth int) {
+	if depth > pdfMaxDepth {
+		return
+	}
+
+	fonts := make(map[pdfName]*pdfFont)
+	fontResources := f.dict(resources["Font"])
+	xobjects := f.dict(resources["XObject"])
+
+	l := &pdfLexer{data: content}
+	var operands []any
+	for {
+		obj, err := l.object()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "BI":
+			// Inline image data is binary; skip to the end marker
+			end := bytes.Index(content[l.pos:], []byte("EI"))
+			for end >= 0 {
+				after := l.pos + end + 2
+				if content[l.pos+end-1] <= ' ' && (after >= len(content) || isPDFSpace(content[after])) {
+					break
+				}
+				next := bytes.Index(content[l.pos+end+2:], []byte("EI"))
+				if next < 0 {
+					end = -1
+					break
+				}
+				end += 2 + next
+			}
+			if end < 0 {
+				return
+			}
+			l.pos += end + 2
+
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font, ok := fonts[name]
+					if !ok {
+						if d := f.dict(fontResources[name]); d != nil {
+							font = f.loadFont(d)
+						}
+						fonts[name] = font
+					}
+					w.font = font
+				}
+			}
+
+		case "Tj":
+			if s, ok := lastOperand[pdfString](operands); ok {
+				w.show(s)
+			}
+
+		case "'", "\"":
+			w.newline()
+			if s, ok := lastOperand[pdfString](operands); ok {
+				w.show(s)
+			}
+
+		case "TJ":
+			if items, ok := lastOperand[pdfArray](operands); ok {
+				for _, item := range items {
+					switch v := item.(type) {
+					case pdfString:
+						w.show(v)
+					case int64, float64:
+						if pdfNumber(v) < -pdfWordGap {
+							w.space()
+						}
+					}
+				}
+			}
+
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				w.moveTo(w.y + pdfNumber(operands[len(operands)-1]))
+			}
+
+		case "Tm":
+			if len(operands) >= 6 {
+				w.moveTo(pdfNumber(operands[len(operands)-1]))
+			}
+
+		case "T*":
+			w.newline()
+
+		case "ET":
+			w.space()
+
+		case "Do":
+			name, ok := lastOperand[pdfName](operands)
+			if !ok {
+				break
+			}
+			form, ok := f.resolve(xobjects[name]).(*pdfStream)
+			if !ok {
+				break
+			}
+			if subtype, _ := f.resolve(form.dict["Subtype"]).(pdfName); subtype != "Form" {
+				break
+			}
+			data, err := f.decode(form)
+			if err != nil {
+				break
+			}
+			formResources := resources
+			if r := f.dict(form.dict["Resources"]); r != nil {
+				formResources = r
+			}
+			saved := w.font
+			f.showContent(w, data, formResources, depth+1)
+			w.font = saved
+		}
+		operands = operands[:0]
+	}
+}
+
+func lastOperand[T any](operands []any) (T, bool) {
+	var zero T
+	if len(operands) == 0 {
+		return zero, false
+	}
+	v, ok := operands[len(operands)-1].(T)
+	return v, ok
+}
+
+func pdfNumber(v any) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
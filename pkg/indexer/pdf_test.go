@@ -0,0 +1,235 @@
+package indexer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pdfBuilder lays out PDF files object by object, for the parser to read
+// back. Cross-reference tables are left out, as the parser never reads them.
+type pdfBuilder struct {
+	bytes.Buffer
+}
+
+func newPDFBuilder() *pdfBuilder {
+	b := &pdfBuilder{}
+	b.WriteString("%PDF-1.7\n")
+	return b
+}
+
+func (b *pdfBuilder) object(num int, body string) {
+	fmt.Fprintf(b, "%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func (b *pdfBuilder) trailer(dict string) {
+	fmt.Fprintf(b, "trailer\n%s\n%%%%EOF\n", dict)
+}
+
+func deflate(data string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(data))
+	w.Close()
+	return b.String()
+}
+
+func pdfStreamObject(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// pdfObjStm packs objects, numbered from num, into a compressed object stream
+func pdfObjStm(num int, bodies []string) string {
+	var header, body strings.Builder
+	for i, b := range bodies {
+		fmt.Fprintf(&header, "%d %d ", num+i, body.Len())
+		body.WriteString(b + "\n")
+	}
+	data := header.String() + body.String()
+	dict := fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(bodies), header.Len())
+	return pdfStreamObject(dict, deflate(data))
+}
+
+func pageText(s string) string {
+	return fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", s)
+}
+
+// pdfPages builds a PDF whose catalog and pages are packed in an object
+// stream, found through a cross-reference stream, as PDF 1.5 writers do
+func pdfPages(texts ...string) []byte {
+	// The object stream, then the page contents, then the packed objects
+	const objStm = 1
+	var (
+		catalog = objStm + len(texts) + 1
+		pages   = catalog + 1
+		first   = pages + 1
+	)
+	contents := make([]int, len(texts))
+	b := newPDFBuilder()
+	for i, text := range texts {
+		contents[i] = objStm + 1 + i
+		b.object(contents[i], pdfStreamObject("/Filter /FlateDecode", deflate(pageText(text))))
+	}
+
+	var kids []string
+	bodies := []string{
+		fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages),
+		"", // the page tree, once its kids are known
+	}
+	for i := range texts {
+		kids = append(kids, fmt.Sprintf("%d 0 R", first+i))
+		bodies = append(bodies, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R >>", pages, contents[i]))
+	}
+	bodies[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(texts))
+	b.object(objStm, pdfObjStm(catalog, bodies))
+
+	b.object(first+len(texts), pdfStreamObject(fmt.Sprintf("/Type /XRef /Root %d 0 R /Size %d", catalog, first+len(texts)+1), ""))
+	b.WriteString("startxref\n0\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestExtractPDF(t *testing.T) {
+	plain := newPDFBuilder()
+	plain.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	plain.object(2, "<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>")
+	plain.object(3, "<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>")
+	plain.object(4, "<< /Type /Page /Parent 2 0 R /Contents [6 0 R] >>")
+	plain.object(5, pdfStreamObject("", pageText("Hello")))
+	plain.object(6, pdfStreamObject("/Filter /ASCIIHexDecode", fmt.Sprintf("%X>", pageText("World"))))
+	plain.object(7, "<< /Title (Greetings) /Author (Someone) >>")
+	plain.trailer("<< /Root 1 0 R /Info 7 0 R /Size 8 >>")
+
+	// An incremental update redefines the second page's content
+	updated := bytes.Clone(plain.Bytes())
+	update := &pdfBuilder{*bytes.NewBuffer(updated)}
+	update.object(6, pdfStreamObject("", pageText("Again")))
+	update.trailer("<< /Root 1 0 R /Info 7 0 R /Size 8 >>")
+
+	tests := []struct {
+		name  string
+		data  []byte
+		text  string
+		pages []int
+		title string
+	}{
+		{"plain", plain.Bytes(), "Hello\fWorld", []int{0, 6}, "Greetings"},
+		{"incremental update", update.Bytes(), "Hello\fAgain", []int{0, 6}, "Greetings"},
+		{"object and xref streams", pdfPages("one", "two", "three"), "one\ftwo\fthree", []int{0, 4, 8}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := openPDF(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := f.extract()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Text != tt.text || !slices.Equal(e.Pages, tt.pages) || e.Title != tt.title {
+				t.Errorf("extracted %q, pages %v, title %q; want %q, %v, %q", e.Text, e.Pages, e.Title, tt.text, tt.pages, tt.title)
+			}
+		})
+	}
+}
+
+// An object stream is inflated once however many objects are loaded from
+// it, so long documents stay within the decoding budget
+func TestPDFObjectStreamDecodedOnce(t *testing.T) {
+	texts := make([]string, 1000)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("page%d", i)
+	}
+	f, err := openPDF(pdfPages(texts...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := f.extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Pages) != len(texts) || !strings.HasSuffix(e.Text, "\fpage999") {
+		t.Errorf("extracted %d pages, want %d", len(e.Pages), len(texts))
+	}
+
+	want := int64(len(f.streams[1].data))
+	for _, text := range texts {
+		want += int64(len(pageText(text)))
+	}
+	if used := pdfMaxDecodedSize - f.budget; used != want {
+		t.Errorf("decoded %d bytes, want %d", used, want)
+	}
+}
+
+func TestPDFBudget(t *testing.T) {
+	f, err := openPDF(pdfPages("one", "two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough for the first page's content but not the second's
+	f.budget = int64(len(pageText("one")))
+
+	if e, err := f.extract(); !errors.Is(err, errPDFTooLarge) {
+		t.Errorf("extract with the budget exhausted = %+v, %v, want %v", e, err, errPDFTooLarge)
+	}
+}
+
+func TestPDFMalformed(t *testing.T) {
+	encrypted := newPDFBuilder()
+	encrypted.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	encrypted.trailer("<< /Root 1 0 R /Encrypt << /Filter /Standard >> >>")
+
+	noCatalog := newPDFBuilder()
+	noCatalog.object(1, "<< /Type /Pages /Kids [] >>")
+	noCatalog.trailer("<< /Root 9 0 R >>")
+
+	noPages := newPDFBuilder()
+	noPages.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	noPages.object(2, "<< /Type /Pages /Kids [] /Count 0 >>")
+	noPages.trailer("<< /Root 1 0 R >>")
+
+	// Page tree nodes naming each other as kids must not recurse forever
+	cycle := newPDFBuilder()
+	cycle.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	cycle.object(2, "<< /Type /Pages /Kids [3 0 R] >>")
+	cycle.object(3, "<< /Type /Pages /Kids [2 0 R] >>")
+	cycle.trailer("<< /Root 1 0 R >>")
+
+	// An object stream claiming to contain itself
+	selfStream := newPDFBuilder()
+	selfStream.object(1, pdfStreamObject("/Type /ObjStm /N 1 /First 4", "1 0 << /Type /Catalog >>"))
+	selfStream.trailer("<< /Root 1 0 R >>")
+
+	truncated := pdfPages("one", "two")
+	truncated = truncated[:len(truncated)/2]
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not a PDF", []byte("hello world"), errPDFMalformed},
+		{"no objects", []byte("%PDF-1.4\n%%EOF\n"), errPDFMalformed},
+		{"encrypted", encrypted.Bytes(), errPDFEncrypted},
+		{"missing catalog", noCatalog.Bytes(), errPDFMalformed},
+		{"no pages", noPages.Bytes(), errPDFMalformed},
+		{"page tree cycle", cycle.Bytes(), errPDFMalformed},
+		{"object stream in itself", selfStream.Bytes(), errPDFMalformed},
+		{"truncated", truncated, errPDFMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := openPDF(tt.data)
+			if err == nil {
+				_, err = f.extract()
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package indexer
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfFont maps the byte codes of shown strings to text
+type pdfFont struct {
+	// toUnicode is the font's ToUnicode CMap, which takes precedence
+	toUnicode *pdfCMap
+
+	// encoding maps single-byte codes for simple fonts. It is nil for
+	// composite (Type0) fonts, whose codes are meaningless without a CMap.
+	encoding *[256]rune
+}
+
+// loadFont builds a font from its dictionary
+func (f *pdfFile) loadFont(d pdfDict) *pdfFont {
+	font := &pdfFont{}
+
+	if s, ok := f.resolve(d["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.decode(s); err == nil {
+			font.toUnicode = parseCMap(data)
+		}
+	}
+
+	if subtype, _ := f.resolve(d["Subtype"]).(pdfName); subtype == "Type0" {
+		return font
+	}
+
+	font.encoding = &winAnsiEncoding
+	switch enc := f.resolve(d["Encoding"]).(type) {
+	case pdfName:
+		font.encoding = namedEncoding(enc)
+	case pdfDict:
+		if base, ok := f.resolve(enc["BaseEncoding"]).(pdfName); ok {
+			font.encoding = namedEncoding(base)
+		}
+		if diffs, ok := f.resolve(enc["Differences"]).(pdfArray); ok {
+			custom := *font.encoding
+			code := 0
+			for _, item := range diffs {
+				switch v := f.resolve(item).(type) {
+				case int64:
+					code = int(v)
+				case pdfName:
+					if code >= 0 && code < 256 {
+						custom[code] = glyphRune(string(v))
+					}
+					code++
+				}
+			}
+			font.encoding = &custom
+		}
+	}
+	return font
+}
+
+// decode converts the bytes of a shown string to text
+func (font *pdfFont) decode(s []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if font.toUnicode != nil {
+			n := font.toUnicode.codeLength(s[i:])
+			if text, ok := font.toUnicode.mapping[string(s[i:i+n])]; ok {
+				b.WriteString(text)
+				i += n
+				continue
+			}
+			if font.encoding == nil {
+				i += n
+				continue
+			}
+		}
+		if font.encoding == nil {
+			// Composite font without a CMap: the text cannot be recovered
+			return b.String()
+		}
+		if r := font.encoding[s[i]]; r != 0 {
+			b.WriteRune(r)
+		}
+		i++
+	}
+	return b.String()
+}
+
+// pdfCMap is a parsed ToUnicode CMap
+type pdfCMap struct {
+	codespace []pdfCodeRange
+	mapping   map[string]string
+}
+
+type pdfCodeRange struct {
+	lo, hi []byte
+}
+
+// codeLength returns how many bytes the code at the start of s takes,
+// according to the codespace ranges
+func (c *pdfCMap) codeLength(s []byte) int {
+	for _, r := range c.codespace {
+		n := len(r.lo)
+		if n > len(s) || n == 0 {
+			continue
+		}
+		if bytes.Compare(s[:n], r.lo) >= 0 && bytes.Compare(s[:n], r.hi) <= 0 {
+			return n
+		}
+	}
+	if len(c.codespace) > 0 && len(c.codespace[0].lo) <= len(s) && len(c.codespace[0].lo) > 0 {
+		return len(c.codespace[0].lo)
+	}
+	return 1
+}
+
+// pdfMaxCMapRange bounds the codes expanded from a single bfrange
+const pdfMaxCMapRange = 1 << 16
+
+// parseCMap reads the codespace, bfchar and bfrange sections of a CMap
+func parseCMap(data []byte) *pdfCMap {
+	c := &pdfCMap{mapping: make(map[string]string)}
+	l := &pdfLexer{data: data}
+
+	var operands []any
+	for {
+		obj, err := l.object()
+		if err != nil {
+			return c
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) {
+					c.codespace = append(c.codespace, pdfCodeRange{lo, hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					c.mapping[string(src)] = utf16Text(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				c.mapRange(lo, hi, operands[i+2])
+			}
+		}
+		if strings.HasPrefix(string(kw), "end") || strings.HasPrefix(string(kw), "begin") {
+			operands = operands[:0]
+		}
+	}
+}
+
+// mapRange adds the codes lo..hi. dst is either the text of lo, with later
+// codes incrementing its last character, or an array with one entry per code.
+func (c *pdfCMap) mapRange(lo, hi []byte, dst any) {
+	start, end := codeValue(lo), codeValue(hi)
+	if end < start || end-start >= pdfMaxCMapRange {
+		return
+	}
+
+	for code := start; code <= end; code++ {
+		key := codeBytes(code, len(lo))
+		switch d := dst.(type) {
+		case pdfString:
+			units := utf16Units(d)
+			if len(units) == 0 {
+				return
+			}
+			units[len(units)-1] += uint16(code - start)
+			c.mapping[key] = string(utf16.Decode(units))
+		case pdfArray:
+			if i := int(code - start); i < len(d) {
+				if s, ok := d[i].(pdfString); ok {
+					c.mapping[key] = utf16Text(s)
+				}
+			}
+		}
+	}
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+func utf16Units(b []byte) []uint16 {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+func utf16Text(b []byte) string {
+	return string(utf16.Decode(utf16Units(b)))
+}
+
+// pdfTextString decodes a text string from the document information
+// dictionary: UTF-16 or UTF-8 with a byte order mark, otherwise
+// PDFDocEncoding, which matches WinAnsi for printable text
+func pdfTextString(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return utf16Text(b[2:])
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return string(b[3:])
+	}
+
+	var s strings.Builder
+	for _, c := range b {
+		if r := winAnsiEncoding[c]; r != 0 {
+			s.WriteRune(r)
+		}
+	}
+	return s.String()
+}
+
+func namedEncoding(name pdfName) *[256]rune {
+	switch name {
+	case "MacRomanEncoding":
+		return &macRomanEncoding
+	case "StandardEncoding":
+		return &standardEncoding
+	}
+	return &winAnsiEncoding
+}
+
+// glyphRune maps a glyph name from an encoding's Differences array to a
+// character. Unknown names map to 0 and are dropped.
+func glyphRune(name string) rune {
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	// uniXXXX and uXXXX[XX] name Unicode code points directly
+	if hexDigits, ok := strings.CutPrefix(name, "uni"); ok && len(hexDigits) >= 4 {
+		if v, err := strconv.ParseUint(hexDigits[:4], 16, 32); err == nil {
+			return rune(v)
+		}
+	}
+	if hexDigits, ok := strings.CutPrefix(name, "u"); ok && len(hexDigits) >= 4 && len(hexDigits) <= 6 {
+		if v, err := strconv.ParseUint(hexDigits, 16, 32); err == nil {
+			return rune(v)
+		}
+	}
+	// Ligatures and other suffixed variants such as "a.sc" or "f_i"
+	if base, _, ok := strings.Cut(name, "."); ok {
+		return glyphRune(base)
+	}
+	return 0
+}
+
+var (
+	winAnsiEncoding  [256]rune
+	macRomanEncoding [256]rune
+	standardEncoding [256]rune
+	glyphNames       = make(map[string]rune)
+)
+
+// winAnsiNames are the glyph names of WinAnsiEncoding from 0x20, in order
+var winAnsiNames = strings.Fields(`
+	space exclam quotedbl numbersign dollar percent ampersand quotesingle
+	parenleft parenright asterisk plus comma hyphen period slash
+	zero one two three four five six seven eight nine colon semicolon less equal greater question
+	at A B C D E F G H I J K L M N O P Q R S T U V W X Y Z
+	bracketleft backslash bracketright asciicircum underscore
+	grave a b c d e f g h i j k l m n o p q r s t u v w x y z
+	braceleft bar braceright asciitilde .notdef
+	Euro .notdef quotesinglbase florin quotedblbase ellipsis dagger daggerdbl
+	circumflex perthousand Scaron guilsinglleft OE .notdef Zcaron .notdef
+	.notdef quoteleft quoteright quotedblleft quotedblright bullet endash emdash
+	tilde trademark scaron guilsinglright oe .notdef zcaron Ydieresis
+	nbspace exclamdown cent sterling currency yen brokenbar section
+	dieresis copyright ordfeminine guillemotleft logicalnot sfthyphen registered macron
+	degree plusminus twosuperior threesuperior acute mu paragraph periodcentered
+	cedilla onesuperior ordmasculine guillemotright onequarter onehalf threequarters questiondown
+	Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla
+	Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis
+	Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply
+	Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls
+	agrave aacute acircumflex atilde adieresis aring ae ccedilla
+	egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis
+	eth ntilde ograve oacute ocircumflex otilde odieresis divide
+	oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis
+`)
+
+// winAnsiHigh holds the characters of WinAnsiEncoding 0x80-0x9F that differ
+// from Latin-1
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+// macRomanHigh is MacRomanEncoding from 0x80
+var macRomanHigh = []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü" +
+	"†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø" +
+	"¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ" +
+	"‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ")
+
+func init() {
+	for i := 0x20; i < 0x100; i++ {
+		r := rune(i)
+		if high, ok := winAnsiHigh[byte(i)]; ok {
+			r = high
+		} else if i >= 0x7f && i < 0xa0 {
+			r = 0
+		}
+		winAnsiEncoding[i] = r
+		if name := winAnsiNames[i-0x20]; name != ".notdef" && r != 0 {
+			glyphNames[name] = r
+		}
+	}
+	winAnsiEncoding['\t'] = '\t'
+	winAnsiEncoding['\n'] = '\n'
+	winAnsiEncoding['\r'] = '\n'
+
+	for name, r := range map[string]rune{
+		"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ',
+		"minus": '−', "dotlessi": 'ı', "Lslash": 'Ł', "lslash": 'ł',
+		"fraction": '⁄', "quotesingle": '\'', "sfthyphen": '-', "nbspace": ' ',
+	} {
+		glyphNames[name] = r
+	}
+
+	copy(macRomanEncoding[:0x80], winAnsiEncoding[:0x80])
+	for i, r := range macRomanHigh {
+		macRomanEncoding[0x80+i] = r
+	}
+
+	// StandardEncoding differs from WinAnsi mostly in its quotes; the
+	// remaining differences only affect rarely used symbols
+	standardEncoding = winAnsiEncoding
+	standardEncoding['\''] = '’'
+	standardEncoding['`'] = '‘'
+}
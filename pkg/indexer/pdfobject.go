@@ -0,0 +1,678 @@
+package indexer
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// The PDF object model, as produced by pdfLexer.object
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfKeyword string
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte // still encoded
+	}
+)
+
+const (
+	// pdfMaxStreamSize caps the decoded size of a single stream
+	pdfMaxStreamSize = 64 << 20
+
+	// pdfMaxDecodedSize caps the bytes decoded from one file, so a
+	// compression bomb cannot exhaust memory
+	pdfMaxDecodedSize = 256 << 20
+
+	// pdfMaxDepth bounds recursion through nested objects, page trees and
+	// form XObjects
+	pdfMaxDepth = 32
+)
+
+var (
+	errPDFTooLarge   = errors.New("decoded content exceeds size limit")
+	errPDFEncrypted  = errors.New("encrypted PDF")
+	errPDFMalformed  = errors.New("malformed PDF")
+	errPDFUnfiltered = errors.New("unsupported stream filter")
+)
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// pdfLexer reads objects from PDF syntax: file bodies, content streams and
+// CMaps all share it
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// token reads one primitive: a number, name, string or keyword. Array and
+// dictionary delimiters are returned as keywords.
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literalString(), nil
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return pdfKeyword("<<"), nil
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return pdfKeyword(">>"), nil
+	case c == '<':
+		return l.hexString(), nil
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(c), nil
+	case c == ')' || c == '>':
+		// Stray delimiter; skip it rather than loop forever
+		l.pos++
+		return l.token()
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+
+	if c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, nil
+		}
+	}
+	return pdfKeyword(word), nil
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++ // '/'
+	var b []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				b = append(b, v[0])
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return pdfName(b)
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // '('
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// Line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // '<'
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		c := l.data[l.pos]
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++ // '>'
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b, _ := hex.DecodeString(string(digits))
+	return b
+}
+
+// object reads a complete object, assembling arrays, dictionaries and
+// indirect references from their tokens
+func (l *pdfLexer) object() (any, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case int64:
+		// "num gen R" is a reference; anything else leaves the lexer as it was
+		save := l.pos
+		if gen, err := l.token(); err == nil {
+			if g, ok := gen.(int64); ok {
+				if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+					return pdfRef{int(t), int(g)}, nil
+				}
+			}
+		}
+		l.pos = save
+		return t, nil
+
+	case pdfKeyword:
+		switch t {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		case "[":
+			return l.array()
+		case "<<":
+			return l.dict()
+		}
+	}
+	return tok, nil
+}
+
+func (l *pdfLexer) array() (pdfArray, error) {
+	if l.depth >= pdfMaxDepth {
+		return nil, errPDFMalformed
+	}
+	l.depth++
+	defer func() { l.depth-- }()
+
+	var a pdfArray
+	for {
+		obj, err := l.object()
+		if err != nil {
+			return a, err
+		}
+		if obj == pdfKeyword("]") {
+			return a, nil
+		}
+		a = append(a, obj)
+	}
+}
+
+func (l *pdfLexer) dict() (pdfDict, error) {
+	if l.depth >= pdfMaxDepth {
+		return nil, errPDFMalformed
+	}
+	l.depth++
+	defer func() { l.depth-- }()
+
+	d := make(pdfDict)
+	for {
+		key, err := l.object()
+		if err != nil {
+			return d, err
+		}
+		if key == pdfKeyword(">>") {
+			return d, nil
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			continue
+		}
+		value, err := l.object()
+		if err != nil {
+			return d, err
+		}
+		if value == pdfKeyword(">>") {
+			return d, nil
+		}
+		d[name] = value
+	}
+}
+
+// pdfObjectLoc records where the latest definition of an object lives:
+// directly in the file, or at an index inside an object stream
+type pdfObjectLoc struct {
+	offset int // of "num gen obj", or of the containing object stream
+	stream int // object number of the containing stream, or -1
+	index  int
+}
+
+// pdfFile gives access to the objects of a PDF. Rather than trusting the
+// cross-reference table, which is often damaged, it indexes every
+// "num gen obj" header in the file, letting later definitions win as
+// incremental updates do.
+type pdfFile struct {
+	data    []byte
+	objects map[int]pdfObjectLoc
+	cache   map[int]any
+	trailer pdfDict
+
+	// streams holds the object streams decoded so far by object number,
+	// nil for those that could not be, so each is inflated only once
+	streams map[int]*pdfObjectStream
+
+	// budget is what is left of pdfMaxDecodedSize; exhausted records that
+	// a stream was skipped for lack of it, leaving the text incomplete
+	budget    int64
+	exhausted bool
+}
+
+// pdfObjectStream is a decoded object stream with the number and offset of
+// each object it packs
+type pdfObjectStream struct {
+	data    []byte
+	first   int64
+	nums    []int
+	offsets []int64
+}
+
+var (
+	pdfObjectHeader = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+	pdfObjStmMarker = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	pdfXRefMarker   = regexp.MustCompile(`/Type\s*/XRef\b`)
+)
+
+func openPDF(data []byte) (*pdfFile, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data[:min(len(data), 1024)], "\x00\t\r\n "), []byte("%PDF-")) {
+		return nil, fmt.Errorf("%w: missing header", errPDFMalformed)
+	}
+
+	f := &pdfFile{
+		data:    data,
+		objects: make(map[int]pdfObjectLoc),
+		cache:   make(map[int]any),
+		trailer: make(pdfDict),
+		streams: make(map[int]*pdfObjectStream),
+		budget:  pdfMaxDecodedSize,
+	}
+
+	var offsets []int
+	for _, m := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		f.objects[num] = pdfObjectLoc{offset: m[0], stream: -1}
+		offsets = append(offsets, m[0])
+	}
+	if len(f.objects) == 0 {
+		return nil, fmt.Errorf("%w: no objects", errPDFMalformed)
+	}
+
+	// containing returns the object number whose definition encloses pos
+	containing := func(pos int) (int, bool) {
+		i := sort.SearchInts(offsets, pos+1) - 1
+		if i < 0 {
+			return 0, false
+		}
+		l := &pdfLexer{data: data, pos: offsets[i]}
+		n, _ := l.token()
+		num, ok := n.(int64)
+		return int(num), ok
+	}
+
+	f.indexObjectStreams(pdfObjStmMarker.FindAllIndex(data, -1), containing)
+	f.readTrailers(pdfXRefMarker.FindAllIndex(data, -1), containing)
+
+	if _, ok := f.trailer["Encrypt"]; ok {
+		return nil, errPDFEncrypted
+	}
+	return f, nil
+}
+
+// indexObjectStreams records the objects packed into object streams
+func (f *pdfFile) indexObjectStreams(markers [][]int, containing func(int) (int, bool)) {
+	for _, m := range markers {
+		num, ok := containing(m[0])
+		if !ok {
+			continue
+		}
+		loc := f.objects[num]
+		s := f.objectStream(num)
+		if s == nil {
+			continue
+		}
+		for i, on := range s.nums {
+			if existing, ok := f.objects[on]; ok && existing.offset > loc.offset {
+				continue
+			}
+			f.objects[on] = pdfObjectLoc{offset: loc.offset, stream: num, index: i}
+		}
+	}
+}
+
+// objectStream decodes the object stream with object number num and reads
+// its table of objects, once per file
+func (f *pdfFile) objectStream(num int) *pdfObjectStream {
+	if s, ok := f.streams[num]; ok {
+		return s
+	}
+	// Guard against a stream that is packed in itself
+	f.streams[num] = nil
+
+	stream, ok := f.load(num).(*pdfStream)
+	if !ok {
+		return nil
+	}
+	data, err := f.decode(stream)
+	if err != nil {
+		return nil
+	}
+
+	s := &pdfObjectStream{data: data}
+	s.first, _ = f.resolve(stream.dict["First"]).(int64)
+	n, _ := f.resolve(stream.dict["N"]).(int64)
+	l := &pdfLexer{data: data}
+	for range n {
+		objNum, _ := l.token()
+		offset, _ := l.token()
+		on, ok := objNum.(int64)
+		off, ok2 := offset.(int64)
+		if !ok || !ok2 {
+			break
+		}
+		s.nums = append(s.nums, int(on))
+		s.offsets = append(s.offsets, off)
+	}
+	f.streams[num] = s
+	return s
+}
+
+// readTrailers merges every trailer dictionary and cross-reference stream
+// dictionary, later ones taking precedence
+func (f *pdfFile) readTrailers(xrefMarkers [][]int, containing func(int) (int, bool)) {
+	type trailer struct {
+		offset int
+		dict   pdfDict
+	}
+	var trailers []trailer
+
+	for i := 0; ; {
+		j := bytes.Index(f.data[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		i += j + len("trailer")
+		l := &pdfLexer{data: f.data, pos: i}
+		if d, ok := mustObject(l).(pdfDict); ok {
+			trailers = append(trailers, trailer{i, d})
+		}
+	}
+	for _, m := range xrefMarkers {
+		if num, ok := containing(m[0]); ok {
+			if s, ok := f.resolve(pdfRef{num: num}).(*pdfStream); ok {
+				trailers = append(trailers, trailer{m[0], s.dict})
+			}
+		}
+	}
+
+	sort.Slice(trailers, func(i, j int) bool { return trailers[i].offset < trailers[j].offset })
+	for _, t := range trailers {
+		for _, key := range []pdfName{"Root", "Info", "Encrypt"} {
+			if v, ok := t.dict[key]; ok {
+				f.trailer[key] = v
+			}
+		}
+	}
+}
+
+func mustObject(l *pdfLexer) any {
+	obj, _ := l.object()
+	return obj
+}
+
+// resolve follows references until it reaches a direct object. Missing
+// objects resolve to nil, as the specification requires.
+func (f *pdfFile) resolve(obj any) any {
+	for range pdfMaxDepth {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = f.load(ref.num)
+	}
+	return nil
+}
+
+func (f *pdfFile) load(num int) any {
+	if obj, ok := f.cache[num]; ok {
+		return obj
+	}
+	// Guard against reference cycles while loading
+	f.cache[num] = nil
+
+	loc, ok := f.objects[num]
+	if !ok {
+		return nil
+	}
+
+	var obj any
+	if loc.stream >= 0 {
+		obj = f.loadFromStream(loc)
+	} else {
+		obj = f.loadDirect(loc.offset)
+	}
+	f.cache[num] = obj
+	return obj
+}
+
+func (f *pdfFile) loadDirect(offset int) any {
+	l := &pdfLexer{data: f.data, pos: offset}
+	l.token() // num
+	l.token() // gen
+	l.token() // obj
+
+	obj, err := l.object()
+	if err != nil {
+		return obj
+	}
+
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return obj
+	}
+	save := l.pos
+	if tok, err := l.token(); err != nil || tok != pdfKeyword("stream") {
+		l.pos = save
+		return obj
+	}
+
+	// Stream data starts after the end-of-line following the keyword
+	start := l.pos
+	if start < len(f.data) && f.data[start] == '\r' {
+		start++
+	}
+	if start < len(f.data) && f.data[start] == '\n' {
+		start++
+	}
+
+	end := -1
+	if n, ok := f.resolve(dict["Length"]).(int64); ok && n >= 0 && start+int(n) <= len(f.data) {
+		rest := bytes.TrimLeft(f.data[start+int(n):min(start+int(n)+32, len(f.data))], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			end = start + int(n)
+		}
+	}
+	if end < 0 {
+		// Wrong or missing length: fall back to the endstream keyword
+		i := bytes.Index(f.data[start:], []byte("endstream"))
+		if i < 0 {
+			return &pdfStream{dict: dict}
+		}
+		end = start + i
+	}
+	return &pdfStream{dict: dict, data: f.data[start:end]}
+}
+
+func (f *pdfFile) loadFromStream(loc pdfObjectLoc) any {
+	s := f.objectStream(loc.stream)
+	if s == nil || loc.index >= len(s.offsets) {
+		return nil
+	}
+	pos := s.first + s.offsets[loc.index]
+	if pos < 0 || pos >= int64(len(s.data)) {
+		return nil
+	}
+
+	l := &pdfLexer{data: s.data, pos: int(pos)}
+	return mustObject(l)
+}
+
+// decode applies a stream's filters. Only the filters that carry text are
+// supported; image codecs report errPDFUnfiltered.
+func (f *pdfFile) decode(s *pdfStream) ([]byte, error) {
+	var filters []any
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{v}
+	case pdfArray:
+		filters = v
+	}
+
+	data := s.data
+	for _, filter := range filters {
+		name, _ := f.resolve(filter).(pdfName)
+
+		var r io.Reader
+		switch name {
+		case "FlateDecode", "Fl":
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				// Some writers omit the zlib header
+				r = flate.NewReader(bytes.NewReader(data))
+			} else {
+				r = zr
+			}
+		case "ASCIIHexDecode", "AHx":
+			end := bytes.IndexByte(data, '>')
+			if end < 0 {
+				end = len(data)
+			}
+			l := &pdfLexer{data: append(append([]byte("<"), data[:end]...), '>')}
+			data = l.hexString()
+			continue
+		case "ASCII85Decode", "A85":
+			data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+			if end := bytes.Index(data, []byte("~>")); end >= 0 {
+				data = data[:end]
+			}
+			r = ascii85.NewDecoder(bytes.NewReader(data))
+		default:
+			return nil, fmt.Errorf("%w: %s", errPDFUnfiltered, name)
+		}
+
+		limit := min(int64(pdfMaxStreamSize), f.budget)
+		decoded, err := io.ReadAll(io.LimitReader(r, limit+1))
+		if int64(len(decoded)) > limit {
+			if limit == f.budget {
+				f.exhausted = true
+			}
+			return nil, errPDFTooLarge
+		}
+		f.budget -= int64(len(decoded))
+		// Truncated streams are common; keep whatever was recovered
+		if err != nil && len(decoded) == 0 {
+			return nil, err
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+// dict resolves obj to a dictionary, looking through streams
+func (f *pdfFile) dict(obj any) pdfDict {
+	switch v := f.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
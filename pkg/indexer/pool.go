@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"os"
+	"sync"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// fileJob is a file the walker found that needs to be read
+type fileJob struct {
+	seq      int
+	path     string
+	info     os.FileInfo
+	existing indexedFile
+	found    bool
+}
+
+// fileResult is a fileJob after a worker has read and hashed it
+type fileResult struct {
+	fileJob
+	doc *types.Document
+	err error
+}
+
+// FileError records a file that could not be indexed
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// readPool reads files on a bounded number of goroutines and hands the
+// results back in the order the walker submitted them, so progress output
+// stays stable regardless of which worker finishes first
+type readPool struct {
+	jobs    chan fileJob
+	results chan fileResult
+	workers sync.WaitGroup
+	done    chan struct{}
+	next    int
+}
+
+// newReadPool starts workers readers and a collector that calls handle for
+// each result in submission order. handle runs on a single goroutine.
+func newReadPool(workers int, handle func(fileResult)) *readPool {
+	workers = max(workers, 1)
+
+	p := &readPool{
+		jobs:    make(chan fileJob, workers*4),
+		results: make(chan fileResult, workers*4),
+		done:    make(chan struct{}),
+	}
+
+	for range workers {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range p.jobs {
+				doc, err := createDocumentForFile(job.path)
+				p.results <- fileResult{fileJob: job, doc: doc, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.done)
+
+		// Results that arrived ahead of their turn, keyed by sequence number
+		waiting := make(map[int]fileResult)
+		next := 0
+		for result := range p.results {
+			waiting[result.seq] = result
+			for {
+				r, ok := waiting[next]
+				if !ok {
+					break
+				}
+				delete(waiting, next)
+				handle(r)
+				next++
+			}
+		}
+	}()
+
+	return p
+}
+
+// submit queues a file for reading. It blocks while the workers are busy.
+func (p *readPool) submit(job fileJob) {
+	job.seq = p.next
+	p.next++
+	p.jobs <- job
+}
+
+// wait blocks until every submitted file has been handled
+func (p *readPool) wait() {
+	close(p.jobs)
+	p.workers.Wait()
+	close(p.results)
+	<-p.done
+}
@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ProgressKind is what a Progress event reports
+type ProgressKind string
+
+const (
+	// ProgressDiscovered: the walk found a file to index
+	ProgressDiscovered ProgressKind = "discovered"
+
+	// ProgressExtracted: a new or changed file was read and its text
+	// extracted. Error is set if only its name and metadata could be kept.
+	ProgressExtracted ProgressKind = "extracted"
+
+	// ProgressSkipped: a file was left out; Reason says why
+	ProgressSkipped ProgressKind = "skipped"
+
+	// ProgressUploaded: a batch of Documents reached the backend
+	ProgressUploaded ProgressKind = "uploaded"
+
+	// ProgressDone: the run finished, failed or was cancelled. Stats is set
+	// if it finished, Error otherwise.
+	ProgressDone ProgressKind = "done"
+)
+
+// SkipReason says why a file was skipped
+type SkipReason string
+
+const (
+	// SkipIgnored files are excluded by ignore files, ignore patterns or
+	// their extension. They are not counted as discovered.
+	SkipIgnored SkipReason = "ignored"
+
+	// SkipUnchanged files match the stored document
+	SkipUnchanged SkipReason = "unchanged"
+
+	// SkipUnreadable files could not be read; Error says why
+	SkipUnreadable SkipReason = "unreadable"
+)
+
+// Progress is an event of an IndexDirectory run. The counts are running
+// totals, so every event describes the whole run so far.
+type Progress struct {
+	Kind   ProgressKind `json:"kind"`
+	Root   string       `json:"root"`
+	Path   string       `json:"path,omitempty"`
+	Reason SkipReason   `json:"reason,omitempty"`
+	Error  string       `json:"error,omitempty"`
+
+	// Documents is the size of an uploaded batch
+	Documents int `json:"documents,omitempty"`
+
+	// Discovered counts the files found so far, and Processed those of them
+	// extracted or skipped. Discovered is final once Walked is set.
+	Discovered int  `json:"discovered"`
+	Processed  int  `json:"processed"`
+	Walked     bool `json:"walked"`
+
+	// Uploaded counts the documents stored, including metadata updates
+	Uploaded int `json:"uploaded"`
+
+	// Elapsed is the time since the run started, in nanoseconds in JSON
+	Elapsed time.Duration `json:"elapsed_ns"`
+
+	Stats *IndexStats `json:"stats,omitempty"`
+}
+
+// progress keeps the running totals of a run and passes each event to the
+// callback. Events come from the walk, the read pool and the uploads, so
+// they are serialised: the callback is never called concurrently.
+type progress struct {
+	fn      func(Progress)
+	root    string
+	started time.Time
+
+	mu         sync.Mutex
+	discovered int
+	processed  int
+	uploaded   int
+	walked     bool
+}
+
+func newProgress(fn func(Progress), root string) *progress {
+	return &progress{fn: fn, root: root, started: time.Now()}
+}
+
+// report counts an event and passes it on with the totals filled in
+func (p *progress) report(e Progress) {
+	if p.fn == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch e.Kind {
+	case ProgressDiscovered:
+		p.discovered++
+	case ProgressExtracted:
+		p.processed++
+	case ProgressSkipped:
+		if e.Reason != SkipIgnored {
+			p.processed++
+		}
+	case ProgressUploaded:
+		p.uploaded += e.Documents
+	case ProgressDone:
+		p.walked = true
+	}
+
+	e.Root = p.root
+	e.Discovered = p.discovered
+	e.Processed = p.processed
+	e.Walked = p.walked
+	e.Uploaded = p.uploaded
+	e.Elapsed = time.Since(p.started)
+	p.fn(e)
+}
+
+// walkDone marks Discovered as final in the events that follow
+func (p *progress) walkDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.walked = true
+}
+
+// skipped reports a file left out for reason
+func (p *progress) skipped(path string, reason SkipReason, err error) {
+	e := Progress{Kind: ProgressSkipped, Path: path, Reason: reason}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	p.report(e)
+}
+
+// done reports the end of the run
+func (p *progress) done(stats *IndexStats, err error) {
+	e := Progress{Kind: ProgressDone, Stats: stats}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	p.report(e)
+}
+
+// MarshalJSON encodes the error as its message
+func (e FileError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path  string `json:"path"`
+		Error string `json:"error"`
+	}{e.Path, e.Err.Error()})
+}
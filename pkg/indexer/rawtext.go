@@ -0,0 +1,18 @@
+package indexer
+
+import (
+	"io"
+	"os"
+)
+
+// rawTextExtractor indexes a file's bytes as they are. It is used for source
+// code, plain text and anything no other extractor claims.
+var rawTextExtractor Extractor = ExtractorFunc(extractRawText)
+
+func extractRawText(path string, r io.Reader, info os.FileInfo) (*Extraction, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Extraction{Text: string(content)}, nil
+}
@@ -0,0 +1,102 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sahil485/memex/pkg/config"
+)
+
+// Run is the outcome of the latest IndexDirectory call for a root, kept in
+// ~/.memex/runs.json so status reports can say when each root was indexed
+type Run struct {
+	Root       string    `json:"root"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Added      int       `json:"added"`
+	Updated    int       `json:"updated"`
+	Unchanged  int       `json:"unchanged"`
+	Removed    int       `json:"removed"`
+	Errors     int       `json:"errors"`
+}
+
+// RunsPath returns the location of the index run record
+func RunsPath() string {
+	return filepath.Join(config.Dir(), "runs.json")
+}
+
+// ReadRuns returns the latest run of each indexed root, ordered by root
+func ReadRuns() ([]Run, error) {
+	data, err := os.ReadFile(RunsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("invalid run record %s: %w", RunsPath(), err)
+	}
+	return runs, nil
+}
+
+// recordRun replaces the recorded run of the same root with run
+func recordRun(run Run) error {
+	runs, err := otherRuns(run.Root)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Root < runs[j].Root })
+	return writeRuns(runs)
+}
+
+// ForgetRun drops the recorded run of root, so it is no longer reported as
+// indexed
+func ForgetRun(root string) error {
+	runs, err := otherRuns(root)
+	if err != nil {
+		return err
+	}
+	return writeRuns(runs)
+}
+
+// otherRuns returns the recorded runs of every root but root
+func otherRuns(root string) ([]Run, error) {
+	runs, err := ReadRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := runs[:0]
+	for _, r := range runs {
+		if r.Root != root {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+func writeRuns(runs []Run) error {
+	if err := os.MkdirAll(config.Dir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so readers never see a partial file
+	tmp := RunsPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, RunsPath())
+}
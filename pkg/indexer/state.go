@@ -0,0 +1,166 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// indexedFile is the subset of a stored document needed to decide whether
+// a file on disk has changed since it was last indexed
+type indexedFile struct {
+	ID          string   `json:"id"`
+	Path        string   `json:"path"`
+	Size        int64    `json:"size"`
+	ModTime     int64    `json:"mod_time"`
+	ContentHash string   `json:"content_hash"`
+	ParentID    string   `json:"parent_id"`
+	Passages    int      `json:"passages"`
+	Dirs        []string `json:"dirs"`
+}
+
+// indexedFileFields are the document fields decoded into an indexedFile
+var indexedFileFields = []string{"id", "path", "size", "mod_time", "content_hash", "parent_id", "passages", "dirs"}
+
+// unchanged reports whether the file's stat info still matches what was
+// indexed. Documents stored before Dirs existed always count as changed, so
+// a re-index fills it in.
+func (f indexedFile) unchanged(info os.FileInfo) bool {
+	return f.Size == info.Size() && f.ModTime == info.ModTime().Unix() && len(f.Dirs) > 0
+}
+
+// documentIDs returns the ID of the file's document and of its passages
+func (f indexedFile) documentIDs() []string {
+	return append([]string{f.ID}, f.passageIDsFrom(0)...)
+}
+
+// passageIDsFrom returns the IDs of the file's passages from the nth on,
+// which are stale once the file is re-indexed with only n passages
+func (f indexedFile) passageIDsFrom(n int) []string {
+	var ids []string
+	for i := n; i < f.Passages; i++ {
+		ids = append(ids, types.PassageID(f.ID, i))
+	}
+	return ids
+}
+
+// metadataUpdate is a partial document used to refresh stat fields of a file
+// whose content hash is unchanged, without re-sending its content
+type metadataUpdate struct {
+	ID        string   `json:"id"`
+	Dirs      []string `json:"dirs"`
+	Size      int64    `json:"size"`
+	ModTime   int64    `json:"mod_time"`
+	IndexedAt int64    `json:"indexed_at"`
+}
+
+func newMetadataUpdate(id, path string, info os.FileInfo) metadataUpdate {
+	return metadataUpdate{
+		ID:        id,
+		Dirs:      types.Ancestors(filepath.Dir(path)),
+		Size:      info.Size(),
+		ModTime:   info.ModTime().Unix(),
+		IndexedAt: time.Now().Unix(),
+	}
+}
+
+// ensureSettings applies the index settings if they differ from those of
+// this version. Indexes created by earlier versions reject filters on the
+// attributes made filterable since, such as dirs.
+func ensureSettings(b backend.SearchBackend) error {
+	problems, err := b.CheckSettings()
+	if err == nil && len(problems) == 0 {
+		return nil
+	}
+	// Init also creates the index if the check failed for want of one
+	return b.Init()
+}
+
+// loadIndexedFiles returns every indexed document under root, keyed by path.
+// Only the documents whose dirs hold root, or the file at root itself, are
+// fetched, along with any indexed before dirs was added. Those are
+// rewritten with it when their root is indexed, so they are looked at once.
+func loadIndexedFiles(b backend.SearchBackend, root string) (map[string]indexedFile, error) {
+	root = filepath.Clean(root)
+	prefix := root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+
+	files := make(map[string]indexedFile)
+
+	value := types.FilterValue(root)
+	filter := "dirs = " + value + " OR path = " + value + " OR NOT dirs EXISTS"
+	err := b.EachDocument(filter, indexedFileFields, func(hit types.Hit) error {
+		var f indexedFile
+		if err := hit.DecodeInto(&f); err != nil {
+			return err
+		}
+		// Passages are tracked through their file's document
+		if f.ParentID != "" {
+			return nil
+		}
+		if f.Path == root || strings.HasPrefix(f.Path, prefix) {
+			files[f.Path] = f
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// lookupIndexedFile returns the stored document of a single file
+func lookupIndexedFile(b backend.SearchBackend, path string) (indexedFile, bool) {
+	var f indexedFile
+	found, err := b.GetDocument(types.DocumentID(path), indexedFileFields, &f)
+	return f, err == nil && found && f.ID != ""
+}
+
+// staleFiles returns the indexed files that were not visited during the
+// walk, either because they no longer exist or because an ignore rule now
+// excludes them. Files under paths the walk failed to read are kept, since
+// their absence says nothing about whether they still exist. So are files
+// under the keep directories.
+func staleFiles(indexed map[string]indexedFile, seen map[string]bool, unreadable []FileError, keep []string) []indexedFile {
+	stale := make([]indexedFile, 0)
+	for path, f := range indexed {
+		if seen[path] || underAny(path, unreadable) || underAnyDir(path, keep) {
+			continue
+		}
+		stale = append(stale, f)
+	}
+	return stale
+}
+
+func underAny(path string, errs []FileError) bool {
+	for _, e := range errs {
+		if path == e.Path || strings.HasPrefix(path, e.Path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteBatchSize caps how many IDs are sent in a single delete request
+const deleteBatchSize = 1000
+
+// deleteDocuments removes documents by ID in batches, waiting for each one
+func deleteDocuments(b backend.SearchBackend, ids []string) error {
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(ids))
+
+		if err := b.DeleteDocuments(ids[start:end]); err != nil {
+			return fmt.Errorf("failed to delete documents: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,463 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sahil485/memex/pkg/backend"
+)
+
+const (
+	// watchDebounce is how long the watcher waits for events to settle
+	// before applying them to the index
+	watchDebounce = 500 * time.Millisecond
+
+	// watchMaxDelay bounds how long a continuous stream of events can
+	// postpone a flush
+	watchMaxDelay = 5 * time.Second
+)
+
+// Watcher keeps the index in sync with one or more directory trees by
+// applying filesystem events as they happen. It uses inotify on Linux,
+// FSEvents/kqueue on macOS and ReadDirectoryChangesW on Windows.
+type Watcher struct {
+	fs      *fsnotify.Watcher
+	backend backend.SearchBackend
+
+	mu      sync.Mutex
+	roots   map[string]*watchRoot
+	dirs    map[string]bool
+	pending map[string]bool
+}
+
+// watchRoot holds the options a watched directory was added with
+type watchRoot struct {
+	opts  Options
+	rules *ignoreRules
+}
+
+// watchChanges are the changes a flush applies to the files of one root
+type watchChanges struct {
+	toIndex  []string
+	toDelete []string
+	removed  int
+}
+
+// NewWatcher creates a watcher with no roots. Use Add to start watching a
+// directory and Run to process events.
+func NewWatcher() (*Watcher, error) {
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	return &Watcher{
+		fs:      fs,
+		backend: backend.New(),
+		roots:   make(map[string]*watchRoot),
+		dirs:    make(map[string]bool),
+		pending: make(map[string]bool),
+	}, nil
+}
+
+// Add starts watching directory and every non-ignored directory below it.
+// It does not index existing files; run IndexDirectory first for that.
+func (w *Watcher) Add(directory string, opts Options) error {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+
+	root := &watchRoot{opts: opts, rules: newIgnoreRules(directory, opts)}
+
+	w.mu.Lock()
+	w.roots[directory] = root
+	w.mu.Unlock()
+
+	_, err = w.watchTree(directory, root.rules)
+	return err
+}
+
+// Remove stops watching directory. Directories below it that are inside
+// another watched root stay watched.
+func (w *Watcher) Remove(directory string) error {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.roots, directory)
+
+	prefix := directory + string(filepath.Separator)
+	var errs []error
+	for dir := range w.dirs {
+		if dir != directory && !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		if w.rootForLocked(dir) != nil {
+			continue
+		}
+		delete(w.dirs, dir)
+		if err := w.fs.Remove(dir); err != nil && !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops watching all directories
+func (w *Watcher) Close() error {
+	return w.fs.Close()
+}
+
+// Run processes filesystem events until ctx is cancelled or the watcher is closed
+func (w *Watcher) Run(ctx context.Context) error {
+	var (
+		timer   *time.Timer
+		timerC  <-chan time.Time
+		firstAt time.Time
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.flush()
+			return ctx.Err()
+
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			w.mu.Lock()
+			if len(w.pending) == 0 {
+				firstAt = time.Now()
+			}
+			w.pending[filepath.Clean(event.Name)] = true
+			w.mu.Unlock()
+
+			// Restart the quiet period, but never past the maximum delay
+			delay := watchDebounce
+			if remaining := watchMaxDelay - time.Since(firstAt); remaining < delay {
+				delay = max(remaining, 0)
+			}
+			if timer == nil {
+				timer = time.NewTimer(delay)
+			} else {
+				timer.Reset(delay)
+			}
+			timerC = timer.C
+
+		case <-timerC:
+			timerC = nil
+			w.flush()
+
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil
+			}
+			w.logf("Watch error: %v\n", err)
+		}
+	}
+}
+
+// flush applies every pending path to the index. Each path is looked at
+// once, so a burst of writes to the same file results in a single upload.
+func (w *Watcher) flush() {
+	w.mu.Lock()
+	paths := w.pending
+	w.pending = make(map[string]bool)
+	w.mu.Unlock()
+
+	if len(paths) == 0 {
+		return
+	}
+
+	// Follow the server if it moved to another endpoint since the last flush
+	w.backend = backend.New()
+
+	// Files are indexed with the options of the root they are in
+	changes := make(map[*watchRoot]*watchChanges)
+
+	for path := range paths {
+		root := w.rootFor(path)
+		if root == nil {
+			continue
+		}
+		rules, opts := root.rules, root.opts
+		c := changes[root]
+		if c == nil {
+			c = &watchChanges{}
+			changes[root] = c
+		}
+
+		// Edited ignore files apply to future events in their directory, and
+		// end the watches on the directories they now exclude
+		if isIgnoreFile(filepath.Base(path)) {
+			dir := filepath.Dir(path)
+			rules.invalidate(dir)
+			if err := w.unwatchIgnored(dir, root); err != nil {
+				opts.logf("Failed to stop watching ignored directories under %s: %v\n", dir, err)
+			}
+			continue
+		}
+
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			// Deleted or renamed away
+			if w.forgetDir(path) {
+				n, err := w.removeTree(path)
+				if err != nil {
+					opts.logf("Failed to remove %s from the index: %v\n", path, err)
+				} else if n > 0 {
+					opts.logf("Removed %d files under %s from the index\n", n, path)
+				}
+				continue
+			}
+			if f, ok := lookupIndexedFile(w.backend, path); ok {
+				c.toDelete = append(c.toDelete, f.documentIDs()...)
+				c.removed++
+			}
+			continue
+		}
+		if err != nil {
+			opts.logf("Skipping %s: %v\n", path, err)
+			continue
+		}
+
+		if info.IsDir() {
+			if rules.skipDir(path, info) {
+				continue
+			}
+			// Created or renamed into place: watch it and index its contents
+			files, err := w.watchTree(path, rules)
+			if err != nil {
+				opts.logf("Failed to watch %s: %v\n", path, err)
+			}
+			c.toIndex = append(c.toIndex, files...)
+			continue
+		}
+
+		if !info.Mode().IsRegular() || rules.skipFile(path, info) {
+			continue
+		}
+		c.toIndex = append(c.toIndex, path)
+	}
+
+	for root, c := range changes {
+		opts := root.opts
+		if len(c.toIndex) > 0 {
+			if err := w.indexFiles(c.toIndex, opts); err != nil {
+				opts.logf("Failed to index changes: %v\n", err)
+			}
+		}
+
+		if len(c.toDelete) > 0 {
+			if err := deleteDocuments(w.backend, c.toDelete); err != nil {
+				opts.logf("Failed to remove deleted files: %v\n", err)
+			} else {
+				opts.logf("Removed %d files from the index\n", c.removed)
+			}
+		}
+	}
+}
+
+// watchTree adds a watch on directory and every non-ignored directory below
+// it, returning the indexable files it found along the way
+func (w *Watcher) watchTree(directory string, rules *ignoreRules) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			if path != directory && rules.skipDir(path, info) {
+				return filepath.SkipDir
+			}
+			if err := w.fs.Add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+			w.mu.Lock()
+			w.dirs[path] = true
+			w.mu.Unlock()
+			return nil
+		}
+
+		if info.Mode().IsRegular() && !rules.skipFile(path, info) {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// unwatchIgnored stops watching the directories below dir that the rules
+// of root now ignore, along with everything below them. Directories of
+// other roots nested inside stay watched.
+func (w *Watcher) unwatchIgnored(dir string, root *watchRoot) error {
+	prefix := dir + string(filepath.Separator)
+	w.mu.Lock()
+	var watched []string
+	for d := range w.dirs {
+		if strings.HasPrefix(d, prefix) && w.rootForLocked(d) == root {
+			watched = append(watched, d)
+		}
+	}
+	w.mu.Unlock()
+
+	// Parents sort first, so their subdirectories need not be looked at
+	slices.Sort(watched)
+	var ignored []string
+	for _, d := range watched {
+		if underAnyDir(d, ignored) {
+			continue
+		}
+		info, err := os.Lstat(d)
+		if err != nil {
+			continue
+		}
+		if root.rules.skipDir(d, info) {
+			ignored = append(ignored, d)
+		}
+	}
+	if len(ignored) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	for d := range w.dirs {
+		if !underAnyDir(d, ignored) || w.rootForLocked(d) != root {
+			continue
+		}
+		delete(w.dirs, d)
+		if err := w.fs.Remove(d); err != nil && !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forgetDir drops path and any directories below it from the watched set,
+// reporting whether path was a watched directory
+func (w *Watcher) forgetDir(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.dirs[path] {
+		return false
+	}
+
+	prefix := path + string(filepath.Separator)
+	for dir := range w.dirs {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			delete(w.dirs, dir)
+		}
+	}
+	return true
+}
+
+// removeTree deletes every indexed document under a directory that no
+// longer exists, returning the number of files removed
+func (w *Watcher) removeTree(directory string) (int, error) {
+	indexed, err := loadIndexedFiles(w.backend, directory)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(indexed))
+	for _, f := range indexed {
+		ids = append(ids, f.documentIDs()...)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if err := deleteDocuments(w.backend, ids); err != nil {
+		return 0, err
+	}
+	return len(indexed), nil
+}
+
+// indexFiles reads and uploads the given files
+func (w *Watcher) indexFiles(paths []string, opts Options) error {
+	documents := newDocumentBatcher(w.backend, opts)
+	var stale []string
+	for _, path := range paths {
+		doc, err := createDocumentForFile(path)
+		if err != nil {
+			opts.logf("Skipping %s: %v\n", path, err)
+			continue
+		}
+		existing, _ := lookupIndexedFile(w.backend, path)
+		opts.logf("Indexed %s\n", path)
+		if doc.ContentError != "" {
+			opts.logf("Indexing %s without content: %s\n", path, doc.ContentError)
+		}
+		stale = append(stale, addDocument(documents, doc, existing)...)
+	}
+	if err := documents.wait(); err != nil {
+		return err
+	}
+	return deleteDocuments(w.backend, stale)
+}
+
+// logf writes a message that concerns no root in particular to the log of
+// every root, once per log
+func (w *Watcher) logf(format string, args ...any) {
+	w.mu.Lock()
+	var logs []io.Writer
+	for _, root := range w.roots {
+		if root.opts.Log != nil && !slices.Contains(logs, root.opts.Log) {
+			logs = append(logs, root.opts.Log)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, log := range logs {
+		fmt.Fprintf(log, format, args...)
+	}
+}
+
+// rootFor returns the watched root containing path, or nil if path is
+// outside every root
+func (w *Watcher) rootFor(path string) *watchRoot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rootForLocked(path)
+}
+
+// rootForLocked is rootFor for callers holding w.mu
+func (w *Watcher) rootForLocked(path string) *watchRoot {
+	var (
+		best  string
+		found *watchRoot
+	)
+	for dir, root := range w.roots {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			if len(dir) > len(best) {
+				best, found = dir, root
+			}
+		}
+	}
+	return found
+}
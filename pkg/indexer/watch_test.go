@@ -0,0 +1,106 @@
+package indexer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sahil485/memex/internal/meilitest"
+	"github.com/sahil485/memex/pkg/config"
+)
+
+// newTestWatcher returns a watcher whose backend, like the one it creates on
+// each flush, is the fake server
+func newTestWatcher(t *testing.T, server *meilitest.Server) *Watcher {
+	cfg := config.Default()
+	if err := cfg.SetURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	cfg.IndexName = meilitest.Index
+	previous := config.Current()
+	config.Use(cfg)
+	t.Cleanup(func() { config.Use(previous) })
+
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+// Each root's changes are indexed with its own options
+func TestWatcherFlush(t *testing.T) {
+	server, _ := newTestIndex(t)
+	w := newTestWatcher(t, server)
+
+	dirs := []string{
+		filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")}
+	logs := []*bytes.Buffer{{}, {}}
+	for i, dir := range dirs {
+		writeFiles(t, dir, map[string]string{"file.txt": "content"})
+		opts := DefaultOptions()
+		opts.Log = logs[i]
+		if err := w.Add(dir, opts); err != nil {
+			t.Fatal(err)
+		}
+		w.pending[filepath.Join(dir, "file.txt")] = true
+	}
+	w.flush()
+
+	if got := server.Documents(); len(got) != 2 {
+		t.Errorf("stored %d documents, want 2", len(got))
+	}
+	for i, dir := range dirs {
+		log := logs[i].String()
+		other := dirs[1-i]
+		if !strings.Contains(log, "Indexed "+filepath.Join(dir, "file.txt")) || strings.Contains(log, other) {
+			t.Errorf("log of %s = %q, want only its own file", dir, log)
+		}
+	}
+}
+
+// Directories an edited ignore file now excludes stop being watched, except
+// those of another root nested inside
+func TestWatcherIgnoreFileEdit(t *testing.T) {
+	server, opts := newTestIndex(t)
+	w := newTestWatcher(t, server)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"docs/a.txt":             "alpha",
+		"drafts/out.txt":         "bravo",
+		"drafts/sub/deep.txt":    "charlie",
+		"drafts/nested/file.txt": "delta",
+	})
+	for _, dir := range []string{root, filepath.Join(root, "drafts", "nested")} {
+		if err := w.Add(dir, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ".memexignore"), []byte("drafts/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.pending[filepath.Join(root, ".memexignore")] = true
+	w.flush()
+
+	var watched []string
+	for _, dir := range w.fs.WatchList() {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		watched = append(watched, filepath.ToSlash(rel))
+	}
+	slices.Sort(watched)
+	if want := []string{".", "docs", "drafts/nested"}; !slices.Equal(watched, want) {
+		t.Errorf("watching %v, want %v", watched, want)
+	}
+	if w.dirs[filepath.Join(root, "drafts")] || w.dirs[filepath.Join(root, "drafts", "sub")] {
+		t.Error("ignored directories are still in the watched set")
+	}
+}
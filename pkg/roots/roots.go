@@ -0,0 +1,306 @@
+// Package roots keeps the registry of directories memex indexes, each with
+// the rules it is indexed by, in ~/.memex/roots.json
+package roots
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/indexer"
+)
+
+// ErrNotFound is returned for a directory that is not a registered root
+var ErrNotFound = errors.New("not a registered root")
+
+// Root is a directory kept in the index
+type Root struct {
+	Path string `json:"path"`
+
+	// Ignore lists absolute paths or base-name globs to skip, like --ignore
+	Ignore []string `json:"ignore,omitempty"`
+
+	// Extensions, if set, are the only extensions indexed in place of the
+	// configured ones; ExcludeExtensions are left out either way
+	Extensions        []string `json:"extensions,omitempty"`
+	ExcludeExtensions []string `json:"exclude_extensions,omitempty"`
+
+	// MaxDepth limits how many directory levels are indexed; zero is no limit
+	MaxDepth int `json:"max_depth,omitempty"`
+
+	// Schedule is how often the root is re-indexed; empty is only on request
+	Schedule Schedule `json:"schedule,omitempty"`
+
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Options returns base with the root's rules applied
+func (r Root) Options(base indexer.Options) indexer.Options {
+	base.IgnorePatterns = append(slices.Clone(base.IgnorePatterns), r.Ignore...)
+	if len(r.Extensions) > 0 {
+		base.Extensions = r.Extensions
+	}
+	base.ExcludeExtensions = append(slices.Clone(base.ExcludeExtensions), r.ExcludeExtensions...)
+	if r.MaxDepth > 0 {
+		base.MaxDepth = r.MaxDepth
+	}
+	return base
+}
+
+// Contains reports whether path is the root or below it
+func (r Root) Contains(path string) bool {
+	return path == r.Path || strings.HasPrefix(path, r.Path+string(filepath.Separator))
+}
+
+// Schedule is how often a root is re-indexed: hourly, daily, weekly or a
+// duration such as 30m or 6h. Empty means only on request.
+type Schedule string
+
+// minInterval is the shortest schedule accepted
+const minInterval = time.Minute
+
+var namedSchedules = map[Schedule]time.Duration{
+	"hourly": time.Hour,
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// Interval returns the time between runs, or zero for no schedule
+func (s Schedule) Interval() (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if d, ok := namedSchedules[s]; ok {
+		return d, nil
+	}
+
+	d, err := time.ParseDuration(string(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule %q: use hourly, daily, weekly or a duration such as 6h", string(s))
+	}
+	if d < minInterval {
+		return 0, fmt.Errorf("invalid schedule %q: must be at least %v", string(s), minInterval)
+	}
+	return d, nil
+}
+
+// Path returns the location of the registry
+func Path() string {
+	return filepath.Join(config.Dir(), "roots.json")
+}
+
+// List returns the registered roots, ordered by path
+func List() ([]Root, error) {
+	data, err := os.ReadFile(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []Root
+	if err := json.Unmarshal(data, &roots); err != nil {
+		return nil, fmt.Errorf("invalid roots registry %s: %w", Path(), err)
+	}
+	return roots, nil
+}
+
+// Get returns the registered root at path
+func Get(path string) (Root, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Root{}, err
+	}
+
+	roots, err := List()
+	if err != nil {
+		return Root{}, err
+	}
+	for _, r := range roots {
+		if r.Path == path {
+			return r, nil
+		}
+	}
+	return Root{}, fmt.Errorf("%s: %w", path, ErrNotFound)
+}
+
+// Nested returns the paths of the registered roots below path, whose files
+// indexing path must leave to them
+func Nested(path string) ([]string, error) {
+	roots, err := List()
+	if err != nil {
+		return nil, err
+	}
+	var nested []string
+	for _, r := range roots {
+		if r.Path != path && (Root{Path: path}).Contains(r.Path) {
+			nested = append(nested, r.Path)
+		}
+	}
+	return nested, nil
+}
+
+// Add registers root, replacing the rules of a root already registered at
+// the same path. The path must be an existing directory.
+func Add(root Root) (Root, error) {
+	root, err := normalize(root)
+	if err != nil {
+		return Root{}, err
+	}
+
+	roots, err := List()
+	if err != nil {
+		return Root{}, err
+	}
+
+	root.AddedAt = time.Now()
+	kept := roots[:0]
+	for _, r := range roots {
+		if r.Path == root.Path {
+			root.AddedAt = r.AddedAt
+			continue
+		}
+		kept = append(kept, r)
+	}
+	roots = append(kept, root)
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Path < roots[j].Path })
+
+	if err := write(roots); err != nil {
+		return Root{}, err
+	}
+	return root, nil
+}
+
+// Remove unregisters the root at path and deletes the documents of its files
+// from the index, returning how many files were removed. Files that are also
+// under another registered root stay indexed.
+func Remove(path string) (int, error) {
+	root, err := Get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	roots, err := List()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		kept  []Root
+		other []string
+	)
+	for _, r := range roots {
+		if r.Path != root.Path {
+			kept = append(kept, r)
+			other = append(other, r.Path)
+		}
+	}
+
+	// Purge first, so a failure leaves the root registered to try again
+	removed, err := indexer.RemoveDirectory(root.Path, other)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove %s from the index: %w", root.Path, err)
+	}
+	if err := indexer.ForgetRun(root.Path); err != nil {
+		return removed, err
+	}
+	return removed, write(kept)
+}
+
+// Due returns the roots whose schedule calls for a run at now, given when
+// each root was last indexed. A scheduled root that was never indexed is due.
+func Due(now time.Time) ([]Root, error) {
+	roots, err := List()
+	if err != nil {
+		return nil, err
+	}
+	runs, err := indexer.ReadRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	last := make(map[string]time.Time, len(runs))
+	for _, run := range runs {
+		last[run.Root] = run.FinishedAt
+	}
+
+	var due []Root
+	for _, r := range roots {
+		interval, err := r.Schedule.Interval()
+		if err != nil || interval == 0 {
+			continue
+		}
+		if finished, ok := last[r.Path]; !ok || !now.Before(finished.Add(interval)) {
+			due = append(due, r)
+		}
+	}
+	return due, nil
+}
+
+// normalize makes the path absolute, the extensions lower case with a
+// leading dot and checks the rest
+func normalize(root Root) (Root, error) {
+	path, err := filepath.Abs(root.Path)
+	if err != nil {
+		return root, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return root, err
+	}
+	if !info.IsDir() {
+		return root, fmt.Errorf("%s is not a directory", path)
+	}
+	root.Path = path
+
+	if root.MaxDepth < 0 {
+		return root, fmt.Errorf("max depth must not be negative, got %d", root.MaxDepth)
+	}
+	if _, err := root.Schedule.Interval(); err != nil {
+		return root, err
+	}
+
+	root.Ignore = trimmed(root.Ignore, strings.TrimSpace)
+	root.Extensions = trimmed(root.Extensions, indexer.NormalizeExtension)
+	root.ExcludeExtensions = trimmed(root.ExcludeExtensions, indexer.NormalizeExtension)
+	return root, nil
+}
+
+// trimmed applies clean to each value, dropping empty results and
+// duplicates. It returns nil rather than an empty list.
+func trimmed(values []string, clean func(string) string) []string {
+	var out []string
+	for _, v := range values {
+		if v = clean(v); v != "" && !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func write(roots []Root) error {
+	if err := os.MkdirAll(config.Dir(), 0o755); err != nil {
+		return err
+	}
+	if roots == nil {
+		roots = []Root{}
+	}
+	data, err := json.MarshalIndent(roots, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so readers never see a partial file
+	tmp := Path() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, Path())
+}
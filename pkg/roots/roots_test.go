@@ -0,0 +1,317 @@
+package roots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sahil485/memex/internal/meilitest"
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/indexer"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// mkdirs creates directories below a temporary home directory, which also
+// holds the registry, and returns their paths
+func mkdirs(t *testing.T, names ...string) []string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(home, filepath.FromSlash(name))
+		if err := os.MkdirAll(paths[i], 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestAdd(t *testing.T) {
+	dirs := mkdirs(t, "notes", "docs")
+	notes, docs := dirs[0], dirs[1]
+
+	added, err := Add(Root{
+		Path:              notes + "/.",
+		Ignore:            []string{" drafts ", "", "drafts"},
+		Extensions:        []string{"MD", ".txt", "md"},
+		ExcludeExtensions: []string{"log"},
+		MaxDepth:          2,
+		Schedule:          "daily",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Path != notes || !slices.Equal(added.Ignore, []string{"drafts"}) ||
+		!slices.Equal(added.Extensions, []string{".md", ".txt"}) || !slices.Equal(added.ExcludeExtensions, []string{".log"}) {
+		t.Errorf("Add stored %+v", added)
+	}
+	if _, err := Add(Root{Path: docs}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding again replaces the rules but keeps when the root was added
+	replaced, err := Add(Root{Path: notes, Schedule: "6h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replaced.AddedAt.Equal(added.AddedAt) || replaced.Extensions != nil || replaced.Schedule != "6h" {
+		t.Errorf("re-adding stored %+v", replaced)
+	}
+
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range list {
+		paths = append(paths, r.Path)
+	}
+	if want := []string{docs, notes}; !slices.Equal(paths, want) {
+		t.Errorf("List = %v, want %v", paths, want)
+	}
+
+	if _, err := Get(filepath.Join(notes, "missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an unregistered directory = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	dir := mkdirs(t, "dir")[0]
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		root Root
+	}{
+		{"missing directory", Root{Path: filepath.Join(dir, "missing")}},
+		{"file", Root{Path: file}},
+		{"negative depth", Root{Path: dir, MaxDepth: -1}},
+		{"invalid schedule", Root{Path: dir, Schedule: "sometimes"}},
+		{"schedule too short", Root{Path: dir, Schedule: "10s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Add(tt.root); err == nil {
+				t.Error("Add succeeded")
+			}
+		})
+	}
+
+	if list, _ := List(); len(list) != 0 {
+		t.Errorf("failed adds registered %v", list)
+	}
+}
+
+func TestScheduleInterval(t *testing.T) {
+	tests := []struct {
+		schedule Schedule
+		want     time.Duration
+	}{
+		{"", 0},
+		{"hourly", time.Hour},
+		{"daily", 24 * time.Hour},
+		{"weekly", 7 * 24 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got, err := tt.schedule.Interval(); err != nil || got != tt.want {
+			t.Errorf("%q.Interval() = %v, %v, want %v", tt.schedule, got, err, tt.want)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	root := Root{Ignore: []string{"*.tmp"}, Extensions: []string{".md"}, ExcludeExtensions: []string{".log"}, MaxDepth: 3}
+	base := indexer.Options{IgnorePatterns: []string{"drafts"}, Workers: 2}
+
+	opts := root.Options(base)
+	if !slices.Equal(opts.IgnorePatterns, []string{"drafts", "*.tmp"}) || !slices.Equal(opts.Extensions, []string{".md"}) ||
+		!slices.Equal(opts.ExcludeExtensions, []string{".log"}) || opts.MaxDepth != 3 || opts.Workers != 2 {
+		t.Errorf("Options = %+v", opts)
+	}
+	if len(base.IgnorePatterns) != 1 {
+		t.Errorf("Options changed the base patterns to %v", base.IgnorePatterns)
+	}
+}
+
+func TestDue(t *testing.T) {
+	dirs := mkdirs(t, "hourly", "daily", "never-run", "manual")
+	schedules := []Schedule{"hourly", "daily", "hourly", ""}
+	for i, dir := range dirs {
+		if _, err := Add(Root{Path: dir, Schedule: schedules[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	runs := []indexer.Run{
+		{Root: dirs[0], FinishedAt: now.Add(-2 * time.Hour)},
+		{Root: dirs[1], FinishedAt: now.Add(-2 * time.Hour)},
+		{Root: dirs[3], FinishedAt: now.Add(-48 * time.Hour)},
+	}
+	data, err := json.Marshal(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(indexer.RunsPath(), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := Due(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range due {
+		paths = append(paths, r.Path)
+	}
+	if want := []string{dirs[0], dirs[2]}; !slices.Equal(paths, want) {
+		t.Errorf("Due = %v, want %v", paths, want)
+	}
+}
+
+// useFake points the configured backend at a fake Meilisearch
+func useFake(t *testing.T) *meilitest.Server {
+	t.Helper()
+	server := meilitest.NewServer(t)
+	cfg := config.Default()
+	if err := cfg.SetURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	cfg.IndexName = meilitest.Index
+	previous := config.Current()
+	config.Use(cfg)
+	t.Cleanup(func() { config.Use(previous) })
+	if err := server.Client().Init(); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// index indexes a root with its rules, leaving its nested roots alone
+func index(t *testing.T, root Root) {
+	t.Helper()
+	opts := root.Options(indexer.DefaultOptions())
+	opts.Log = nil
+	nested, err := Nested(root.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Keep = nested
+	if _, err := indexer.IndexDirectory(context.Background(), root.Path, opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// indexedPaths returns the paths of the documents in the fake, sorted
+func indexedPaths(t *testing.T, server *meilitest.Server) []string {
+	t.Helper()
+	var paths []string
+	for _, hit := range server.Documents() {
+		var doc types.Document
+		if err := hit.DecodeInto(&doc); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, doc.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestRemove(t *testing.T) {
+	dirs := mkdirs(t, "docs/notes", "other")
+	docs, notes := filepath.Dir(dirs[0]), dirs[0]
+	for _, path := range []string{
+		filepath.Join(docs, "a.txt"),
+		filepath.Join(notes, "b.txt"),
+		filepath.Join(dirs[1], "c.txt"),
+	} {
+		if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := useFake(t)
+	for _, dir := range []string{docs, notes, dirs[1]} {
+		root, err := Add(Root{Path: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		index(t, root)
+	}
+	indexed := func() []string { return indexedPaths(t, server) }
+
+	// Files of the nested root stay indexed
+	removed, err := Remove(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(notes, "b.txt"), filepath.Join(dirs[1], "c.txt")}
+	if got := indexed(); removed != 1 || !slices.Equal(got, want) {
+		t.Errorf("removed %d files, leaving %v, want 1 leaving %v", removed, got, want)
+	}
+
+	if _, err := Get(docs); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removed root is still registered: %v", err)
+	}
+	runs, err := indexer.ReadRuns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range runs {
+		if run.Root == docs {
+			t.Error("removed root still has a recorded run")
+		}
+	}
+
+	if _, err := Remove(docs); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removing twice = %v, want ErrNotFound", err)
+	}
+}
+
+// Re-indexing a root leaves the files of a root nested in it that its own
+// rules don't reach
+func TestNested(t *testing.T) {
+	dirs := mkdirs(t, "data/s/deep")
+	data, s := filepath.Dir(filepath.Dir(dirs[0])), filepath.Dir(dirs[0])
+	top, below := filepath.Join(data, "a.txt"), filepath.Join(dirs[0], "b.txt")
+	for _, path := range []string{top, below} {
+		if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := useFake(t)
+	outer, err := Add(Root{Path: data, MaxDepth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := Add(Root{Path: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nested, err := Nested(data); err != nil || !slices.Equal(nested, []string{s}) {
+		t.Errorf("Nested(%s) = %v, %v, want [%s]", data, nested, err, s)
+	}
+	if nested, err := Nested(s); err != nil || len(nested) != 0 {
+		t.Errorf("Nested(%s) = %v, %v, want none", s, nested, err)
+	}
+
+	index(t, outer)
+	index(t, inner)
+	index(t, outer)
+	if got, want := indexedPaths(t, server), []string{top, below}; !slices.Equal(got, want) {
+		t.Errorf("indexed %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package search
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// filesOnly matches whole files, leaving out the passages of large files
+const filesOnly = "NOT parent_id EXISTS"
+
+// IndexCounts counts the indexed files by extension and under each requested
+// root. Counts come from facets, since hit totals stop at maxTotalHits.
+type IndexCounts struct {
+	Extensions []FacetValue `json:"extensions"`
+	Roots      []FacetValue `json:"roots"`
+}
+
+// Count counts the indexed files by extension and under each of roots
+func Count(roots []string) (*IndexCounts, error) {
+	requests := []*types.SearchRequest{{
+		Filter:               filesOnly,
+		Facets:               []string{"ext"},
+		Limit:                1,
+		AttributesToRetrieve: []string{"id"},
+	}}
+	// Every file under a root lists the root in dirs, so the root's count is
+	// the highest in that facet and always among the values returned
+	cleaned := make([]string, len(roots))
+	for i, root := range roots {
+		cleaned[i] = filepath.Clean(root)
+		requests = append(requests, &types.SearchRequest{
+			Filter:               fmt.Sprintf("%s AND dirs = %s", filesOnly, types.FilterValue(cleaned[i])),
+			Facets:               []string{"dirs"},
+			Limit:                1,
+			AttributesToRetrieve: []string{"id"},
+		})
+	}
+
+	responses, err := backend.New().MultiSearch(requests...)
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) != len(requests) {
+		return nil, fmt.Errorf("expected %d search results, got %d", len(requests), len(responses))
+	}
+
+	counts := &IndexCounts{
+		Extensions: sortedValues(responses[0].FacetDistribution["ext"]),
+		Roots:      make([]FacetValue, len(roots)),
+	}
+	for i, root := range roots {
+		counts.Roots[i] = FacetValue{Value: root, Count: responses[i+1].FacetDistribution["dirs"][cleaned[i]]}
+	}
+	return counts, nil
+}
@@ -0,0 +1,222 @@
+package search
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// maxFacetValues is how many values of each facet are reported
+const maxFacetValues = 10
+
+// FacetValue is a value of a facet and how many matching files have it. A
+// large file counts once however many of its passages match. Label is set
+// where the value is a key rather than readable text.
+type FacetValue struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// Facets summarises where the matches of a query are: their extensions, the
+// directories they are spread over and how recently they were modified.
+// They count the files of Response.TotalFiles, so unless the total is exact
+// the counts are lower bounds.
+type Facets struct {
+	Extensions []FacetValue `json:"extensions"`
+
+	// Directories are the subdirectories of the deepest directory that
+	// holds every match, so they show how the matches are split
+	Directories []FacetValue `json:"directories"`
+
+	// Modified counts matches in each of the ModifiedBuckets, in order
+	Modified []FacetValue `json:"modified"`
+}
+
+// FacetSelection narrows a search to chosen facet values. Values of one
+// facet are ORed and different facets are ANDed.
+type FacetSelection struct {
+	Extensions  []string `json:"extensions,omitempty"`
+	Directories []string `json:"directories,omitempty"`
+	Modified    []string `json:"modified,omitempty"`
+}
+
+// ModifiedBucket is a range of file ages used to facet modification times
+type ModifiedBucket struct {
+	Key   string
+	Label string
+
+	// MaxAge is the bucket's upper bound; the bucket starts where the
+	// previous one ends. Zero means no bound.
+	MaxAge time.Duration
+}
+
+// ModifiedBuckets are the modification time facets, newest first
+var ModifiedBuckets = []ModifiedBucket{
+	{Key: "today", Label: "today", MaxAge: 24 * time.Hour},
+	{Key: "week", Label: "past week", MaxAge: 7 * 24 * time.Hour},
+	{Key: "month", Label: "past month", MaxAge: 30 * 24 * time.Hour},
+	{Key: "year", Label: "past year", MaxAge: 365 * 24 * time.Hour},
+	{Key: "older", Label: "older"},
+}
+
+// modifiedFilterFor returns the filter matching the bucket with key
+func modifiedFilterFor(key string, now time.Time) (string, error) {
+	var newer time.Duration
+	for _, b := range ModifiedBuckets {
+		if b.Key != key {
+			newer = b.MaxAge
+			continue
+		}
+
+		var clauses []string
+		if b.MaxAge > 0 {
+			clauses = append(clauses, fmt.Sprintf("mod_time > %d", now.Add(-b.MaxAge).Unix()))
+		}
+		if newer > 0 {
+			clauses = append(clauses, fmt.Sprintf("mod_time <= %d", now.Add(-newer).Unix()))
+		}
+		return strings.Join(clauses, " AND "), nil
+	}
+	return "", fmt.Errorf("unknown modified facet %q", key)
+}
+
+// filter returns the filter expression for the selection
+func (s FacetSelection) filter(now time.Time) (string, error) {
+	var clauses []string
+
+	if len(s.Extensions) > 0 {
+		f, err := extFilter(strings.Join(s.Extensions, ","), now)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, f)
+	}
+
+	if len(s.Directories) > 0 {
+		dirs := make([]string, len(s.Directories))
+		for i, d := range s.Directories {
+			dirs[i] = types.FilterValue(filepath.Clean(d))
+		}
+		clauses = append(clauses, "dirs IN ["+strings.Join(dirs, ", ")+"]")
+	}
+
+	if len(s.Modified) > 0 {
+		var ranges []string
+		for _, key := range s.Modified {
+			f, err := modifiedFilterFor(key, now)
+			if err != nil {
+				return "", err
+			}
+			ranges = append(ranges, "("+f+")")
+		}
+		clauses = append(clauses, "("+strings.Join(ranges, " OR ")+")")
+	}
+
+	return strings.Join(clauses, " AND "), nil
+}
+
+// newFacets counts the values of the matching files, one document each
+func newFacets(files []types.Document, now time.Time) *Facets {
+	var (
+		extensions  = make(map[string]int64)
+		directories = make(map[string]int64)
+		modified    = make([]int64, len(ModifiedBuckets))
+	)
+	for _, f := range files {
+		extensions[f.Ext]++
+		for _, dir := range f.Dirs {
+			directories[dir]++
+		}
+		modified[modifiedBucket(f.ModTime, now)]++
+	}
+
+	facets := &Facets{
+		Extensions:  topValues(extensions),
+		Directories: topDirectories(directories),
+		Modified:    make([]FacetValue, len(ModifiedBuckets)),
+	}
+	for i, b := range ModifiedBuckets {
+		facets.Modified[i] = FacetValue{Value: b.Key, Label: b.Label, Count: modified[i]}
+	}
+	return facets
+}
+
+// modifiedBucket returns the index of the bucket holding a modification
+// time, as modifiedFilterFor selects them
+func modifiedBucket(modTime int64, now time.Time) int {
+	for i, b := range ModifiedBuckets {
+		if b.MaxAge == 0 || modTime > now.Add(-b.MaxAge).Unix() {
+			return i
+		}
+	}
+	return len(ModifiedBuckets) - 1
+}
+
+// topValues returns the most common values, most common first
+func topValues(counts map[string]int64) []FacetValue {
+	values := sortedValues(counts)
+	if len(values) > maxFacetValues {
+		values = values[:maxFacetValues]
+	}
+	return values
+}
+
+// sortedValues returns the values with matches, most common first
+func sortedValues(counts map[string]int64) []FacetValue {
+	values := make([]FacetValue, 0, len(counts))
+	for v, n := range counts {
+		if v != "" && n > 0 {
+			values = append(values, FacetValue{Value: v, Count: n})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	return values
+}
+
+// topDirectories finds the deepest directory containing every match and
+// returns its subdirectories that hold matches
+func topDirectories(counts map[string]int64) []FacetValue {
+	var (
+		common string
+		total  int64
+	)
+	for dir, n := range counts {
+		if n > total || (n == total && len(dir) > len(common)) {
+			common, total = dir, n
+		}
+	}
+
+	children := make(map[string]int64)
+	for dir, n := range counts {
+		if dir != common && filepath.Dir(dir) == common {
+			children[dir] = n
+		}
+	}
+	return topValues(children)
+}
+
+// Directories returns every indexed directory that holds files, the most
+// files first. Only the most common MaxValuesPerFacet directories are known.
+func Directories() ([]FacetValue, error) {
+	response, err := backend.New().Search(&types.SearchRequest{
+		Filter:               filesOnly,
+		Limit:                1,
+		AttributesToRetrieve: []string{"id"},
+		Facets:               []string{"dirs"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortedValues(response.FacetDistribution["dirs"]), nil
+}
@@ -0,0 +1,37 @@
+package search
+
+import (
+	"encoding/json"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// matchedContent returns the byte offset of the first match in the hit's
+// content, if the query matched its content at all
+func matchedContent(hit types.Hit) (int, bool) {
+	raw, ok := hit["_matchesPosition"]
+	if !ok {
+		return 0, false
+	}
+	var positions map[string][]struct {
+		Start int `json:"start"`
+	}
+	if err := json.Unmarshal(raw, &positions); err != nil || len(positions["content"]) == 0 {
+		return 0, false
+	}
+	return positions["content"][0].Start, true
+}
+
+// MatchedPage returns the page of the first match in the hit's content, or 0
+// if the document has no pages or the match was not in its content
+func MatchedPage(hit types.Hit, doc *types.Document) int {
+	if len(doc.PageOffsets) == 0 && doc.PageBase == 0 {
+		return 0
+	}
+
+	start, ok := matchedContent(hit)
+	if !ok {
+		return 0
+	}
+	return doc.PageAt(start)
+}
@@ -0,0 +1,286 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// Query is a search split into the free text sent to Meilisearch and a
+// filter expression built from its field operators:
+//
+//	ext:pdf,md          files with one of the extensions
+//	in:~/Documents      files anywhere under a directory
+//	path:~/notes/a.md   a file, or files under a directory
+//	modified:<30d       modified within the last 30 days (h, d, w, mo, y);
+//	                    >30d is older, and dates such as >2024-01-31 work too
+//	size:>1MB           larger than 1 MB (B, KB, MB, GB, TB)
+//
+// Operators on the same field are ORed and different fields are ANDed. A
+// leading - excludes what an operator matches. Other words, including -word exclusions
+// and "quoted phrases", are left to Meilisearch.
+type Query struct {
+	Text   string
+	Filter string
+}
+
+// QueryError reports a term of a query that could not be parsed
+type QueryError struct {
+	Term   string
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query term %q: %s", e.Term, e.Reason)
+}
+
+// queryFields maps each operator to the function building its filter
+var queryFields = map[string]func(value string, now time.Time) (string, error){
+	"ext":      extFilter,
+	"in":       inFilter,
+	"path":     pathFilter,
+	"modified": modifiedFilter,
+	"size":     sizeFilter,
+}
+
+// queryFieldOrder is the order in which filters on different fields are
+// joined, so equivalent queries produce the same filter
+var queryFieldOrder = []string{"ext", "in", "path", "modified", "size"}
+
+// ParseQuery splits a query into free text and a filter
+func ParseQuery(input string) (*Query, error) {
+	return parseQuery(input, time.Now())
+}
+
+func parseQuery(input string, now time.Time) (*Query, error) {
+	var text, excluded []string
+	filters := make(map[string][]string)
+
+	for _, term := range splitTerms(input) {
+		negated := strings.HasPrefix(term, "-")
+		key, value, ok := strings.Cut(strings.TrimPrefix(term, "-"), ":")
+		build, known := queryFields[strings.ToLower(key)]
+		if !ok || !known {
+			text = append(text, term)
+			continue
+		}
+
+		value = unquote(value)
+		if value == "" {
+			return nil, &QueryError{Term: term, Reason: "missing value after " + key + ":"}
+		}
+		filter, err := build(value, now)
+		if err != nil {
+			return nil, &QueryError{Term: term, Reason: err.Error()}
+		}
+		if negated {
+			excluded = append(excluded, "NOT ("+filter+")")
+			continue
+		}
+		key = strings.ToLower(key)
+		filters[key] = append(filters[key], filter)
+	}
+
+	var clauses []string
+	for _, key := range queryFieldOrder {
+		switch f := filters[key]; len(f) {
+		case 0:
+		case 1:
+			clauses = append(clauses, f[0])
+		default:
+			clauses = append(clauses, "("+strings.Join(f, " OR ")+")")
+		}
+	}
+	clauses = append(clauses, excluded...)
+
+	return &Query{
+		Text:   strings.Join(text, " "),
+		Filter: strings.Join(clauses, " AND "),
+	}, nil
+}
+
+// splitTerms splits a query on whitespace, keeping double-quoted phrases,
+// including quoted operator values such as in:"~/My Documents", together
+func splitTerms(input string) []string {
+	var (
+		terms   []string
+		current strings.Builder
+		quoted  bool
+	)
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+	return terms
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+func extFilter(value string, _ time.Time) (string, error) {
+	var exts []string
+	for _, ext := range strings.Split(value, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext == "" || strings.ContainsAny(ext, `/\.`) {
+			return "", fmt.Errorf("%q is not a file extension", value)
+		}
+		exts = append(exts, types.FilterValue("."+ext))
+	}
+	if len(exts) == 1 {
+		return "ext = " + exts[0], nil
+	}
+	return "ext IN [" + strings.Join(exts, ", ") + "]", nil
+}
+
+func inFilter(value string, _ time.Time) (string, error) {
+	dir, err := queryPath(value)
+	if err != nil {
+		return "", err
+	}
+	return "dirs = " + types.FilterValue(dir), nil
+}
+
+func pathFilter(value string, _ time.Time) (string, error) {
+	path, err := queryPath(value)
+	if err != nil {
+		return "", err
+	}
+	return "(path = " + types.FilterValue(path) + " OR dirs = " + types.FilterValue(path) + ")", nil
+}
+
+// queryPath expands a leading ~ and makes a path absolute, since documents
+// are stored by absolute path
+func queryPath(value string) (string, error) {
+	if value == "~" || strings.HasPrefix(value, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		value = filepath.Join(home, value[1:])
+	}
+	return filepath.Abs(value)
+}
+
+// splitComparison separates a leading <, <=, > or >= from value. With no
+// operator the result is "".
+func splitComparison(value string) (string, string) {
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(value, op) {
+			return op, strings.TrimSpace(value[len(op):])
+		}
+	}
+	return "", value
+}
+
+// ageUnits are the units accepted in modified: ages
+var ageUnits = map[string]time.Duration{
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"mo": 30 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+func modifiedFilter(value string, now time.Time) (string, error) {
+	op, value := splitComparison(value)
+
+	if date, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		start, end := date.Unix(), date.AddDate(0, 0, 1).Unix()
+		switch op {
+		case "":
+			return fmt.Sprintf("mod_time %d TO %d", start, end-1), nil
+		case "<":
+			return fmt.Sprintf("mod_time < %d", start), nil
+		case "<=":
+			return fmt.Sprintf("mod_time < %d", end), nil
+		case ">":
+			return fmt.Sprintf("mod_time >= %d", end), nil
+		default:
+			return fmt.Sprintf("mod_time >= %d", start), nil
+		}
+	}
+
+	i := strings.IndexFunc(value, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i <= 0 {
+		return "", fmt.Errorf("expected an age such as <30d or a date such as >2024-01-31")
+	}
+	n, err := strconv.Atoi(value[:i])
+	if err != nil {
+		return "", fmt.Errorf("age %q is out of range", value[:i])
+	}
+	unit, ok := ageUnits[strings.ToLower(value[i:])]
+	if !ok {
+		return "", fmt.Errorf("unknown age unit %q, use h, d, w, mo or y", value[i:])
+	}
+	cutoff := now.Add(-time.Duration(n) * unit).Unix()
+
+	// An age compares the other way round to a timestamp: <30d is newer
+	switch op {
+	case "", "<":
+		return fmt.Sprintf("mod_time > %d", cutoff), nil
+	case "<=":
+		return fmt.Sprintf("mod_time >= %d", cutoff), nil
+	case ">":
+		return fmt.Sprintf("mod_time < %d", cutoff), nil
+	default:
+		return fmt.Sprintf("mod_time <= %d", cutoff), nil
+	}
+}
+
+// sizeUnits are the units accepted in size: values, in bytes
+var sizeUnits = map[string]float64{
+	"":   1,
+	"b":  1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+	"t":  1 << 40,
+	"tb": 1 << 40,
+}
+
+func sizeFilter(value string, _ time.Time) (string, error) {
+	op, value := splitComparison(value)
+	if op == "" {
+		return "", fmt.Errorf("expected a comparison such as >1MB or <=200KB")
+	}
+
+	i := strings.IndexFunc(value, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+	if i < 0 {
+		i = len(value)
+	}
+	n, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil || i == 0 {
+		return "", fmt.Errorf("expected a size such as 1MB")
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(value[i:]))]
+	if !ok {
+		return "", fmt.Errorf("unknown size unit %q, use B, KB, MB, GB or TB", value[i:])
+	}
+	return fmt.Sprintf("size %s %d", op, int64(n*unit)), nil
+}
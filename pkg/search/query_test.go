@@ -0,0 +1,76 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) int64 { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() }
+	ago := func(d time.Duration) int64 { return now.Add(-d).Unix() }
+
+	tests := []struct {
+		input  string
+		text   string
+		filter string
+	}{
+		{"meeting notes", "meeting notes", ""},
+		{`-draft "exact phrase" word`, `-draft "exact phrase" word`, ""},
+		{"ext:pdf", "", `ext = ".pdf"`},
+		{"report ext:.PDF,md", "report", `ext IN [".pdf", ".md"]`},
+		{"ext:pdf ext:md", "", `(ext = ".pdf" OR ext = ".md")`},
+		{"in:/data/notes", "", `dirs = "/data/notes"`},
+		{`in:"/data/My Notes"`, "", `dirs = "/data/My Notes"`},
+		{"path:/data/a.md", "", `(path = "/data/a.md" OR dirs = "/data/a.md")`},
+		{"modified:<30d", "", fmt.Sprintf("mod_time > %d", ago(30*24*time.Hour))},
+		{"modified:>=2w", "", fmt.Sprintf("mod_time <= %d", ago(14*24*time.Hour))},
+		{"modified:2024-01-31", "", fmt.Sprintf("mod_time %d TO %d", day(2024, 1, 31), day(2024, 2, 1)-1)},
+		{"modified:>2024-01-31", "", fmt.Sprintf("mod_time >= %d", day(2024, 2, 1))},
+		{"size:>1MB", "", "size > 1048576"},
+		{"size:<=1.5kb", "", "size <= 1536"},
+		{"-ext:log", "", `NOT (ext = ".log")`},
+		{
+			"budget size:>1KB ext:xlsx -in:/tmp in:/data",
+			"budget",
+			`ext = ".xlsx" AND dirs = "/data" AND size > 1024 AND NOT (dirs = "/tmp")`,
+		},
+		{"unknown:operator", "unknown:operator", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q, err := parseQuery(tt.input, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Text != tt.text || q.Filter != tt.filter {
+				t.Errorf("parseQuery(%q) = %q, %q, want %q, %q", tt.input, q.Text, q.Filter, tt.text, tt.filter)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []string{
+		"ext:",
+		"ext:a/b",
+		"size:1MB",
+		"size:>lots",
+		"size:>1PB",
+		"modified:30",
+		"modified:<5x",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			_, err := parseQuery(input, time.Now())
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("parseQuery(%q) error = %v, want a *QueryError", input, err)
+			}
+		})
+	}
+}
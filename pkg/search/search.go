@@ -1,14 +1,386 @@
 package search
 
 import (
-	meilisearch "github.com/meilisearch/meilisearch-go"
-	"github.com/sahil485/memex/pkg/client"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+const (
+	// maxPassages is how many matching passages are kept per file
+	maxPassages = 3
+
+	// hitsPerFile is how many hits are requested for each file wanted, since
+	// several passages of one large file may rank next to each other
+	hitsPerFile = 5
+
+	// maxHits is the most hits a backend returns for a query by default,
+	// which bounds how far results can be paged
+	maxHits = 1000
+
+	// cropMarker marks where a snippet was cut from the surrounding text
+	cropMarker = "…"
+)
+
+// SearchOptions controls how a query is run and how its snippets are
+// formatted. Zero fields take their value from the configuration.
+type SearchOptions struct {
+	// Limit is the number of files per page. Offset skips that many files;
+	// alternatively Page selects a 1-based page of Limit files.
+	Limit  int64
+	Offset int64
+	Page   int64
+
+	// Sort orders results by a field instead of relevance
+	Sort Sort
+
+	// Facets requests facet counts with the results, and Selection narrows
+	// the results to chosen facet values
+	Facets    bool
+	Selection FacetSelection
+
+	// Totals requests a count of the matching files. Counts and facets are
+	// only taken for the first page, as they would repeat on later ones.
+	Totals bool
+
+	// CropLength is the number of words kept around the best match
+	CropLength int
+
+	// HighlightPreTag and HighlightPostTag are placed around matched words
+	// in snippets. When both are empty, matches are not marked.
+	HighlightPreTag  string
+	HighlightPostTag string
+
+	// Backend runs the query; nil uses the configured backend
+	Backend backend.SearchBackend
+}
+
+// DefaultSearchOptions returns the configured snippet settings
+func DefaultSearchOptions() SearchOptions {
+	cfg := config.Current()
+	return SearchOptions{
+		Limit:            10,
+		CropLength:       cfg.CropLength,
+		HighlightPreTag:  cfg.HighlightPreTag,
+		HighlightPostTag: cfg.HighlightPostTag,
+	}
+}
+
+// SortKey is a field results can be ordered by
+type SortKey string
+
+const (
+	SortRelevance SortKey = "relevance"
+	SortModified  SortKey = "mtime"
+	SortSize      SortKey = "size"
+	SortName      SortKey = "name"
 )
 
-func Search(query string, limit int64) (*meilisearch.SearchResponse, error) {
-	c := client.New()
-	return c.GetIndex().Search(query, &meilisearch.SearchRequest{
-		Limit:            limit,
-		ShowRankingScore: true,
-	})
+// sortAttributes maps sort keys to the sortable index attributes
+var sortAttributes = map[SortKey]string{
+	SortModified: "mod_time",
+	SortSize:     "size",
+	SortName:     "name",
+}
+
+// Sort is a sort key and direction. The zero value sorts by relevance.
+type Sort struct {
+	Key        SortKey
+	Descending bool
+}
+
+// ParseSort parses "key" or "key:asc|desc", e.g. "mtime:desc". Without a
+// direction, names sort ascending and times and sizes descending.
+func ParseSort(s string) (Sort, error) {
+	key, dir, hasDir := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+
+	sort := Sort{Key: SortKey(key)}
+	if _, ok := sortAttributes[sort.Key]; !ok && sort.Key != "" && sort.Key != SortRelevance {
+		return Sort{}, fmt.Errorf("unknown sort key %q, use relevance, mtime, size or name", key)
+	}
+	if sort.Key == "" || sort.Key == SortRelevance {
+		return Sort{}, nil
+	}
+
+	switch {
+	case !hasDir:
+		sort.Descending = sort.Key != SortName
+	case dir == "asc":
+	case dir == "desc":
+		sort.Descending = true
+	default:
+		return Sort{}, fmt.Errorf("unknown sort direction %q, use asc or desc", dir)
+	}
+	return sort, nil
+}
+
+// String formats the sort as accepted by ParseSort
+func (s Sort) String() string {
+	if s.Key == "" || s.Key == SortRelevance {
+		return string(SortRelevance)
+	}
+	if s.Descending {
+		return string(s.Key) + ":desc"
+	}
+	return string(s.Key) + ":asc"
+}
+
+// Passage locates a matching part of a large file
+type Passage struct {
+	StartLine int
+	EndLine   int
+	Page      int
+	Snippet   string
+}
+
+// Result is one file matching a query. Hits on passages of a large file are
+// folded into a single result listing the best passages. Snippet is the
+// cropped content around the best match; the full content is not fetched.
+type Result struct {
+	Document     types.Document
+	RankingScore float64
+	Page         int
+	Snippet      string
+	Passages     []Passage
+}
+
+// Response holds one page of the files matching a query, best first.
+// HasMore reports whether another page follows.
+type Response struct {
+	Query   string
+	Results []Result
+	Offset  int64
+	Limit   int64
+	HasMore bool
+	Facets  *Facets
+
+	// TotalFiles counts the matching files, with the passages of a large
+	// file folded into it, when Counted. Like the facets, it is taken from
+	// the first maxHits matching documents only, so unless TotalExact more
+	// files may match.
+	TotalFiles int64
+	TotalExact bool
+	Counted    bool
+
+	// EstimatedTotalHits counts the matching documents, each passage of a
+	// large file separately
+	EstimatedTotalHits int64
+	ProcessingTimeMs   int64
+}
+
+// Search runs a query written in the syntax described by Query. A query that
+// cannot be parsed returns a *QueryError.
+func Search(query string, opts SearchOptions) (*Response, error) {
+	now := time.Now()
+	q, err := parseQuery(query, now)
+	if err != nil {
+		return nil, err
+	}
+	selection, err := opts.Selection.filter(now)
+	if err != nil {
+		return nil, err
+	}
+	filter := q.Filter
+	if filter != "" && selection != "" {
+		filter = "(" + filter + ") AND (" + selection + ")"
+	} else if selection != "" {
+		filter = selection
+	}
+
+	defaults := DefaultSearchOptions()
+	if opts.Limit <= 0 {
+		opts.Limit = defaults.Limit
+	}
+	if opts.CropLength <= 0 {
+		opts.CropLength = defaults.CropLength
+	}
+	if opts.Page > 0 {
+		opts.Offset = (opts.Page - 1) * opts.Limit
+	}
+	opts.Offset = max(opts.Offset, 0)
+
+	// Passages make hits and files differ, so each request fetches every file
+	// up to the end of the page and drops those before it
+	request := &types.SearchRequest{
+		Query:                q.Text,
+		Filter:               filter,
+		Limit:                min((opts.Offset+opts.Limit)*hitsPerFile, maxHits),
+		AttributesToRetrieve: types.RetrievedAttributes,
+		AttributesToCrop:     []string{"content"},
+		CropLength:           int64(opts.CropLength),
+		CropMarker:           cropMarker,
+		ShowRankingScore:     true,
+		ShowMatchesPosition:  true,
+	}
+	if attribute, ok := sortAttributes[opts.Sort.Key]; ok {
+		direction := ":asc"
+		if opts.Sort.Descending {
+			direction = ":desc"
+		}
+		request.Sort = []string{attribute + direction}
+	}
+	if opts.HighlightPreTag != "" || opts.HighlightPostTag != "" {
+		request.AttributesToHighlight = []string{"content"}
+		request.HighlightPreTag = opts.HighlightPreTag
+		request.HighlightPostTag = opts.HighlightPostTag
+	}
+
+	b := opts.Backend
+	if b == nil {
+		b = backend.New()
+	}
+	// On the first page the matching files are counted, and their facets
+	// taken, from a second search
+	count := opts.Offset == 0 && (opts.Facets || opts.Totals)
+	requests := []*types.SearchRequest{request}
+	if count {
+		requests = append(requests, filesRequest(request, opts.Facets))
+	}
+	multi, err := b.MultiSearch(requests...)
+	if err != nil {
+		return nil, err
+	}
+	if len(multi) != len(requests) {
+		return nil, fmt.Errorf("expected %d search results, got %d", len(requests), len(multi))
+	}
+	result := &multi[0]
+
+	response, err := groupHits(result, int(opts.Offset+opts.Limit))
+	if err != nil {
+		return nil, err
+	}
+	if count {
+		files, exact, err := matchedFiles(&multi[1])
+		if err != nil {
+			return nil, err
+		}
+		response.TotalFiles, response.TotalExact, response.Counted = int64(len(files)), exact, true
+		if opts.Facets {
+			response.Facets = newFacets(files, now)
+		}
+	}
+
+	// More files may exist beyond the hits fetched, unless the cap was reached
+	if n := int64(len(result.Hits)); n == request.Limit && n < maxHits && result.EstimatedTotalHits > n {
+		response.HasMore = true
+	}
+
+	response.Results = response.Results[min(opts.Offset, int64(len(response.Results))):]
+	response.Query = query
+	response.Offset = opts.Offset
+	response.Limit = opts.Limit
+	return response, nil
+}
+
+// groupHits folds passage hits into their files, keeping the order in which
+// each file first appears. HasMore is set if files beyond limit were seen.
+func groupHits(result *types.SearchResponse, limit int) (*Response, error) {
+	response := &Response{
+		Query:              result.Query,
+		Results:            make([]Result, 0, limit),
+		EstimatedTotalHits: result.EstimatedTotalHits,
+		ProcessingTimeMs:   result.ProcessingTimeMs,
+	}
+	byFile := make(map[string]int)
+
+	for _, hit := range result.Hits {
+		var doc types.Document
+		if err := hit.DecodeInto(&doc); err != nil {
+			return nil, err
+		}
+		fileID := doc.FileID()
+
+		i, ok := byFile[fileID]
+		if !ok {
+			if len(response.Results) >= limit {
+				response.HasMore = true
+				continue
+			}
+			r := Result{Document: doc, Page: MatchedPage(hit, &doc), Snippet: snippet(hit)}
+			r.Document.ID = fileID
+			r.Document.ParentID = ""
+			r.Document.StartLine, r.Document.EndLine = 0, 0
+			r.Document.PageOffsets, r.Document.PageBase = nil, 0
+			if scoreRaw, ok := hit["_rankingScore"]; ok {
+				json.Unmarshal(scoreRaw, &r.RankingScore)
+			}
+
+			i = len(response.Results)
+			byFile[fileID] = i
+			response.Results = append(response.Results, r)
+		}
+
+		r := &response.Results[i]
+		if doc.ParentID != "" && len(r.Passages) < maxPassages {
+			if _, ok := matchedContent(hit); ok {
+				r.Passages = append(r.Passages, Passage{
+					StartLine: doc.StartLine,
+					EndLine:   doc.EndLine,
+					Page:      MatchedPage(hit, &doc),
+					Snippet:   snippet(hit),
+				})
+				if r.Snippet == "" {
+					r.Snippet = r.Passages[len(r.Passages)-1].Snippet
+				}
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// filesRequest returns a request for the matches of request, as many as a
+// backend returns, from which the matching files are counted. With facets
+// it also fetches the fields they count.
+func filesRequest(request *types.SearchRequest, facets bool) *types.SearchRequest {
+	attributes := []string{"id", "parent_id"}
+	if facets {
+		attributes = append(attributes, "ext", "dirs", "mod_time")
+	}
+	return &types.SearchRequest{
+		Query:                request.Query,
+		Filter:               request.Filter,
+		Limit:                maxHits,
+		AttributesToRetrieve: attributes,
+	}
+}
+
+// matchedFiles returns a document for each file among the hits of a
+// filesRequest, reporting whether the hits are all the matches
+func matchedFiles(result *types.SearchResponse) ([]types.Document, bool, error) {
+	var files []types.Document
+	seen := make(map[string]bool)
+	for _, hit := range result.Hits {
+		var doc types.Document
+		if err := hit.DecodeInto(&doc); err != nil {
+			return nil, false, err
+		}
+		if id := doc.FileID(); !seen[id] {
+			seen[id] = true
+			files = append(files, doc)
+		}
+	}
+	n := int64(len(result.Hits))
+	return files, n < maxHits || result.EstimatedTotalHits <= n, nil
+}
+
+// snippet returns the cropped content of a hit with its whitespace, including
+// line breaks and page breaks, collapsed so it reads as one line
+func snippet(hit types.Hit) string {
+	raw, ok := hit["_formatted"]
+	if !ok {
+		return ""
+	}
+	var formatted struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &formatted); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(formatted.Content), " ")
 }
@@ -0,0 +1,249 @@
+package search
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sahil485/memex/internal/meilitest"
+	"github.com/sahil485/memex/pkg/types"
+)
+
+// newTestServer starts a fake Meilisearch holding docs
+func newTestServer(t *testing.T, docs ...types.Document) *meilitest.Server {
+	server := meilitest.NewServer(t)
+	c := server.Client()
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) > 0 {
+		if err := c.AddDocuments(docs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return server
+}
+
+func TestSearchRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		opts  SearchOptions
+		want  types.SearchRequest
+
+		// counts is whether a second search counts the matching files
+		counts bool
+	}{
+		{
+			name:  "defaults",
+			query: "meeting notes",
+			want:  types.SearchRequest{Query: "meeting notes", Limit: 50},
+		},
+		{
+			name:   "totals",
+			query:  "meeting notes",
+			opts:   SearchOptions{Totals: true},
+			want:   types.SearchRequest{Query: "meeting notes", Limit: 50},
+			counts: true,
+		},
+		{
+			name:  "operators become a filter",
+			query: "budget ext:xlsx size:>1KB",
+			want:  types.SearchRequest{Query: "budget", Filter: `ext = ".xlsx" AND size > 1024`, Limit: 50},
+		},
+		{
+			name:  "facet selection is ANDed with the query filter",
+			query: "budget ext:xlsx",
+			opts:  SearchOptions{Selection: FacetSelection{Directories: []string{"/data/finance/"}}},
+			want:  types.SearchRequest{Query: "budget", Filter: `(ext = ".xlsx") AND (dirs IN ["/data/finance"])`, Limit: 50},
+		},
+		{
+			name:  "sort and page",
+			query: "notes",
+			opts:  SearchOptions{Limit: 20, Page: 3, Sort: Sort{Key: SortModified, Descending: true}, Totals: true, Facets: true},
+			want:  types.SearchRequest{Query: "notes", Sort: []string{"mod_time:desc"}, Limit: 300},
+		},
+		{
+			name:  "ascending name sort",
+			query: "notes",
+			opts:  SearchOptions{Sort: Sort{Key: SortName}},
+			want:  types.SearchRequest{Query: "notes", Sort: []string{"name:asc"}, Limit: 50},
+		},
+		{
+			name:  "deep pages are capped",
+			query: "notes",
+			opts:  SearchOptions{Offset: 500},
+			want:  types.SearchRequest{Query: "notes", Limit: maxHits},
+		},
+		{
+			name:  "highlighting",
+			query: "notes",
+			opts:  SearchOptions{HighlightPreTag: "[", HighlightPostTag: "]"},
+			want: types.SearchRequest{
+				Query:                 "notes",
+				Limit:                 50,
+				AttributesToHighlight: []string{"content"},
+				HighlightPreTag:       "[",
+				HighlightPostTag:      "]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			tt.opts.Backend = server.Client()
+			if _, err := Search(tt.query, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			searches := server.Searches()
+			want := 1
+			if tt.counts {
+				want = 2
+			}
+			if len(searches) != want {
+				t.Fatalf("sent %d searches, want %d", len(searches), want)
+			}
+			if tt.counts {
+				if files := searches[1]; files.Query != tt.want.Query || files.Filter != tt.want.Filter || files.Limit != maxHits {
+					t.Errorf("file count sent q=%q filter=%q limit=%d", files.Query, files.Filter, files.Limit)
+				}
+			}
+			got := searches[0]
+			if got.Query != tt.want.Query || got.Filter != tt.want.Filter || got.Limit != tt.want.Limit ||
+				!slices.Equal(got.Sort, tt.want.Sort) {
+				t.Errorf("sent q=%q filter=%q sort=%v limit=%d, want q=%q filter=%q sort=%v limit=%d",
+					got.Query, got.Filter, got.Sort, got.Limit,
+					tt.want.Query, tt.want.Filter, tt.want.Sort, tt.want.Limit)
+			}
+			if !slices.Equal(got.AttributesToHighlight, tt.want.AttributesToHighlight) ||
+				got.HighlightPreTag != tt.want.HighlightPreTag || got.HighlightPostTag != tt.want.HighlightPostTag {
+				t.Errorf("sent highlight %v %q %q, want %v %q %q",
+					got.AttributesToHighlight, got.HighlightPreTag, got.HighlightPostTag,
+					tt.want.AttributesToHighlight, tt.want.HighlightPreTag, tt.want.HighlightPostTag)
+			}
+			if !got.ShowRankingScore || !got.ShowMatchesPosition || !slices.Equal(got.AttributesToCrop, []string{"content"}) {
+				t.Errorf("sent %+v, want ranking scores, match positions and cropped content", got)
+			}
+		})
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour).Unix()
+	docs := []types.Document{
+		{ID: "a", Path: "/data/a.md", Name: "a.md", Ext: ".md", Dirs: []string{"/data"}, ModTime: now.Unix(), Content: "plan"},
+		{ID: "b", Path: "/data/x/b.txt", Name: "b.txt", Ext: ".txt", Dirs: []string{"/data", "/data/x"}, ModTime: old, Content: "plan"},
+		{ID: "c", Path: "/data/x/c.md", Name: "c.md", Ext: ".md", Dirs: []string{"/data", "/data/x"}, ModTime: old, Passages: 3},
+	}
+	// The passages of c.md count it once
+	for i := 1; i <= 3; i++ {
+		docs = append(docs, types.Document{
+			ID: "c-" + strconv.Itoa(i), ParentID: "c", Path: "/data/x/c.md", Name: "c.md", Ext: ".md",
+			Dirs: []string{"/data", "/data/x"}, ModTime: old, Content: "plan part " + strconv.Itoa(i),
+		})
+	}
+	server := newTestServer(t, docs...)
+
+	response, err := Search("plan in:/data", SearchOptions{Facets: true, Backend: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	searches := server.Searches()
+	if len(searches) != 2 {
+		t.Fatalf("sent %d searches, want 2", len(searches))
+	}
+	if files := searches[1]; files.Filter != `dirs = "/data"` || !slices.Contains(files.AttributesToRetrieve, "mod_time") {
+		t.Errorf("file search sent filter=%q attributes=%v", files.Filter, files.AttributesToRetrieve)
+	}
+
+	if response.Facets == nil {
+		t.Fatal("no facets returned")
+	}
+	if got := response.Facets.Extensions; len(got) != 2 || got[0] != (FacetValue{Value: ".md", Count: 2}) {
+		t.Errorf("extensions = %+v, want .md first with 2 files", got)
+	}
+	if got := response.Facets.Directories; len(got) != 1 || got[0] != (FacetValue{Value: "/data/x", Count: 2}) {
+		t.Errorf("directories = %+v, want /data/x with 2 files", got)
+	}
+	var counts []int64
+	for _, v := range response.Facets.Modified {
+		counts = append(counts, v.Count)
+	}
+	if want := []int64{1, 2, 0, 0, 0}; !slices.Equal(counts, want) {
+		t.Errorf("modified counts = %v, want %v", counts, want)
+	}
+}
+
+func TestSearchGroupsPassages(t *testing.T) {
+	docs := []types.Document{
+		{ID: "small", Path: "/data/small.txt", Name: "small.txt", Content: "a needle in a small file"},
+		{ID: "large", Path: "/data/large.txt", Name: "large.txt", Passages: 4},
+		{ID: "other", Path: "/data/other.txt", Name: "other.txt", Content: "nothing to see"},
+	}
+	for i := 1; i <= 4; i++ {
+		docs = append(docs, types.Document{
+			ID:        "large-" + strconv.Itoa(i),
+			ParentID:  "large",
+			Path:      "/data/large.txt",
+			Name:      "large.txt",
+			StartLine: i * 10,
+			EndLine:   i*10 + 9,
+			Content:   "needle in passage " + strconv.Itoa(i),
+		})
+	}
+	server := newTestServer(t, docs...)
+
+	response, err := Search("needle", SearchOptions{Totals: true, Backend: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range response.Results {
+		paths = append(paths, r.Document.Path)
+	}
+	if want := []string{"/data/small.txt", "/data/large.txt"}; !slices.Equal(paths, want) {
+		t.Fatalf("results = %v, want %v", paths, want)
+	}
+
+	if !response.Counted || response.TotalFiles != 2 || !response.TotalExact || response.EstimatedTotalHits != 5 {
+		t.Errorf("counted %d files (exact %v) in %d hits, want 2 exactly in 5",
+			response.TotalFiles, response.TotalExact, response.EstimatedTotalHits)
+	}
+
+	large := response.Results[1]
+	if large.Document.ID != "large" || large.Document.ParentID != "" {
+		t.Errorf("large.txt result has ID %q and parent %q, want the file's own ID", large.Document.ID, large.Document.ParentID)
+	}
+	if len(large.Passages) != maxPassages {
+		t.Fatalf("large.txt has %d passages, want %d", len(large.Passages), maxPassages)
+	}
+	if p := large.Passages[0]; p.StartLine != 10 || p.EndLine != 19 || p.Snippet != "needle in passage 1" {
+		t.Errorf("first passage = %+v", p)
+	}
+	if large.Snippet != "needle in passage 1" {
+		t.Errorf("large.txt snippet = %q, want its first passage", large.Snippet)
+	}
+
+	// One file per page leaves the second for the next page
+	response, err = Search("needle", SearchOptions{Limit: 1, Backend: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Results) != 1 || !response.HasMore {
+		t.Errorf("got %d results, HasMore %v, want 1 and more to come", len(response.Results), response.HasMore)
+	}
+
+	// Later pages are not counted again
+	response, err = Search("needle", SearchOptions{Limit: 1, Offset: 1, Totals: true, Backend: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Results) != 1 || response.Results[0].Document.Path != "/data/large.txt" || response.Counted {
+		t.Errorf("second page has %d results, counted %v, want large.txt uncounted", len(response.Results), response.Counted)
+	}
+}
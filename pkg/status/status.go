@@ -0,0 +1,188 @@
+package status
+
+import (
+	"fmt"
+	"time"
+
+	meilisearch "github.com/meilisearch/meilisearch-go"
+	"github.com/sahil485/memex/pkg/backend"
+	"github.com/sahil485/memex/pkg/client"
+	"github.com/sahil485/memex/pkg/config"
+	"github.com/sahil485/memex/pkg/indexer"
+	"github.com/sahil485/memex/pkg/search"
+)
+
+// recentFailures is how many failed tasks are described
+const recentFailures = 5
+
+// Status describes the search engine, what is in the index and how it was
+// built. Only Backend, URL, Index and Roots are filled when the engine is
+// down.
+type Status struct {
+	// Backend is the configured search backend. URL is the Meilisearch
+	// endpoint, or the directory of an embedded index.
+	Backend string `json:"backend"`
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	Version string `json:"version,omitempty"`
+
+	Index       string `json:"index"`
+	IndexExists bool   `json:"index_exists"`
+	IsIndexing  bool   `json:"is_indexing"`
+
+	// Documents counts files and the passages of large files; Files counts
+	// files alone
+	Documents int64 `json:"documents"`
+	Files     int64 `json:"files"`
+
+	// DatabaseSize is the size of the backend's data on disk; DocumentsSize
+	// is the size of this index's documents
+	DatabaseSize  int64 `json:"database_size"`
+	DocumentsSize int64 `json:"documents_size"`
+
+	// FieldDistribution counts the documents that have each field
+	FieldDistribution map[string]int64    `json:"field_distribution"`
+	Extensions        []search.FacetValue `json:"extensions"`
+	Roots             []Root              `json:"roots"`
+
+	// LastIndexed is when the latest index run finished
+	LastIndexed *time.Time `json:"last_indexed,omitempty"`
+
+	// Tasks are only kept by Meilisearch
+	PendingTasks   int64  `json:"pending_tasks"`
+	FailedTasks    int64  `json:"failed_tasks"`
+	RecentFailures []Task `json:"recent_failures"`
+
+	// SettingsProblems lists how the index settings differ from those
+	// applied by memex init
+	SettingsProblems []string `json:"settings_problems"`
+}
+
+// Root is a directory that was indexed
+type Root struct {
+	Path    string       `json:"path"`
+	Files   int64        `json:"files"`
+	LastRun *indexer.Run `json:"last_run,omitempty"`
+}
+
+// Task is a Meilisearch task that failed
+type Task struct {
+	UID        int64     `json:"uid"`
+	Type       string    `json:"type"`
+	Error      string    `json:"error"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Get gathers the status of the engine and index. An engine that does not
+// answer is reported with Healthy unset rather than as an error.
+func Get() (*Status, error) {
+	b := backend.New()
+	s := &Status{
+		Backend: b.Name(),
+		URL:     b.Location(),
+		Index:   config.Current().IndexName,
+	}
+
+	runs, err := indexer.ReadRuns()
+	if err != nil {
+		return nil, err
+	}
+	s.Roots = make([]Root, len(runs))
+	for i := range runs {
+		s.Roots[i] = Root{Path: runs[i].Root, LastRun: &runs[i]}
+		if s.LastIndexed == nil || runs[i].FinishedAt.After(*s.LastIndexed) {
+			s.LastIndexed = &runs[i].FinishedAt
+		}
+	}
+
+	if !b.Healthy() {
+		return s, nil
+	}
+	s.Healthy = true
+
+	s.Version, err = b.Version()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+
+	stats, err := b.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+	s.DatabaseSize = stats.DatabaseSize
+	if !stats.Exists {
+		return s, nil
+	}
+	s.IndexExists = true
+	s.IsIndexing = stats.IsIndexing
+	s.Documents = stats.Documents
+	s.DocumentsSize = stats.DocumentsSize
+	s.FieldDistribution = stats.FieldDistribution
+
+	// Passages are the only documents with a parent
+	s.Files = stats.Documents - stats.FieldDistribution["parent_id"]
+
+	if err := s.addCounts(); err != nil {
+		return nil, err
+	}
+	if c, ok := b.(*client.Client); ok {
+		if err := s.addTasks(c); err != nil {
+			return nil, err
+		}
+	}
+
+	s.SettingsProblems, err = b.CheckSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index settings: %w", err)
+	}
+	return s, nil
+}
+
+// addCounts counts the files of each extension and root
+func (s *Status) addCounts() error {
+	paths := make([]string, len(s.Roots))
+	for i, r := range s.Roots {
+		paths[i] = r.Path
+	}
+
+	counts, err := search.Count(paths)
+	if err != nil {
+		return fmt.Errorf("failed to count files: %w", err)
+	}
+	s.Extensions = counts.Extensions
+	for i := range s.Roots {
+		s.Roots[i].Files = counts.Roots[i].Count
+	}
+	return nil
+}
+
+// addTasks counts pending and failed tasks and describes the latest failures
+func (s *Status) addTasks(c *client.Client) error {
+	pending, err := c.Tasks(&meilisearch.TasksQuery{
+		Statuses: []meilisearch.TaskStatus{meilisearch.TaskStatusEnqueued, meilisearch.TaskStatusProcessing},
+		Limit:    1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list tasks: %w", err)
+	}
+	s.PendingTasks = pending.Total
+
+	failed, err := c.Tasks(&meilisearch.TasksQuery{
+		Statuses: []meilisearch.TaskStatus{meilisearch.TaskStatusFailed},
+		Limit:    recentFailures,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list tasks: %w", err)
+	}
+	s.FailedTasks = failed.Total
+	s.RecentFailures = make([]Task, 0, len(failed.Results))
+	for _, t := range failed.Results {
+		s.RecentFailures = append(s.RecentFailures, Task{
+			UID:        t.UID,
+			Type:       string(t.Type),
+			Error:      t.Error.Message,
+			FinishedAt: t.FinishedAt,
+		})
+	}
+	return nil
+}
@@ -3,12 +3,25 @@ package types
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"path/filepath"
 	"time"
 )
 
 type Document struct {
 	ID string `json:"id"`
 
+	// ParentID is set on passages of a large file and holds the ID of the
+	// file's own document. StartLine and EndLine give the passage's 1-based
+	// line range within the file.
+	ParentID  string `json:"parent_id,omitempty"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+
+	// Passages is set on the document of a file that was split into
+	// passages, in which case its own Content is empty
+	Passages int `json:"passages,omitempty"`
+
 	Path    string `json:"path"`
 	Name    string `json:"name"`
 	Dir     string `json:"dir"`
@@ -16,8 +29,24 @@ type Document struct {
 	Size    int64  `json:"size"`
 	ModTime int64  `json:"mod_time"`
 
-	Content     string `json:"content"`
-	ContentHash string `json:"content_hash"`
+	// Dirs lists Dir and every directory above it, so that a search can be
+	// limited to a directory tree with a filter
+	Dirs []string `json:"dirs"`
+
+	Title       string            `json:"title,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Content     string            `json:"content"`
+	ContentHash string            `json:"content_hash"`
+
+	// PageOffsets holds the byte offset in Content where each page starts,
+	// for paginated formats such as PDF. On a passage, PageBase is the page
+	// the passage begins on and PageOffsets the pages starting within it.
+	PageOffsets []int `json:"page_offsets,omitempty"`
+	PageBase    int   `json:"page_base,omitempty"`
+
+	// ContentError records why the content could not be extracted, in which
+	// case only the file's metadata is indexed
+	ContentError string `json:"content_error,omitempty"`
 
 	Description string   `json:"description,omitempty"`
 
@@ -28,16 +57,12 @@ func NewDocument(path, name, dir, ext string, size, modTime int64, content strin
 	hash := sha256.Sum256([]byte(content))
 	contentHash := hex.EncodeToString(hash[:])
 
-	// Generate a valid Meilisearch ID using path hash
-	// Meilisearch IDs can only contain alphanumeric, hyphens, and underscores
-	pathHash := sha256.Sum256([]byte(path))
-	id := hex.EncodeToString(pathHash[:])
-
 	return &Document{
-		ID:          id,
+		ID:          DocumentID(path),
 		Path:        path,
 		Name:        name,
 		Dir:         dir,
+		Dirs:        Ancestors(dir),
 		Ext:         ext,
 		Size:        size, // bytes
 		ModTime:     modTime,
@@ -46,3 +71,52 @@ func NewDocument(path, name, dir, ext string, size, modTime int64, content strin
 		IndexedAt:   time.Now().Unix(),
 	}
 }
+
+// DocumentID returns the document ID for a file path.
+func DocumentID(path string) string {
+	// Generate a valid Meilisearch ID using path hash
+	// Meilisearch IDs can only contain alphanumeric, hyphens, and underscores
+	pathHash := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(pathHash[:])
+}
+
+// Ancestors returns dir followed by each of its parent directories up to the
+// root.
+func Ancestors(dir string) []string {
+	var dirs []string
+	for {
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// PassageID returns the document ID of the nth passage of a file.
+func PassageID(fileID string, n int) string {
+	return fmt.Sprintf("%s-%d", fileID, n)
+}
+
+// FileID returns the ID of the file a document belongs to: its parent for
+// passages, otherwise its own.
+func (d *Document) FileID() string {
+	if d.ParentID != "" {
+		return d.ParentID
+	}
+	return d.ID
+}
+
+// PageAt returns the 1-based page containing the byte offset in Content,
+// or 0 if the document has no pages.
+func (d *Document) PageAt(offset int) int {
+	page := d.PageBase
+	for _, start := range d.PageOffsets {
+		if start > offset {
+			break
+		}
+		page++
+	}
+	return page
+}
@@ -0,0 +1,74 @@
+package types
+
+import "strings"
+
+// RetrievedAttributes are the fields returned with search hits. Content is
+// displayed so it can be cropped into snippets, but is not retrieved in full.
+var RetrievedAttributes = []string{
+	"id",
+	"parent_id",
+	"start_line",
+	"end_line",
+	"passages",
+	"path",
+	"name",
+	"dir",
+	"dirs",
+	"ext",
+	"size",
+	"mod_time",
+	"title",
+	"metadata",
+	"tags",
+	"page_offsets",
+	"page_base",
+	"content_error",
+	"content_hash",
+	"indexed_at",
+}
+
+// Attributes the backends search, filter and sort on. Searchable attributes
+// are listed from the most to the least important.
+var (
+	SearchableAttributes = []string{
+		"name",
+		"title",
+		"metadata",
+		"content",
+		"tags",
+		"path",
+	}
+
+	FilterableAttributes = []string{
+		"ext",
+		"path",
+		"dir",
+		"dirs",
+		"mod_time",
+		"size",
+		"tags",
+		"parent_id",
+	}
+
+	SortableAttributes = []string{
+		"mod_time",
+		"size",
+		"name",
+	}
+)
+
+// MaxValuesPerFacet is how many values of each facet are counted, the most
+// common first
+const MaxValuesPerFacet = 100
+
+// DisplayedAttributes returns the fields a backend may return with hits
+func DisplayedAttributes() []string {
+	return append([]string{"content"}, RetrievedAttributes...)
+}
+
+// FilterValue quotes a string for use in a filter expression
+func FilterValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
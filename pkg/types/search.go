@@ -0,0 +1,79 @@
+package types
+
+import (
+	"encoding/json"
+)
+
+// SearchRequest is a query against the index, as understood by every search
+// backend. Filter uses the Meilisearch filter syntax and Sort lists
+// "attribute:asc" or "attribute:desc" keys.
+type SearchRequest struct {
+	Query  string
+	Filter string
+	Sort   []string
+	Offset int64
+	Limit  int64
+
+	// Facets lists the attributes whose value counts are returned
+	Facets []string
+
+	// AttributesToRetrieve limits the fields of each hit; empty returns all
+	AttributesToRetrieve []string
+
+	// Attributes cropped to CropLength words around the best match, and
+	// attributes whose matched words are wrapped in the highlight tags. The
+	// results are returned under the hit's _formatted field.
+	AttributesToCrop      []string
+	CropLength            int64
+	CropMarker            string
+	AttributesToHighlight []string
+	HighlightPreTag       string
+	HighlightPostTag      string
+
+	// ShowRankingScore adds _rankingScore to each hit, between 0 and 1, and
+	// ShowMatchesPosition adds the byte offsets of matches as _matchesPosition
+	ShowRankingScore    bool
+	ShowMatchesPosition bool
+}
+
+// SearchResponse holds the hits of a SearchRequest, best first
+type SearchResponse struct {
+	Query              string
+	Hits               []Hit
+	EstimatedTotalHits int64
+	ProcessingTimeMs   int64
+
+	// FacetDistribution counts the matches with each value of the requested
+	// facets
+	FacetDistribution map[string]map[string]int64
+}
+
+// Hit is a document returned by a backend, field by field
+type Hit map[string]json.RawMessage
+
+// DecodeInto decodes the hit's fields into a struct
+func (h Hit) DecodeInto(v any) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// IndexStats describes the index of a backend. Only Exists is set when the
+// index has not been created.
+type IndexStats struct {
+	Exists     bool
+	IsIndexing bool
+
+	// Documents counts files and the passages of large files
+	Documents int64
+
+	// DatabaseSize is the size of the backend's data on disk; DocumentsSize
+	// is the size of the index's documents
+	DatabaseSize  int64
+	DocumentsSize int64
+
+	// FieldDistribution counts the documents that have each field
+	FieldDistribution map[string]int64
+}
@@ -13,21 +13,18 @@ if ! command -v wails &> /dev/null; then
     export PATH=$PATH:$(go env GOPATH)/bin
 fi
 
-# Check if MeiliSearch is running
+# Start MeiliSearch through the CLI so it uses the same binary, data
+# directory and port as the desktop app. If it is already running this
+# returns immediately; otherwise it keeps running until the script exits.
 echo "🔍 Checking if MeiliSearch is running..."
-if curl -s http://localhost:58273/health > /dev/null 2>&1; then
-    echo "✅ MeiliSearch is running"
-else
-    echo "⚠️  MeiliSearch is not running"
-    echo "   Starting MeiliSearch..."
-    if [ -f ~/.memex/meilisearch ]; then
-        cd ~/.memex && ./meilisearch --http-addr localhost:58273 > /dev/null 2>&1 &
-        sleep 2
-        echo "✅ MeiliSearch started"
-    else
-        echo "❌ MeiliSearch not found. Run: go run cmd/cli/main.go init"
-        exit 1
-    fi
+go build -o ./build/bin/memex-cli ./cmd/cli || exit 1
+./build/bin/memex-cli serve &
+SERVE_PID=$!
+trap 'kill $SERVE_PID 2>/dev/null' EXIT
+sleep 2
+if ! kill -0 $SERVE_PID 2>/dev/null && ! wait $SERVE_PID; then
+    echo "❌ MeiliSearch could not be started. Is ~/.memex/meilisearch installed?"
+    exit 1
 fi
 
 # Run Wails dev mode